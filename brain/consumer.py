@@ -0,0 +1,80 @@
+import json
+import logging
+
+logger = logging.getLogger(__name__)
+
+STREAM = "chaos:traffic:stream"
+CHANNEL = "chaos:traffic"
+
+
+class StreamConsumer:
+    """
+    Reads traffic from the Redis Stream as a member of a consumer group.
+    Entries are acknowledged once learned, so a restarted Brain resumes with
+    its unacknowledged entries and then whatever arrived while it was down.
+    """
+
+    def __init__(self, redis_client, learner, group="brain", consumer="brain-1", count=100, block_ms=5000):
+        self.redis = redis_client
+        self.learner = learner
+        self.group = group
+        self.consumer = consumer
+        self.count = count
+        self.block_ms = block_ms
+        self.pending = True  # re-read our unacknowledged entries first
+
+    def ensure_group(self):
+        # A new group starts from the retained history.
+        try:
+            self.redis.xgroup_create(STREAM, self.group, id="0", mkstream=True)
+        except Exception as e:
+            if "BUSYGROUP" not in str(e):
+                raise
+
+    def poll(self) -> int:
+        """Reads and learns one batch. Returns the number of entries read."""
+        start = "0" if self.pending else ">"
+        response = self.redis.xreadgroup(
+            self.group, self.consumer, {STREAM: start},
+            count=self.count, block=None if self.pending else self.block_ms,
+        )
+        entries = [entry for _, messages in response or [] for entry in messages]
+        if self.pending and not entries:
+            self.pending = False
+            return 0
+
+        for entry_id, fields in entries:
+            self.handle(fields)
+        if entries:
+            self.redis.xack(STREAM, self.group, *[entry_id for entry_id, _ in entries])
+        return len(entries)
+
+    def handle(self, fields):
+        try:
+            self.learner.learn(json.loads(fields.get("data") or ""))
+        except json.JSONDecodeError:
+            logger.error("Failed to decode traffic entry")
+        except Exception as e:
+            logger.error(f"Error processing traffic entry: {e}")
+
+    def run(self):
+        self.ensure_group()
+        logger.info(f"Reading stream {STREAM} as {self.group}/{self.consumer}")
+        while True:
+            self.poll()
+
+
+def consume_pubsub(redis_client, learner):
+    """Learns from the pub/sub channel. Messages sent while down are lost."""
+    pubsub = redis_client.pubsub()
+    pubsub.subscribe(CHANNEL)
+    logger.info(f"Listening on channel: {CHANNEL}")
+
+    for message in pubsub.listen():
+        if message['type'] == 'message':
+            try:
+                learner.learn(json.loads(message['data']))
+            except json.JSONDecodeError:
+                logger.error("Failed to decode JSON message")
+            except Exception as e:
+                logger.error(f"Error processing message: {e}")
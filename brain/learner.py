@@ -5,9 +5,10 @@ from redis import Redis
 logger = logging.getLogger(__name__)
 
 class Learner:
-    def __init__(self, redis_client: Redis):
+    def __init__(self, redis_client: Redis, routes=("primary",)):
         self.redis = redis_client
         self.ttl = 3600 # 1 hour for now
+        self.routes = set(routes or ())  # empty = learn from every route
 
     def learn(self, traffic_data: dict):
         """
@@ -18,21 +19,61 @@ class Learner:
         path = traffic_data.get('path')
         status = traffic_data.get('status')
         
-        # Only learn from successful responses for now
-        if status and 200 <= status < 300:
+        # Only learn from successful, genuine backend responses
+        if status and 200 <= status < 300 and self.should_learn(traffic_data):
             self._save_ghost_response(method, path, traffic_data)
 
         # Update Stats
-        self.redis.incr("chaos:stats:request_count")
+        weight = self.request_weight(traffic_data)
+        if weight == 1:
+            self.redis.incr("chaos:stats:request_count")
+        elif weight > 1:
+            self.redis.incrby("chaos:stats:request_count", weight)
+
+    def request_weight(self, traffic_data: dict) -> int:
+        """
+        Number of real requests an entry stands for. A request sampled at rate
+        r stands for 1/r requests; errors and slow requests kept outside the
+        sample are already represented by it and count for nothing.
+        """
+        rate = traffic_data.get('sample_rate')
+        if not rate:
+            return 1
+        if traffic_data.get('sample_reason', 'sampled') != 'sampled':
+            return 0
+        return max(1, round(1 / rate))
+
+    def should_learn(self, traffic_data: dict) -> bool:
+        """
+        Filters on the structured traffic log (version 2). Responses served by
+        Ghost Mode or shaped by chaos are not learned, nor are truncated or
+        streamed bodies, nor entries whose bodies were skipped by head
+        sampling, nor traffic from routes outside self.routes (e.g.
+        canary). Version 1 entries lack these fields and count as genuine
+        primary traffic.
+        """
+        if traffic_data.get('ghost'):
+            return False
+        if traffic_data.get('chaos'):
+            return False
+        if traffic_data.get('response_body_truncated') or traffic_data.get('streamed'):
+            return False
+        if traffic_data.get('bodies_omitted'):
+            return False
+        if self.routes and (traffic_data.get('route') or 'primary') not in self.routes:
+            return False
+        return True
 
     def _save_ghost_response(self, method, path, data):
         key = f"chaos:ghost:{method}:{path}"
         
-        # We store the structure that the Ghost (Go) will eventually read
+        # We store the structure that the Ghost (Go) reads as redis.GhostResponse.
+        # Bodies are already decoded; binary ones stay base64-encoded.
         ghost_response = {
             "status": data.get('status'),
             "body": data.get('response_body'),
-            "headers": {}, # We didn't capture headers in MVP yet
+            "body_base64": bool(data.get('response_body_base64')),
+            "headers": data.get('response_headers') or {},
             "timestamp": data.get('timestamp')
         }
         
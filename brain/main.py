@@ -1,9 +1,10 @@
 import os
-import json
+import socket
 import redis
 import logging
 from dotenv import load_dotenv
 from learner import Learner
+from consumer import StreamConsumer, consume_pubsub
 
 # Load environment variables
 load_dotenv()
@@ -11,7 +12,13 @@ load_dotenv()
 # Configuration
 REDIS_ADDR = os.getenv("REDIS_ADDR", "localhost")
 REDIS_PORT = int(os.getenv("REDIS_PORT", 6379))
-CHANNEL = "chaos:traffic"
+# "stream" reads the durable traffic stream as a consumer group; "pubsub"
+# subscribes to the legacy channel.
+CONSUMER_MODE = os.getenv("BRAIN_CONSUMER_MODE", "stream")
+CONSUMER_GROUP = os.getenv("BRAIN_CONSUMER_GROUP", "brain")
+CONSUMER_NAME = os.getenv("BRAIN_CONSUMER_NAME", socket.gethostname())
+# Comma-separated routes to learn from (primary, canary). Empty = all.
+LEARN_ROUTES = [r.strip() for r in os.getenv("BRAIN_LEARN_ROUTES", "primary").split(",") if r.strip()]
 
 # Setup Logging
 logging.basicConfig(
@@ -26,24 +33,14 @@ def main():
     
     try:
         r = redis.Redis(host=REDIS_ADDR, port=REDIS_PORT, decode_responses=True)
-        learner = Learner(r)
+        learner = Learner(r, routes=LEARN_ROUTES)
 
-        pubsub = r.pubsub()
-        pubsub.subscribe(CHANNEL)
-        
-        logger.info(f"Listening on channel: {CHANNEL}")
         logger.info("Ready to learn...")
+        if CONSUMER_MODE == "pubsub":
+            consume_pubsub(r, learner)
+        else:
+            StreamConsumer(r, learner, group=CONSUMER_GROUP, consumer=CONSUMER_NAME).run()
 
-        for message in pubsub.listen():
-            if message['type'] == 'message':
-                try:
-                    data = json.loads(message['data'])
-                    learner.learn(data)
-                except json.JSONDecodeError:
-                    logger.error("Failed to decode JSON message")
-                except Exception as e:
-                    logger.error(f"Error processing message: {e}")
-                    
     except redis.ConnectionError:
         logger.error("Could not connect to Redis. Is it running?")
     except KeyboardInterrupt:
@@ -0,0 +1,74 @@
+"""
+Tests for the Brain stream consumer
+"""
+import unittest
+import json
+import sys
+from unittest.mock import MagicMock
+
+# Mock redis module before importing consumer
+sys.modules['redis'] = MagicMock()
+
+from consumer import StreamConsumer, STREAM
+
+
+class TestStreamConsumer(unittest.TestCase):
+    """Test cases for StreamConsumer class"""
+
+    def setUp(self):
+        self.mock_redis = MagicMock()
+        self.learner = MagicMock()
+        self.consumer = StreamConsumer(self.mock_redis, self.learner, group="brain", consumer="b1")
+
+    def entries(self, *items):
+        return [[STREAM, [(entry_id, {"data": json.dumps(data)}) for entry_id, data in items]]]
+
+    def test_existing_group_is_kept(self):
+        """Test that BUSYGROUP is not an error"""
+        self.mock_redis.xgroup_create.side_effect = Exception("BUSYGROUP Consumer Group name already exists")
+        self.consumer.ensure_group()
+
+        self.mock_redis.xgroup_create.side_effect = Exception("WRONGTYPE")
+        with self.assertRaises(Exception):
+            self.consumer.ensure_group()
+
+    def test_pending_entries_first(self):
+        """Test that unacknowledged entries are re-read before new ones"""
+        self.mock_redis.xreadgroup.side_effect = [
+            self.entries(("1-0", {"path": "/a"})),
+            [],
+            self.entries(("2-0", {"path": "/b"})),
+        ]
+
+        self.assertEqual(self.consumer.poll(), 1)
+        self.assertEqual(self.consumer.poll(), 0)
+        self.assertEqual(self.consumer.poll(), 1)
+
+        starts = [c.args[2][STREAM] for c in self.mock_redis.xreadgroup.call_args_list]
+        self.assertEqual(starts, ["0", "0", ">"])
+        self.assertEqual(self.learner.learn.call_count, 2)
+
+    def test_entries_are_acknowledged(self):
+        """Test that learned and undecodable entries are acknowledged"""
+        self.consumer.pending = False
+        self.mock_redis.xreadgroup.return_value = [[STREAM, [
+            ("1-0", {"data": json.dumps({"path": "/a"})}),
+            ("2-0", {"data": "not json"}),
+        ]]]
+
+        self.consumer.poll()
+
+        self.learner.learn.assert_called_once_with({"path": "/a"})
+        self.mock_redis.xack.assert_called_once_with(STREAM, "brain", "1-0", "2-0")
+
+    def test_timeout_reads_nothing(self):
+        """Test that a blocking read timing out is not an error"""
+        self.consumer.pending = False
+        self.mock_redis.xreadgroup.return_value = None
+
+        self.assertEqual(self.consumer.poll(), 0)
+        self.mock_redis.xack.assert_not_called()
+
+
+if __name__ == '__main__':
+    unittest.main()
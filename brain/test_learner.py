@@ -131,6 +131,82 @@ class TestLearner(unittest.TestCase):
         self.assertEqual(call_kwargs['ex'], 3600)  # 1 hour
 
 
+class TestLearnerFilters(unittest.TestCase):
+    """Tests for filtering on the structured traffic log"""
+
+    def setUp(self):
+        self.mock_redis = MagicMock()
+        from learner import Learner
+        self.learner = Learner(self.mock_redis)
+        self.traffic_data = {
+            'version': 2,
+            'method': 'GET',
+            'path': '/api/users',
+            'status': 200,
+            'response_body': '{"users": []}',
+            'response_headers': {'Content-Type': ['application/json']},
+            'route': 'primary',
+            'ghost': False,
+            'timestamp': '2025-01-01T00:00:00Z'
+        }
+
+    def test_headers_are_stored(self):
+        """Test that captured response headers are kept in the ghost response"""
+        self.learner.learn(self.traffic_data)
+
+        value = json.loads(self.mock_redis.set.call_args[0][1])
+        self.assertEqual(value['headers'], {'Content-Type': ['application/json']})
+
+    def test_binary_body_flag_is_stored(self):
+        """Test that base64-encoded binary bodies keep their flag"""
+        self.traffic_data['response_body'] = 'iVBORw0KGgo='
+        self.traffic_data['response_body_base64'] = True
+        self.learner.learn(self.traffic_data)
+
+        value = json.loads(self.mock_redis.set.call_args[0][1])
+        self.assertEqual(value['body'], 'iVBORw0KGgo=')
+        self.assertTrue(value['body_base64'])
+
+    def test_ghost_responses_not_learned(self):
+        """Test that responses served by Ghost Mode are not learned"""
+        self.traffic_data['ghost'] = True
+        self.learner.learn(self.traffic_data)
+        self.mock_redis.set.assert_not_called()
+
+    def test_chaos_responses_not_learned(self):
+        """Test that responses shaped by chaos are not learned"""
+        self.traffic_data['chaos'] = [{'kind': 'latency', 'rule': 'global', 'detail': '300ms'}]
+        self.learner.learn(self.traffic_data)
+        self.mock_redis.set.assert_not_called()
+
+    def test_incomplete_bodies_not_learned(self):
+        """Test that truncated, streamed and omitted bodies are not learned"""
+        for flag in ('response_body_truncated', 'streamed', 'bodies_omitted'):
+            data = dict(self.traffic_data, **{flag: True})
+            self.learner.learn(data)
+        self.mock_redis.set.assert_not_called()
+
+    def test_sampled_requests_are_weighted(self):
+        """Test that request_count extrapolates sampled traffic"""
+        self.learner.learn(dict(self.traffic_data, sample_rate=0.1, sample_reason='sampled'))
+        self.mock_redis.incrby.assert_called_with('chaos:stats:request_count', 10)
+
+        self.mock_redis.reset_mock()
+        self.learner.learn(dict(self.traffic_data, status=503, sample_rate=0.1, sample_reason='error'))
+        self.mock_redis.incr.assert_not_called()
+        self.mock_redis.incrby.assert_not_called()
+
+    def test_canary_not_learned_by_default(self):
+        """Test that canary traffic is only learned when its route is enabled"""
+        self.traffic_data['route'] = 'canary'
+        self.learner.learn(self.traffic_data)
+        self.mock_redis.set.assert_not_called()
+
+        from learner import Learner
+        Learner(self.mock_redis, routes=['primary', 'canary']).learn(self.traffic_data)
+        self.mock_redis.set.assert_called_once()
+
+
 class TestLearnerEdgeCases(unittest.TestCase):
     """Edge case tests for Learner"""
 
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+func runArchive(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "query" {
+		return errors.New("usage: chaosctl archive query [flags]")
+	}
+
+	fs := flag.NewFlagSet("archive query", flag.ContinueOnError)
+	dir := fs.String("dir", getEnv("TRAFFIC_ARCHIVE_DIR", "./archive"), "archive directory")
+	since := fs.String("since", "", "start time: RFC 3339 or a duration ago, e.g. 2h")
+	until := fs.String("until", "", "end time: RFC 3339 or a duration ago")
+	path := fs.String("path", "", "path prefix")
+	route := fs.String("route", "", "route: primary, canary or shadow")
+	status := fs.String("status", "", "status: 404, 5xx or 400-499")
+	requestID := fs.String("request-id", "", "request ID")
+	limit := fs.Int("limit", 0, "stop after this many entries (0 = all)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	q := archive.Query{Path: *path, Route: *route, RequestID: *requestID}
+	var err error
+	if q.Since, err = archive.ParseTime(*since); err != nil {
+		return err
+	}
+	if q.Until, err = archive.ParseTime(*until); err != nil {
+		return err
+	}
+	if *status != "" {
+		if q.StatusMin, q.StatusMax, err = archive.ParseStatus(*status); err != nil {
+			return err
+		}
+	}
+
+	// One JSON entry per line, ready for jq.
+	enc := json.NewEncoder(os.Stdout)
+	n := 0
+	var writeErr error
+	err = archive.Scan(*dir, q, func(entry redis.TrafficLog) bool {
+		if writeErr = enc.Encode(entry); writeErr != nil {
+			return false
+		}
+		n++
+		return (*limit <= 0 || n < *limit) && ctx.Err() == nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/elliot/chaosProxy/pkg/admin"
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/har"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+func runHAR(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runHARExport(ctx, args[1:])
+		case "import":
+			return runHARImport(ctx, args[1:])
+		}
+	}
+	return errors.New("usage: chaosctl har export|import [flags]")
+}
+
+func runHARExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("har export", flag.ContinueOnError)
+	sentinel := fs.String("sentinel", getEnv("SENTINEL_URL", "http://localhost:8080"), "Sentinel base URL")
+	token := fs.String("token", getEnv("ADMIN_TOKEN", ""), "Sentinel admin token")
+	dir := fs.String("archive", "", "export from this local archive instead of Sentinel")
+	base := fs.String("base", getEnv("TARGET_URL", "http://localhost"), "base URL of request URLs (archive only)")
+	out := fs.String("o", "", "output file (default stdout)")
+	params := url.Values{}
+	for flagName, param := range map[string]string{
+		"since": "since", "until": "until", "path": "path", "route": "route", "status": "status", "request-id": "request_id",
+	} {
+		fs.Func(flagName, "filter, as for archive query", func(v string) error {
+			params.Set(param, v)
+			return nil
+		})
+	}
+	limit := fs.Int("limit", 1000, "maximum entries")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var h *har.HAR
+	if *dir != "" {
+		q, err := archive.ParseQuery(params)
+		if err != nil {
+			return err
+		}
+		var entries []redis.TrafficLog
+		err = archive.Scan(*dir, q, func(e redis.TrafficLog) bool {
+			entries = append(entries, e)
+			return len(entries) < *limit && ctx.Err() == nil
+		})
+		if err != nil {
+			return err
+		}
+		h = har.Export(entries, *base)
+	} else {
+		params.Set("limit", strconv.Itoa(*limit))
+		var err error
+		if h, err = admin.NewClient(*sentinel, *token).ExportHAR(ctx, params); err != nil {
+			return err
+		}
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(h); err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "📦 Exported %d entries to %s\n", len(h.Log.Entries), *out)
+	}
+	return nil
+}
+
+func runHARImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("har import", flag.ContinueOnError)
+	sentinel := fs.String("sentinel", getEnv("SENTINEL_URL", "http://localhost:8080"), "Sentinel base URL")
+	token := fs.String("token", getEnv("ADMIN_TOKEN", ""), "Sentinel admin token")
+	host := fs.String("host", "", "only import requests to this host")
+	ttl := fs.Int("ttl", 3600, "ghost response TTL in seconds")
+	noGhost := fs.Bool("no-ghost", false, "import traffic without seeding Ghost Mode")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("exactly one HAR file is required")
+	}
+	if *ttl <= 0 {
+		return errors.New("--ttl must be a positive number of seconds")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h, err := har.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{"ttl": {strconv.Itoa(*ttl)}}
+	if *host != "" {
+		params.Set("host", *host)
+	}
+	if *noGhost {
+		params.Set("ghost", "false")
+	}
+	result, err := admin.NewClient(*sentinel, *token).ImportHAR(ctx, h, params)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("👻 Imported %d entries, seeded %d ghost responses\n", result.Entries, result.Ghosts)
+	return nil
+}
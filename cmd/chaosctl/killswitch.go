@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/elliot/chaosProxy/pkg/admin"
+)
+
+func runKillSwitch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("killswitch", flag.ContinueOnError)
+	sentinel := fs.String("sentinel", getEnv("SENTINEL_URL", "http://localhost:8080"), "Sentinel base URL")
+	token := fs.String("token", getEnv("ADMIN_TOKEN", ""), "Sentinel admin token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var engaged bool
+	switch fs.Arg(0) {
+	case "on":
+		engaged = true
+	case "off":
+		engaged = false
+	default:
+		return errors.New("usage: chaosctl killswitch [flags] on|off")
+	}
+
+	if err := admin.NewClient(*sentinel, *token).SetKillSwitch(ctx, engaged); err != nil {
+		return err
+	}
+
+	if engaged {
+		fmt.Println("🛑 Kill switch engaged: all chaos stopped")
+	} else {
+		fmt.Println("✅ Kill switch released")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Command chaosctl drives a running Sentinel from the terminal or CI.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{name: "scenario", usage: "scenario run [flags] <file.yaml>   Run a game day playbook", run: runScenario},
+	{name: "killswitch", usage: "killswitch [flags] on|off          Stop or allow all chaos on every Sentinel", run: runKillSwitch},
+	{name: "archive", usage: "archive query [flags]              Query the local traffic archive", run: runArchive},
+	{name: "har", usage: "har export|import [flags]          Export traffic as HAR or import a HAR file", run: runHAR},
+	{name: "replay", usage: "replay --target <url> [flags]      Replay recorded traffic and compare with the recording", run: runReplay},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(ctx, os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "chaosctl %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: chaosctl <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", cmd.usage)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/diff"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/replay"
+)
+
+// listFlag collects a repeated flag.
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ", ") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	source := fs.String("source", replay.SourceRedis, "recorded traffic: redis, jsonl or har")
+	from := fs.String("from", getEnv("TRAFFIC_ARCHIVE_DIR", "./archive"), "archive directory or JSONL file (jsonl), or HAR file (har)")
+	redisAddr := fs.String("redis", getEnv("REDIS_ADDR", "localhost:6379"), "Redis address (redis)")
+	target := fs.String("target", "", "base URL to send the requests to (required)")
+	since := fs.String("since", "", "start time: RFC 3339 or a duration ago, e.g. 2h")
+	until := fs.String("until", "", "end time: RFC 3339 or a duration ago")
+	path := fs.String("path", "", "path prefix")
+	route := fs.String("route", "", "route: primary, canary or shadow")
+	status := fs.String("status", "", "recorded status: 404, 5xx or 400-499")
+	limit := fs.Int("limit", 1000, "maximum entries (0 = all)")
+	originalTiming := fs.Bool("original-timing", false, "keep the recorded gaps between requests")
+	speed := fs.Float64("speed", 1, "timing multiplier with --original-timing, e.g. 2 = twice as fast")
+	concurrency := fs.Int("concurrency", 10, "maximum requests in flight")
+	timeout := fs.Duration("timeout", 30*time.Second, "per-request timeout")
+	var headers, ignore listFlag
+	fs.Var(&headers, "header", "set a header on every request, 'Name: value' (repeatable; empty value removes it)")
+	compare := fs.Bool("diff", false, "compare response bodies with the recording")
+	fs.Var(&ignore, "ignore", "JSONPath not compared, e.g. '$..updated_at' (repeatable; implies --diff)")
+	ignoreFile := fs.String("ignore-file", "", "YAML file of ignore rules per route (implies --diff)")
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *target == "" {
+		return errors.New("--target is required")
+	}
+
+	q := archive.Query{Path: *path, Route: *route}
+	var err error
+	if q.Since, err = archive.ParseTime(*since); err != nil {
+		return err
+	}
+	if q.Until, err = archive.ParseTime(*until); err != nil {
+		return err
+	}
+	if *status != "" {
+		if q.StatusMin, q.StatusMax, err = archive.ParseStatus(*status); err != nil {
+			return err
+		}
+	}
+	rewrites, err := replay.ParseHeaders(headers)
+	if err != nil {
+		return err
+	}
+
+	var diffRules *diff.Config
+	if *compare || len(ignore) > 0 || *ignoreFile != "" {
+		rules, err := diff.Load(*ignoreFile)
+		if err != nil {
+			return err
+		}
+		rules.Ignore = append(rules.Ignore, ignore...)
+		diffRules = &rules
+	}
+
+	var client *redis.Client
+	if *source == replay.SourceRedis {
+		if client, err = redis.NewClient(*redisAddr, os.Getenv("REDIS_PASSWORD")); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+	entries, err := replay.Load(ctx, *source, *from, client, q, *limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("no recorded traffic matches the filters")
+	}
+
+	replayer, err := replay.New(replay.Options{
+		Target:         *target,
+		OriginalTiming: *originalTiming,
+		Speed:          *speed,
+		Concurrency:    *concurrency,
+		Headers:        rewrites,
+		Timeout:        *timeout,
+		Diff:           diffRules,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "🔁 Replaying %d entries against %s\n", len(entries), *target)
+	summary := replayer.Run(ctx, entries)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}
+	fmt.Print(summary.Text())
+	return nil
+}
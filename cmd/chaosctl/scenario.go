@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/elliot/chaosProxy/pkg/admin"
+	"github.com/elliot/chaosProxy/pkg/scenario"
+)
+
+func runScenario(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "run" {
+		return errors.New("usage: chaosctl scenario run [flags] <file.yaml>")
+	}
+
+	fs := flag.NewFlagSet("scenario run", flag.ContinueOnError)
+	sentinel := fs.String("sentinel", getEnv("SENTINEL_URL", "http://localhost:8080"), "Sentinel base URL")
+	token := fs.String("token", getEnv("ADMIN_TOKEN", ""), "Sentinel admin token")
+	jsonOut := fs.String("json", "", "write the JSON report to this file")
+	mdOut := fs.String("md", "", "write the Markdown report to this file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("exactly one scenario file is required")
+	}
+
+	s, err := scenario.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	runner := scenario.NewRunner(admin.NewClient(*sentinel, *token), os.Stdout)
+	report := runner.Run(ctx, s)
+
+	if *jsonOut != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*jsonOut, data, 0o644); err != nil {
+			return err
+		}
+	}
+	if *mdOut != "" {
+		if err := os.WriteFile(*mdOut, []byte(report.Markdown()), 0o644); err != nil {
+			return err
+		}
+	}
+
+	if !report.Passed {
+		return fmt.Errorf("scenario %q failed", s.Name)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	_ "time/tzdata" // Schedules need time zones even in minimal images
 
 	"github.com/elliot/chaosProxy/internal/config"
 	"github.com/elliot/chaosProxy/internal/server"
@@ -32,7 +33,10 @@ func main() {
 	}
 
 	// Initialize and Start Server
-	srv := server.NewServer(cfg, redisClient)
+	srv, err := server.NewServer(cfg, redisClient)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 	if err := srv.Start(); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
@@ -36,6 +36,10 @@ export async function POST(request: NextRequest) {
 
         await redis.hset('chaos:settings', settings);
 
+        // Bump the version and notify Sentinels so they apply it immediately
+        const version = await redis.hincrby('chaos:settings', 'version', 1);
+        await redis.publish('chaos:settings:updates', String(version));
+
         return NextResponse.json({ success: true, settings: body });
     } catch (error) {
         console.error('Failed to update chaos settings:', error);
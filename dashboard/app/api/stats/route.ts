@@ -1,18 +1,51 @@
-import { NextResponse } from 'next/server';
+import { NextRequest, NextResponse } from 'next/server';
 import redis from '@/lib/redis';
 
 export const dynamic = 'force-dynamic';
 
-export async function GET() {
+interface TrafficLog {
+    version?: number;
+    method: string;
+    status: number;
+    route?: string;
+    ghost?: boolean;
+    chaos?: { kind: string; rule?: string; detail?: string }[];
+}
+
+// Filters: ?method=GET&status=5xx&route=canary&ghost=true&chaos=true
+function matches(log: TrafficLog, params: URLSearchParams): boolean {
+    const method = params.get('method');
+    if (method && log.method !== method.toUpperCase()) return false;
+
+    const status = params.get('status');
+    if (status && String(log.status)[0] !== status[0]) return false;
+
+    const route = params.get('route');
+    if (route && (log.route || 'primary') !== route) return false;
+
+    const ghost = params.get('ghost');
+    if (ghost && Boolean(log.ghost) !== (ghost === 'true')) return false;
+
+    const chaos = params.get('chaos');
+    if (chaos && (log.chaos?.length ?? 0) > 0 !== (chaos === 'true')) return false;
+
+    return true;
+}
+
+export async function GET(request: NextRequest) {
     try {
         const [totalRequests, ghostCount] = await Promise.all([
             redis.get('chaos:stats:request_count'),
             redis.get('chaos:stats:ghost_count'),
         ]);
 
-        // Fetch recent logs
-        const recentLogsRaw = await redis.lrange('chaos:logs:recent', 0, 19); // Get last 20
-        const recentLogs = recentLogsRaw.map(log => JSON.parse(log));
+        // Fetch recent logs, filter, then keep the last 20
+        const params = request.nextUrl.searchParams;
+        const recentLogsRaw = await redis.lrange('chaos:logs:recent', 0, -1);
+        const recentLogs = recentLogsRaw
+            .map(log => JSON.parse(log) as TrafficLog)
+            .filter(log => matches(log, params))
+            .slice(0, 20);
 
         return NextResponse.json({
             totalRequests: parseInt(totalRequests || '0'),
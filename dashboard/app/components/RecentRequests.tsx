@@ -1,62 +1,127 @@
 'use client';
 
 import { formatDistanceToNow } from 'date-fns';
-import { Ghost, CheckCircle, AlertTriangle, Clock } from 'lucide-react';
+import { Ghost, CheckCircle, AlertTriangle, Clock, Zap, Bird, Copy } from 'lucide-react';
 
 interface Log {
+    version?: number;
     method: string;
     path: string;
+    query?: string;
     status: number;
     duration: string;
+    duration_ms?: number;
     timestamp: string;
+    request_id?: string;
+    client_ip?: string;
+    route?: string;
+    ghost?: boolean;
+    chaos?: { kind: string; rule?: string; detail?: string }[];
 }
 
-export default function RecentRequests({ logs }: { logs: Log[] }) {
+export interface TrafficFilters {
+    method?: string;
+    status?: string;
+    route?: string;
+    ghost?: string;
+    chaos?: string;
+}
+
+interface Props {
+    logs: Log[];
+    filters: TrafficFilters;
+    onFiltersChange: (filters: TrafficFilters) => void;
+}
+
+export default function RecentRequests({ logs, filters, onFiltersChange }: Props) {
+    const filterBar = <FilterBar filters={filters} onChange={onFiltersChange} />;
+
     if (!logs || logs.length === 0) {
         return (
-            <div className="text-center p-8 text-neutral-500 italic bg-neutral-900/30 rounded-lg border border-neutral-800">
-                Waiting for traffic...
+            <div className="space-y-3">
+                {filterBar}
+                <div className="text-center p-8 text-neutral-500 italic bg-neutral-900/30 rounded-lg border border-neutral-800">
+                    Waiting for traffic...
+                </div>
             </div>
         );
     }
 
     return (
-        <div className="overflow-hidden rounded-lg border border-neutral-800 bg-neutral-900/50">
-            <table className="w-full text-sm text-left">
-                <thead className="bg-neutral-900 text-neutral-400 font-medium">
-                    <tr>
-                        <th className="px-4 py-3">Method</th>
-                        <th className="px-4 py-3">Path</th>
-                        <th className="px-4 py-3">Status</th>
-                        <th className="px-4 py-3">Duration</th>
-                        <th className="px-4 py-3">Time</th>
-                    </tr>
-                </thead>
-                <tbody className="divide-y divide-neutral-800 text-neutral-300">
-                    {logs.map((log, i) => (
-                        <tr key={i} className="hover:bg-neutral-800/50 transition-colors">
-                            <td className="px-4 py-3 font-mono">
-                                <span className={`px-2 py-1 rounded text-xs font-bold ${getMethodColor(log.method)}`}>
-                                    {log.method}
-                                </span>
-                            </td>
-                            <td className="px-4 py-3 font-mono truncate max-w-[200px]" title={log.path}>
-                                {log.path}
-                            </td>
-                            <td className="px-4 py-3">
-                                <StatusBadge status={log.status} />
-                            </td>
-                            <td className="px-4 py-3 font-mono text-neutral-500">{log.duration}</td>
-                            <td className="px-4 py-3 text-neutral-500 whitespace-nowrap">
-                                <div className="flex items-center gap-1">
-                                    <Clock size={12} />
-                                    {formatDistanceToNow(new Date(log.timestamp), { addSuffix: true })}
-                                </div>
-                            </td>
+        <div className="space-y-3">
+            {filterBar}
+            <div className="overflow-hidden rounded-lg border border-neutral-800 bg-neutral-900/50">
+                <table className="w-full text-sm text-left">
+                    <thead className="bg-neutral-900 text-neutral-400 font-medium">
+                        <tr>
+                            <th className="px-4 py-3">Method</th>
+                            <th className="px-4 py-3">Path</th>
+                            <th className="px-4 py-3">Status</th>
+                            <th className="px-4 py-3">Duration</th>
+                            <th className="px-4 py-3">Time</th>
                         </tr>
-                    ))}
-                </tbody>
-            </table>
+                    </thead>
+                    <tbody className="divide-y divide-neutral-800 text-neutral-300">
+                        {logs.map((log, i) => (
+                            <tr key={i} className="hover:bg-neutral-800/50 transition-colors">
+                                <td className="px-4 py-3 font-mono">
+                                    <span className={`px-2 py-1 rounded text-xs font-bold ${getMethodColor(log.method)}`}>
+                                        {log.method}
+                                    </span>
+                                </td>
+                                <td className="px-4 py-3 font-mono truncate max-w-[200px]" title={log.query ? `${log.path}?${log.query}` : log.path}>
+                                    <span className="flex items-center gap-1">
+                                        {log.ghost && <Ghost size={12} className="text-purple-400 shrink-0" />}
+                                        {log.route === 'canary' && <Bird size={12} className="text-yellow-400 shrink-0" />}
+                                        {log.route === 'shadow' && <Copy size={12} className="text-sky-400 shrink-0" />}
+                                        {log.chaos && log.chaos.length > 0 && (
+                                            <span title={log.chaos.map(c => [c.kind, c.rule, c.detail].filter(Boolean).join(' ')).join(', ')}>
+                                                <Zap size={12} className="text-orange-400 shrink-0" />
+                                            </span>
+                                        )}
+                                        {log.path}
+                                    </span>
+                                </td>
+                                <td className="px-4 py-3">
+                                    <StatusBadge status={log.status} />
+                                </td>
+                                <td className="px-4 py-3 font-mono text-neutral-500">
+                                    {log.duration_ms !== undefined ? `${log.duration_ms.toFixed(1)}ms` : log.duration}
+                                </td>
+                                <td className="px-4 py-3 text-neutral-500 whitespace-nowrap">
+                                    <div className="flex items-center gap-1">
+                                        <Clock size={12} />
+                                        {formatDistanceToNow(new Date(log.timestamp), { addSuffix: true })}
+                                    </div>
+                                </td>
+                            </tr>
+                        ))}
+                    </tbody>
+                </table>
+            </div>
+        </div>
+    );
+}
+
+function FilterBar({ filters, onChange }: { filters: TrafficFilters, onChange: (filters: TrafficFilters) => void }) {
+    const select = (key: keyof TrafficFilters, label: string, options: [string, string][]) => (
+        <select
+            value={filters[key] || ''}
+            onChange={e => onChange({ ...filters, [key]: e.target.value || undefined })}
+            className="bg-neutral-900 border border-neutral-800 rounded px-2 py-1 text-xs text-neutral-300"
+        >
+            <option value="">{label}</option>
+            {options.map(([value, text]) => <option key={value} value={value}>{text}</option>)}
+        </select>
+    );
+
+    return (
+        <div className="flex flex-wrap gap-2">
+            {select('method', 'Any method', [['GET', 'GET'], ['POST', 'POST'], ['PUT', 'PUT'], ['DELETE', 'DELETE']])}
+            {select('status', 'Any status', [['2xx', '2xx'], ['3xx', '3xx'], ['4xx', '4xx'], ['5xx', '5xx']])}
+            {select('route', 'Any route', [['primary', 'Primary'], ['canary', 'Canary'], ['shadow', 'Shadow']])}
+            {select('ghost', 'Ghost: any', [['true', 'Ghost only'], ['false', 'No ghost']])}
+            {select('chaos', 'Chaos: any', [['true', 'Chaos only'], ['false', 'No chaos']])}
         </div>
     );
 }
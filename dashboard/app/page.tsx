@@ -3,7 +3,7 @@
 import { useEffect, useState } from 'react';
 import { Activity, Ghost, Server, ShieldAlert, Globe, Zap, Skull } from 'lucide-react';
 import ChaosControl from './components/ChaosControl';
-import RecentRequests from './components/RecentRequests';
+import RecentRequests, { TrafficFilters } from './components/RecentRequests';
 import BlockedIPs from './components/BlockedIPs';
 import Header from './components/Header';
 
@@ -16,10 +16,14 @@ interface Stats {
 
 export default function Home() {
   const [stats, setStats] = useState<Stats | null>(null);
+  const [filters, setFilters] = useState<TrafficFilters>({});
 
   const fetchStats = async () => {
     try {
-      const res = await fetch('/api/stats');
+      const query = new URLSearchParams(
+        Object.entries(filters).filter(([, value]) => value) as [string, string][]
+      );
+      const res = await fetch(`/api/stats?${query}`);
       const data = await res.json();
       setStats(data);
     } catch (error) {
@@ -31,7 +35,7 @@ export default function Home() {
     fetchStats();
     const interval = setInterval(fetchStats, 2000);
     return () => clearInterval(interval);
-  }, []);
+  }, [filters]);
 
   if (!stats) return <div className="flex h-screen items-center justify-center bg-black text-white">Loading Chaos...</div>;
 
@@ -92,7 +96,7 @@ export default function Home() {
           <div className="space-y-6">
             <div className="p-6 rounded-xl bg-neutral-900/50 border border-neutral-800 backdrop-blur-sm">
               <h3 className="text-xl font-semibold mb-4 text-neutral-200">Recent Traffic</h3>
-              <RecentRequests logs={stats.recentLogs} />
+              <RecentRequests logs={stats.recentLogs} filters={filters} onFiltersChange={setFilters} />
             </div>
 
             <ChaosControl />
@@ -2,8 +2,13 @@ module github.com/elliot/chaosProxy
 
 go 1.25.5
 
+require (
+	github.com/andybalholm/brotli v1.2.6
+	github.com/redis/go-redis/v9 v9.17.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/redis/go-redis/v9 v9.17.2 // indirect
 )
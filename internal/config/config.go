@@ -3,6 +3,17 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/cassette"
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/diff"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/middleware"
+	"github.com/elliot/chaosProxy/pkg/redact"
 )
 
 type Config struct {
@@ -14,10 +25,53 @@ type Config struct {
 	WebhookURL             string
 	CanaryURL              string
 	CanaryWeight           int
+	ShadowURL              string
+	ShadowPercent          float64
+	ShadowTimeout          int // ms
+	ShadowMaxInFlight      int
+	ShadowDiff             bool
+	ShadowDiffRulesFile    string
+	CassetteMode           string
+	CassetteDir            string
+	CassetteMatch          []string
+	CassetteMatchHeaders   []string
 	SecurityFuzzingEnabled bool
 	SimulateRegion         string
 	RetryMax               int
 	RetryDelay             int // ms
+	ChaosDirectivesSecret  string
+	AdminToken             string
+	AdminTokens            []string // name:token pairs
+	SteadyStateWindow      int      // seconds
+	ChaosAllowProduction   bool
+	ChaosMaxFailureRate    int
+	ChaosMaxLatency        int // ms, 0 = unlimited
+	ChaosExcludedRoutes    []string
+	ChaosExcludedClients   []string
+	ChaosExcludedGroups    []string
+	ChaosGroupHeader       string
+	TrafficCaptureHeaders  []string
+	TrafficRedactHeaders   []string
+	TrafficMaxBody         int // bytes
+	TrafficSampleRate      float64
+	TrafficSampleMode      string
+	TrafficSampleRoutes    []string
+	TrafficKeepErrors      bool
+	TrafficSlowMs          int // ms, 0 = off
+	TrafficWorkers         int
+	TrafficQueueSize       int
+	TrafficStreamMaxLen    int
+	TrafficStreamMaxAge    int // seconds, 0 = keep
+	TrafficPubSub          bool
+	TrafficArchiveDir      string
+	TrafficArchiveMaxBytes int
+	TrafficArchiveRotate   int // seconds
+	TrafficArchiveRetain   int // seconds, 0 = keep
+	TrafficLiveBuffer      int
+	TrafficLiveMaxClients  int
+	RedactionPolicyFile    string
+	PIIDetection           []string
+	PIITokenKey            string
 }
 
 func getEnv(key, fallback string) string {
@@ -37,10 +91,106 @@ func LoadConfig() *Config {
 		WebhookURL:             getEnv("WEBHOOK_URL", ""),
 		CanaryURL:              getEnv("CANARY_URL", ""),
 		CanaryWeight:           getEnvInt("CANARY_WEIGHT", 0),
+		ShadowURL:              getEnv("SHADOW_URL", ""),
+		ShadowPercent:          getEnvFloat("SHADOW_PERCENT", 100),
+		ShadowTimeout:          getEnvInt("SHADOW_TIMEOUT_MS", 5000),
+		ShadowMaxInFlight:      getEnvInt("SHADOW_MAX_IN_FLIGHT", 50),
+		ShadowDiff:             getEnv("SHADOW_DIFF", "false") == "true",
+		ShadowDiffRulesFile:    getEnv("SHADOW_DIFF_RULES_FILE", ""),
+		CassetteMode:           getEnv("CASSETTE_MODE", cassette.ModeOff),
+		CassetteDir:            getEnv("CASSETTE_DIR", "cassettes"),
+		CassetteMatch:          getEnvList("CASSETTE_MATCH", strings.Join(cassette.DefaultMatch, ",")),
+		CassetteMatchHeaders:   getEnvList("CASSETTE_MATCH_HEADERS", ""),
 		SecurityFuzzingEnabled: getEnv("SECURITY_FUZZING_ENABLED", "false") == "true",
 		SimulateRegion:         getEnv("SIMULATE_REGION", ""),
 		RetryMax:               getEnvInt("RETRY_COUNT", 0),
 		RetryDelay:             getEnvInt("RETRY_DELAY", 100), // Default 100ms
+		ChaosDirectivesSecret:  getEnv("CHAOS_DIRECTIVES_SECRET", ""),
+		AdminToken:             getEnv("ADMIN_TOKEN", ""),
+		AdminTokens:            getEnvList("ADMIN_TOKENS", ""),
+		SteadyStateWindow:      getEnvInt("STEADY_STATE_WINDOW", 30),
+		ChaosAllowProduction:   getEnv("CHAOS_ALLOW_PRODUCTION", "false") == "true",
+		ChaosMaxFailureRate:    getEnvInt("CHAOS_MAX_FAILURE_RATE", 100),
+		ChaosMaxLatency:        getEnvInt("CHAOS_MAX_LATENCY_MS", 30000),
+		ChaosExcludedRoutes:    getEnvList("CHAOS_EXCLUDED_ROUTES", "/healthz"),
+		ChaosExcludedClients:   getEnvList("CHAOS_EXCLUDED_CLIENTS", ""),
+		ChaosExcludedGroups:    getEnvList("CHAOS_EXCLUDED_GROUPS", ""),
+		ChaosGroupHeader:       getEnv("CHAOS_GROUP_HEADER", "X-Client-Group"),
+		TrafficCaptureHeaders:  getEnvList("TRAFFIC_CAPTURE_HEADERS", "Content-Type,Accept,User-Agent"),
+		TrafficRedactHeaders:   getEnvList("TRAFFIC_REDACT_HEADERS", ""),
+		TrafficMaxBody:         getEnvInt("TRAFFIC_MAX_BODY_BYTES", 1024*1024),
+		TrafficSampleRate:      getEnvFloat("TRAFFIC_SAMPLE_RATE", 1),
+		TrafficSampleMode:      getEnv("TRAFFIC_SAMPLE_MODE", middleware.SampleTail),
+		TrafficSampleRoutes:    getEnvList("TRAFFIC_SAMPLE_ROUTES", ""),
+		TrafficKeepErrors:      getEnv("TRAFFIC_KEEP_ERRORS", "true") == "true",
+		TrafficSlowMs:          getEnvInt("TRAFFIC_SLOW_MS", 1000),
+		TrafficWorkers:         getEnvInt("TRAFFIC_WORKERS", 4),
+		TrafficQueueSize:       getEnvInt("TRAFFIC_QUEUE_SIZE", 1000),
+		TrafficStreamMaxLen:    getEnvInt("TRAFFIC_STREAM_MAXLEN", 100000),
+		TrafficStreamMaxAge:    getEnvInt("TRAFFIC_STREAM_MAX_AGE", 86400),
+		TrafficPubSub:          getEnv("TRAFFIC_PUBSUB", "true") == "true",
+		TrafficArchiveDir:      getEnv("TRAFFIC_ARCHIVE_DIR", ""),
+		TrafficArchiveMaxBytes: getEnvInt("TRAFFIC_ARCHIVE_MAX_BYTES", 100*1024*1024),
+		TrafficArchiveRotate:   getEnvInt("TRAFFIC_ARCHIVE_ROTATE", 3600),
+		TrafficArchiveRetain:   getEnvInt("TRAFFIC_ARCHIVE_RETENTION", 7*24*3600),
+		TrafficLiveBuffer:      getEnvInt("TRAFFIC_LIVE_BUFFER", 256),
+		TrafficLiveMaxClients:  getEnvInt("TRAFFIC_LIVE_MAX_CLIENTS", 100),
+		RedactionPolicyFile:    getEnv("REDACTION_POLICY_FILE", ""),
+		PIIDetection:           getEnvList("PII_DETECTION", redact.PIIEmail),
+		PIITokenKey:            getEnv("PII_TOKEN_KEY", ""),
+	}
+}
+
+// AuditFields returns the non-secret settings whose changes between restarts are audited.
+func (c *Config) AuditFields() map[string]string {
+	return map[string]string{
+		"PORT":                      c.Port,
+		"TARGET_URL":                c.TargetURL,
+		"APP_ENV":                   c.AppEnv,
+		"CANARY_URL":                c.CanaryURL,
+		"CANARY_WEIGHT":             fmt.Sprint(c.CanaryWeight),
+		"SHADOW_URL":                c.ShadowURL,
+		"SHADOW_PERCENT":            fmt.Sprint(c.ShadowPercent),
+		"SHADOW_TIMEOUT_MS":         fmt.Sprint(c.ShadowTimeout),
+		"SHADOW_MAX_IN_FLIGHT":      fmt.Sprint(c.ShadowMaxInFlight),
+		"SHADOW_DIFF":               fmt.Sprint(c.ShadowDiff),
+		"SHADOW_DIFF_RULES_FILE":    c.ShadowDiffRulesFile,
+		"CASSETTE_MODE":             c.CassetteMode,
+		"CASSETTE_DIR":              c.CassetteDir,
+		"CASSETTE_MATCH":            strings.Join(c.CassetteMatch, ","),
+		"CASSETTE_MATCH_HEADERS":    strings.Join(c.CassetteMatchHeaders, ","),
+		"SECURITY_FUZZING_ENABLED":  fmt.Sprint(c.SecurityFuzzingEnabled),
+		"SIMULATE_REGION":           c.SimulateRegion,
+		"RETRY_COUNT":               fmt.Sprint(c.RetryMax),
+		"RETRY_DELAY":               fmt.Sprint(c.RetryDelay),
+		"STEADY_STATE_WINDOW":       fmt.Sprint(c.SteadyStateWindow),
+		"CHAOS_ALLOW_PRODUCTION":    fmt.Sprint(c.ChaosAllowProduction),
+		"CHAOS_MAX_FAILURE_RATE":    fmt.Sprint(c.ChaosMaxFailureRate),
+		"CHAOS_MAX_LATENCY_MS":      fmt.Sprint(c.ChaosMaxLatency),
+		"CHAOS_EXCLUDED_ROUTES":     strings.Join(c.ChaosExcludedRoutes, ","),
+		"CHAOS_EXCLUDED_CLIENTS":    strings.Join(c.ChaosExcludedClients, ","),
+		"CHAOS_EXCLUDED_GROUPS":     strings.Join(c.ChaosExcludedGroups, ","),
+		"TRAFFIC_CAPTURE_HEADERS":   strings.Join(c.TrafficCaptureHeaders, ","),
+		"TRAFFIC_REDACT_HEADERS":    strings.Join(c.TrafficRedactHeaders, ","),
+		"TRAFFIC_MAX_BODY_BYTES":    fmt.Sprint(c.TrafficMaxBody),
+		"TRAFFIC_SAMPLE_RATE":       fmt.Sprint(c.TrafficSampleRate),
+		"TRAFFIC_SAMPLE_MODE":       c.TrafficSampleMode,
+		"TRAFFIC_SAMPLE_ROUTES":     strings.Join(c.TrafficSampleRoutes, ","),
+		"TRAFFIC_KEEP_ERRORS":       fmt.Sprint(c.TrafficKeepErrors),
+		"TRAFFIC_SLOW_MS":           fmt.Sprint(c.TrafficSlowMs),
+		"TRAFFIC_WORKERS":           fmt.Sprint(c.TrafficWorkers),
+		"TRAFFIC_QUEUE_SIZE":        fmt.Sprint(c.TrafficQueueSize),
+		"TRAFFIC_STREAM_MAXLEN":     fmt.Sprint(c.TrafficStreamMaxLen),
+		"TRAFFIC_STREAM_MAX_AGE":    fmt.Sprint(c.TrafficStreamMaxAge),
+		"TRAFFIC_PUBSUB":            fmt.Sprint(c.TrafficPubSub),
+		"TRAFFIC_ARCHIVE_DIR":       c.TrafficArchiveDir,
+		"TRAFFIC_ARCHIVE_MAX_BYTES": fmt.Sprint(c.TrafficArchiveMaxBytes),
+		"TRAFFIC_ARCHIVE_ROTATE":    fmt.Sprint(c.TrafficArchiveRotate),
+		"TRAFFIC_ARCHIVE_RETENTION": fmt.Sprint(c.TrafficArchiveRetain),
+		"TRAFFIC_LIVE_BUFFER":       fmt.Sprint(c.TrafficLiveBuffer),
+		"TRAFFIC_LIVE_MAX_CLIENTS":  fmt.Sprint(c.TrafficLiveMaxClients),
+		"REDACTION_POLICY_FILE":     c.RedactionPolicyFile,
+		"PII_DETECTION":             strings.Join(c.PIIDetection, ","),
 	}
 }
 
@@ -53,3 +203,179 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+// ChaosLimits builds the blast-radius limits. Chaos is disabled in
+// production unless CHAOS_ALLOW_PRODUCTION is set.
+func (c *Config) ChaosLimits() (chaos.Limits, error) {
+	if c.ChaosMaxFailureRate < 0 || c.ChaosMaxFailureRate > 100 {
+		return chaos.Limits{}, fmt.Errorf("CHAOS_MAX_FAILURE_RATE must be between 0 and 100")
+	}
+	if c.ChaosMaxLatency < 0 {
+		return chaos.Limits{}, fmt.Errorf("CHAOS_MAX_LATENCY_MS must not be negative")
+	}
+
+	clients, err := chaos.ParseNetworks(c.ChaosExcludedClients)
+	if err != nil {
+		return chaos.Limits{}, fmt.Errorf("CHAOS_EXCLUDED_CLIENTS: %w", err)
+	}
+
+	return chaos.Limits{
+		Disabled:        c.AppEnv == "production" && !c.ChaosAllowProduction,
+		MaxFailureRate:  c.ChaosMaxFailureRate,
+		MaxLatency:      time.Duration(c.ChaosMaxLatency) * time.Millisecond,
+		ExcludedRoutes:  c.ChaosExcludedRoutes,
+		ExcludedClients: clients,
+		ExcludedGroups:  c.ChaosExcludedGroups,
+		GroupHeader:     c.ChaosGroupHeader,
+	}, nil
+}
+
+// Redactor builds the traffic log redaction policy from
+// REDACTION_POLICY_FILE, with TRAFFIC_REDACT_HEADERS and PII_DETECTION added
+// to the default. PII is tokenized when PII_TOKEN_KEY is set.
+func (c *Config) Redactor() (*redact.Redactor, error) {
+	policy, err := redact.Load(c.RedactionPolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("REDACTION_POLICY_FILE: %w", err)
+	}
+	policy.Default.Headers = append(policy.Default.Headers, c.TrafficRedactHeaders...)
+	policy.Default.PII = append(policy.Default.PII, c.PIIDetection...)
+	if c.PIITokenKey != "" {
+		policy.TokenKey = []byte(c.PIITokenKey)
+	}
+	return redact.New(policy)
+}
+
+// TrafficCapture builds the traffic log capture, sampling, publishing and
+// stream retention settings.
+func (c *Config) TrafficCapture() (middleware.TrafficCapture, error) {
+	if c.TrafficSampleRate < 0 || c.TrafficSampleRate > 1 {
+		return middleware.TrafficCapture{}, fmt.Errorf("TRAFFIC_SAMPLE_RATE must be between 0 and 1")
+	}
+	if c.TrafficSampleMode != middleware.SampleHead && c.TrafficSampleMode != middleware.SampleTail {
+		return middleware.TrafficCapture{}, fmt.Errorf("TRAFFIC_SAMPLE_MODE must be head or tail")
+	}
+	if c.TrafficStreamMaxLen < 0 || c.TrafficStreamMaxAge < 0 {
+		return middleware.TrafficCapture{}, fmt.Errorf("TRAFFIC_STREAM_MAXLEN and TRAFFIC_STREAM_MAX_AGE must not be negative")
+	}
+	routes, err := middleware.ParseSamplingRoutes(c.TrafficSampleRoutes)
+	if err != nil {
+		return middleware.TrafficCapture{}, fmt.Errorf("TRAFFIC_SAMPLE_ROUTES: %w", err)
+	}
+
+	return middleware.TrafficCapture{
+		Headers: c.TrafficCaptureHeaders,
+		MaxBody: c.TrafficMaxBody,
+		Sampling: middleware.Sampling{
+			Rate:          c.TrafficSampleRate,
+			Mode:          c.TrafficSampleMode,
+			Routes:        routes,
+			KeepErrors:    c.TrafficKeepErrors,
+			SlowThreshold: time.Duration(c.TrafficSlowMs) * time.Millisecond,
+		},
+		Workers:   c.TrafficWorkers,
+		QueueSize: c.TrafficQueueSize,
+		Storage: redis.TrafficStorage{
+			MaxLen: int64(c.TrafficStreamMaxLen),
+			MaxAge: time.Duration(c.TrafficStreamMaxAge) * time.Second,
+			PubSub: c.TrafficPubSub,
+		},
+	}, nil
+}
+
+// Shadow builds the shadow mirroring settings. Mirroring is off when
+// SHADOW_URL is empty; with SHADOW_DIFF, shadow responses are compared with
+// the primary using the ignore rules in SHADOW_DIFF_RULES_FILE.
+func (c *Config) Shadow() (middleware.ShadowConfig, error) {
+	if c.ShadowPercent < 0 || c.ShadowPercent > 100 {
+		return middleware.ShadowConfig{}, fmt.Errorf("SHADOW_PERCENT must be between 0 and 100")
+	}
+	if c.ShadowTimeout < 0 || c.ShadowMaxInFlight < 0 {
+		return middleware.ShadowConfig{}, fmt.Errorf("SHADOW_TIMEOUT_MS and SHADOW_MAX_IN_FLIGHT must not be negative")
+	}
+
+	shadow := middleware.ShadowConfig{
+		URL:         c.ShadowURL,
+		Percent:     c.ShadowPercent,
+		Timeout:     time.Duration(c.ShadowTimeout) * time.Millisecond,
+		MaxInFlight: c.ShadowMaxInFlight,
+		MaxBody:     c.TrafficMaxBody,
+	}
+	if c.ShadowDiff {
+		rules, err := diff.Load(c.ShadowDiffRulesFile)
+		if err != nil {
+			return middleware.ShadowConfig{}, fmt.Errorf("SHADOW_DIFF_RULES_FILE: %w", err)
+		}
+		shadow.Diff = &rules
+	}
+	return shadow, nil
+}
+
+// Cassette builds the record/playback settings. Cassettes are off unless
+// CASSETTE_MODE is record or playback.
+func (c *Config) Cassette() (middleware.CassetteConfig, error) {
+	switch c.CassetteMode {
+	case "", cassette.ModeOff, cassette.ModeRecord, cassette.ModePlayback:
+	default:
+		return middleware.CassetteConfig{}, fmt.Errorf("CASSETTE_MODE must be off, record or playback")
+	}
+	matcher, err := cassette.ParseMatcher(c.CassetteMatch, c.CassetteMatchHeaders)
+	if err != nil {
+		return middleware.CassetteConfig{}, fmt.Errorf("CASSETTE_MATCH: %w", err)
+	}
+	return middleware.CassetteConfig{Mode: c.CassetteMode, Dir: c.CassetteDir, Matcher: matcher}, nil
+}
+
+// TrafficArchive returns the local traffic archive settings. The archive is
+// off when TRAFFIC_ARCHIVE_DIR is empty.
+func (c *Config) TrafficArchive() archive.Options {
+	return archive.Options{
+		Dir:       c.TrafficArchiveDir,
+		MaxSize:   int64(c.TrafficArchiveMaxBytes),
+		MaxAge:    time.Duration(c.TrafficArchiveRotate) * time.Second,
+		Retention: time.Duration(c.TrafficArchiveRetain) * time.Second,
+	}
+}
+
+// AdminActors maps every admin token to the actor it identifies in the
+// audit log: ADMIN_TOKEN is "admin", and ADMIN_TOKENS adds named tokens as
+// name:token pairs. No tokens leave the admin API open.
+func (c *Config) AdminActors() (map[string]string, error) {
+	actors := make(map[string]string, len(c.AdminTokens)+1)
+	if c.AdminToken != "" {
+		actors[c.AdminToken] = "admin"
+	}
+	for i, pair := range c.AdminTokens {
+		name, token, ok := strings.Cut(pair, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			// The entry is not echoed: it may be a bare token.
+			return nil, fmt.Errorf("ADMIN_TOKENS: entry %d is not name:token", i+1)
+		}
+		if _, dup := actors[token]; dup {
+			return nil, fmt.Errorf("ADMIN_TOKENS: the token of %q is already in use", name)
+		}
+		actors[token] = name
+	}
+	return actors, nil
+}
+
+// getEnvList reads a comma-separated list, skipping empty entries.
+func getEnvList(key, fallback string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_Defaults(t *testing.T) {
@@ -95,3 +97,130 @@ func TestGetEnv_ExistingVar(t *testing.T) {
 		t.Errorf("Expected 'actual_value', got '%s'", result)
 	}
 }
+
+func TestChaosLimits_Production(t *testing.T) {
+	cfg := &Config{AppEnv: "production", ChaosMaxFailureRate: 100}
+
+	limits, err := cfg.ChaosLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !limits.Disabled {
+		t.Error("Expected chaos to be disabled in production by default")
+	}
+
+	cfg.ChaosAllowProduction = true
+	if limits, _ := cfg.ChaosLimits(); limits.Disabled {
+		t.Error("Expected CHAOS_ALLOW_PRODUCTION to enable chaos in production")
+	}
+
+	cfg.ChaosExcludedClients = []string{"bogus"}
+	if _, err := cfg.ChaosLimits(); err == nil {
+		t.Error("Expected an error for an invalid excluded client")
+	}
+}
+
+func TestTrafficCapture_Sampling(t *testing.T) {
+	cfg := &Config{
+		TrafficSampleRate:   0.5,
+		TrafficSampleMode:   "head",
+		TrafficSampleRoutes: []string{"/api/search=0.1:tail"},
+		TrafficKeepErrors:   true,
+		TrafficSlowMs:       250,
+		TrafficStreamMaxAge: 3600,
+		TrafficPubSub:       true,
+	}
+
+	capture, err := cfg.TrafficCapture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capture.Sampling.Rate != 0.5 || len(capture.Sampling.Routes) != 1 || capture.Sampling.SlowThreshold != 250*time.Millisecond {
+		t.Errorf("Unexpected sampling: %+v", capture.Sampling)
+	}
+	if capture.Storage.MaxAge != time.Hour || !capture.Storage.PubSub {
+		t.Errorf("Unexpected storage: %+v", capture.Storage)
+	}
+
+	cfg.TrafficSampleRate = 2
+	if _, err := cfg.TrafficCapture(); err == nil {
+		t.Error("Expected an error for a rate above 1")
+	}
+
+	cfg.TrafficSampleRate = 1
+	cfg.TrafficSampleRoutes = []string{"/api=often"}
+	if _, err := cfg.TrafficCapture(); err == nil {
+		t.Error("Expected an error for an invalid sampling route")
+	}
+}
+
+func TestShadow(t *testing.T) {
+	cfg := &Config{ShadowURL: "http://shadow:8080", ShadowPercent: 25, ShadowTimeout: 2000, ShadowMaxInFlight: 10}
+
+	shadow, err := cfg.Shadow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shadow.Percent != 25 || shadow.Timeout != 2*time.Second || shadow.MaxInFlight != 10 || shadow.Diff != nil {
+		t.Errorf("Unexpected shadow settings: %+v", shadow)
+	}
+
+	cfg.ShadowDiff = true
+	if shadow, err = cfg.Shadow(); err != nil || shadow.Diff == nil {
+		t.Errorf("Expected diffing to be enabled, got %+v (%v)", shadow, err)
+	}
+
+	cfg.ShadowDiffRulesFile = "/nonexistent/rules.yaml"
+	if _, err := cfg.Shadow(); err == nil {
+		t.Error("Expected an error for a missing rules file")
+	}
+
+	cfg.ShadowPercent = 150
+	if _, err := cfg.Shadow(); err == nil {
+		t.Error("Expected an error for a percent above 100")
+	}
+}
+
+func TestCassette(t *testing.T) {
+	cfg := &Config{CassetteMode: "playback", CassetteDir: "testdata", CassetteMatch: []string{"method", "path"}, CassetteMatchHeaders: []string{"x-tenant"}}
+
+	cassette, err := cfg.Cassette()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cassette.Matcher.Method || cassette.Matcher.Body || len(cassette.Matcher.Headers) != 1 || cassette.Matcher.Headers[0] != "X-Tenant" {
+		t.Errorf("Unexpected matcher: %+v", cassette.Matcher)
+	}
+
+	cfg.CassetteMatch = []string{"cookies"}
+	if _, err := cfg.Cassette(); err == nil {
+		t.Error("Expected an error for an unknown match field")
+	}
+
+	cfg.CassetteMatch = []string{"path"}
+	cfg.CassetteMode = "replay"
+	if _, err := cfg.Cassette(); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestAdminActors(t *testing.T) {
+	cfg := &Config{AdminToken: "shared", AdminTokens: []string{"alice:tok-a", " ci : tok-ci "}}
+
+	actors, err := cfg.AdminActors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actors) != 3 || actors["shared"] != "admin" || actors["tok-a"] != "alice" || actors["tok-ci"] != "ci" {
+		t.Errorf("Unexpected actors: %v", actors)
+	}
+
+	for _, tokens := range [][]string{{"bare-token"}, {"bob:"}, {"bob:shared"}} {
+		cfg.AdminTokens = tokens
+		if _, err := cfg.AdminActors(); err == nil {
+			t.Errorf("Expected %q to be rejected", tokens)
+		} else if strings.Contains(err.Error(), "bare-token") || strings.Contains(err.Error(), "shared") {
+			t.Errorf("Expected the error not to reveal a token, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// ActorHeader names the person or system making an admin API change. It is
+// only used while the admin API is open; otherwise the actor is the one the
+// admin token identifies.
+const ActorHeader = "X-Chaos-Actor"
+
+// auditEntry starts an audit entry for an admin API request.
+func auditEntry(r *http.Request, action, target string) audit.Entry {
+	actor, ok := authenticatedActor(r)
+	if !ok {
+		if actor = r.Header.Get(ActorHeader); actor == "" {
+			actor = "anonymous"
+		}
+	}
+	return audit.Entry{
+		Actor:  actor,
+		Source: audit.SourceAdminAPI,
+		Client: r.RemoteAddr,
+		Action: action,
+		Target: target,
+	}
+}
+
+// recordAudit appends an entry; a failure is logged but does not fail the request.
+func recordAudit(r *http.Request, auditLog *audit.Log, e audit.Entry) {
+	if err := auditLog.Record(r.Context(), e); err != nil {
+		log.Printf("Failed to record audit entry %s: %v", e.Action, err)
+	}
+}
+
+// ListAudit returns audit entries, newest first. Supports ?since= and
+// ?until= (RFC3339), ?actor=, ?source=, ?action= and ?limit=.
+func ListAudit(auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := audit.Query{
+			Actor:  params.Get("actor"),
+			Source: params.Get("source"),
+			Action: params.Get("action"),
+		}
+
+		var err error
+		if v := params.Get("since"); v != "" {
+			if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+				response.Error(w, http.StatusBadRequest, "Invalid 'since', expected RFC3339")
+				return
+			}
+		}
+		if v := params.Get("until"); v != "" {
+			if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+				response.Error(w, http.StatusBadRequest, "Invalid 'until', expected RFC3339")
+				return
+			}
+		}
+		if v := params.Get("limit"); v != "" {
+			if q.Limit, err = strconv.Atoi(v); err != nil {
+				response.Error(w, http.StatusBadRequest, "Invalid 'limit'")
+				return
+			}
+		}
+
+		entries, err := auditLog.List(r.Context(), q)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to fetch audit log")
+			return
+		}
+		response.JSON(w, http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuth_Actor(t *testing.T) {
+	var actor string
+	handler := AdminAuth(map[string]string{"tok-a": "alice"})(func(w http.ResponseWriter, r *http.Request) {
+		actor = auditEntry(r, "chaos.update", "").Actor
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/chaos/settings", nil)
+	req.Header.Set("Authorization", "Bearer tok-a")
+	req.Header.Set(ActorHeader, "mallory")
+	handler(httptest.NewRecorder(), req)
+	if actor != "alice" {
+		t.Errorf("Expected the actor of the token, got %q", actor)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/chaos/settings", nil)
+	req.Header.Set("X-Admin-Token", "wrong")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unknown token, got %d", w.Code)
+	}
+
+	open := AdminAuth(nil)(func(w http.ResponseWriter, r *http.Request) {
+		actor = auditEntry(r, "chaos.update", "").Actor
+	})
+	req = httptest.NewRequest(http.MethodPut, "/api/chaos/settings", nil)
+	req.Header.Set(ActorHeader, "bob")
+	open(httptest.NewRecorder(), req)
+	if actor != "bob" {
+		t.Errorf("Expected the actor header while the admin API is open, got %q", actor)
+	}
+}
+
+func TestRequireAdminAuth(t *testing.T) {
+	called := false
+	next := func(w http.ResponseWriter, r *http.Request) { called = true }
+
+	w := httptest.NewRecorder()
+	RequireAdminAuth(nil)(next)(w, httptest.NewRequest(http.MethodGet, "/api/traffic/stream", nil))
+	if w.Code != http.StatusUnauthorized || called {
+		t.Errorf("Expected 401 without configured tokens, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/traffic/stream", nil)
+	req.Header.Set("X-Admin-Token", "tok-a")
+	RequireAdminAuth(map[string]string{"tok-a": "alice"})(next)(httptest.NewRecorder(), req)
+	if !called {
+		t.Error("Expected a valid token to be let through")
+	}
+}
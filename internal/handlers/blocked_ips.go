@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 
+	"github.com/elliot/chaosProxy/pkg/audit"
 	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/response"
 )
 
 type BlockedIPsResponse struct {
@@ -32,3 +35,41 @@ func GetBlockedIPs(redisClient *redis.Client) http.HandlerFunc {
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// BlockIP adds {"ip": "..."} to the blocklist.
+func BlockIP(redisClient *redis.Client, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IP string `json:"ip"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || net.ParseIP(body.IP) == nil {
+			response.Error(w, http.StatusBadRequest, "A valid 'ip' is required")
+			return
+		}
+
+		err := auditLog.Change(r.Context(), audit.ResourceBlocklist, auditEntry(r, "blocklist.add", body.IP), func() error {
+			return redisClient.GetRawClient().SAdd(r.Context(), "chaos:settings:blocked_ips", body.IP).Err()
+		})
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to block IP")
+			return
+		}
+		response.JSON(w, http.StatusOK, map[string]string{"blocked": body.IP})
+	}
+}
+
+// UnblockIP removes an IP from the blocklist.
+func UnblockIP(redisClient *redis.Client, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := r.PathValue("ip")
+
+		err := auditLog.Change(r.Context(), audit.ResourceBlocklist, auditEntry(r, "blocklist.remove", ip), func() error {
+			return redisClient.GetRawClient().SRem(r.Context(), "chaos:settings:blocked_ips", ip).Err()
+		})
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to unblock IP")
+			return
+		}
+		response.JSON(w, http.StatusOK, map[string]string{"unblocked": ip})
+	}
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/elliot/chaosProxy/pkg/middleware"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// GetCassetteStats returns the cassette mode, hits, misses and recordings,
+// with the latest misses.
+func GetCassetteStats(cassette *middleware.Cassette) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, cassette.Stats())
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/middleware"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// GetChaosSettings returns the chaos settings this Sentinel currently
+// applies, with their version and when they were last synced from Redis.
+func GetChaosSettings(chaos *middleware.ChaosMiddleware) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, chaos.Snapshot())
+	}
+}
+
+// UpdateChaosSettings applies a partial update of the global chaos settings,
+// e.g. {"failure_enabled": true, "failure_rate": 20}.
+func UpdateChaosSettings(redisClient *redis.Client, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+
+		fields, err := settingsFields(body)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err = auditLog.Change(r.Context(), audit.ResourceSettings, auditEntry(r, "chaos.settings.update", ""), func() error {
+			return redisClient.UpdateChaosSettings(r.Context(), fields)
+		})
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to update chaos settings")
+			return
+		}
+
+		settings, err := redisClient.GetChaosSettings(r.Context())
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to fetch chaos settings")
+			return
+		}
+		response.JSON(w, http.StatusOK, settings)
+	}
+}
+
+// EngageKillSwitch stops all chaos on every Sentinel and aborts running experiments.
+func EngageKillSwitch(redisClient *redis.Client, manager *chaos.Manager, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := auditEntry(r, "chaos.kill", "")
+		err := auditLog.Change(r.Context(), audit.ResourceSettings, entry, func() error {
+			return redisClient.SetKillSwitch(r.Context(), true)
+		})
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to engage kill switch")
+			return
+		}
+		log.Printf("🛑 Kill switch engaged by %s", entry.Actor)
+
+		aborted, err := manager.AbortAll(r.Context(), "kill switch engaged")
+		if err != nil {
+			log.Printf("Failed to abort experiments: %v", err)
+		}
+		for _, e := range aborted {
+			recordAudit(r, auditLog, auditEntry(r, "experiment.abort", e.ID+" ("+e.Name+")"))
+		}
+
+		response.JSON(w, http.StatusOK, map[string]interface{}{
+			"kill_switch": true,
+			"aborted":     len(aborted),
+		})
+	}
+}
+
+// ReleaseKillSwitch allows chaos again. Aborted experiments stay aborted.
+func ReleaseKillSwitch(redisClient *redis.Client, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := auditEntry(r, "chaos.kill.release", "")
+		err := auditLog.Change(r.Context(), audit.ResourceSettings, entry, func() error {
+			return redisClient.SetKillSwitch(r.Context(), false)
+		})
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to release kill switch")
+			return
+		}
+		log.Printf("✅ Kill switch released by %s", entry.Actor)
+
+		response.JSON(w, http.StatusOK, map[string]interface{}{"kill_switch": false})
+	}
+}
+
+// settingsFields converts a JSON update into the string fields stored in chaos:settings.
+func settingsFields(body map[string]interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(body))
+	for key, value := range body {
+		switch key {
+		case "latency_enabled", "failure_enabled":
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a boolean", key)
+			}
+			fields[key] = strconv.FormatBool(b)
+		case "latency_min", "latency_max", "failure_rate":
+			n, ok := value.(float64)
+			if !ok || n < 0 || n != float64(int(n)) {
+				return nil, fmt.Errorf("%s must be a non-negative integer", key)
+			}
+			if key == "failure_rate" && n > 100 {
+				return nil, fmt.Errorf("failure_rate must be between 0 and 100")
+			}
+			fields[key] = strconv.Itoa(int(n))
+		default:
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no settings given")
+	}
+	return fields, nil
+}
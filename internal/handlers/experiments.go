@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// ListExperiments returns every experiment, newest first.
+func ListExperiments(manager *chaos.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		experiments, err := manager.List(r.Context())
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to fetch experiments")
+			return
+		}
+		response.JSON(w, http.StatusOK, experiments)
+	}
+}
+
+// CreateExperiment stores a new pending experiment from the JSON body.
+func CreateExperiment(manager *chaos.Manager, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var e chaos.Experiment
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid experiment: "+err.Error())
+			return
+		}
+
+		created, err := manager.Create(r.Context(), &e)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		recordAudit(r, auditLog, auditEntry(r, "experiment.create", created.ID+" ("+created.Name+")"))
+		response.JSON(w, http.StatusCreated, created)
+	}
+}
+
+// GetExperiment returns the status of a single experiment.
+func GetExperiment(manager *chaos.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, err := manager.Get(r.Context(), r.PathValue("id"))
+		if err != nil {
+			experimentError(w, err)
+			return
+		}
+		response.JSON(w, http.StatusOK, e)
+	}
+}
+
+// ExperimentAction applies a lifecycle action: start, pause or abort.
+func ExperimentAction(manager *chaos.Manager, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		action := r.PathValue("action")
+
+		before, err := manager.Get(r.Context(), id)
+		if err != nil {
+			experimentError(w, err)
+			return
+		}
+
+		var e *chaos.Experiment
+		switch action {
+		case "start":
+			e, err = manager.Start(r.Context(), id)
+		case "pause":
+			e, err = manager.Pause(r.Context(), id)
+		case "abort":
+			e, err = manager.Abort(r.Context(), id, "aborted via admin API")
+		default:
+			response.Error(w, http.StatusNotFound, "Unknown action")
+			return
+		}
+
+		if err != nil {
+			experimentError(w, err)
+			return
+		}
+
+		entry := auditEntry(r, "experiment."+action, e.ID+" ("+e.Name+")")
+		entry.Diff = map[string]audit.Change{"state": {From: before.State, To: e.State}}
+		recordAudit(r, auditLog, entry)
+		response.JSON(w, http.StatusOK, e)
+	}
+}
+
+func experimentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, chaos.ErrNotFound):
+		response.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, chaos.ErrInvalidTransition):
+		response.Error(w, http.StatusConflict, err.Error())
+	default:
+		response.Error(w, http.StatusInternalServerError, "Failed to update experiment")
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/har"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/middleware"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+const (
+	harDefaultLimit = 1000
+	harMaxLimit     = 10000
+	harMaxUpload    = 64 << 20
+	// harGhostTTL matches the Brain's ghost TTL.
+	harGhostTTL = time.Hour
+)
+
+// ExportHAR returns the traffic stream entries selected by since, until,
+// path, route, status and request_id as a HAR 1.2 file. Request URLs use
+// the base parameter, defaulting to baseURL.
+func ExportHAR(redisClient *redis.Client, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := archive.ParseQuery(r.URL.Query())
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		limit := harDefaultLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > harMaxLimit {
+				response.Error(w, http.StatusBadRequest, fmt.Sprintf("'limit' must be between 1 and %d", harMaxLimit))
+				return
+			}
+		}
+		base := r.URL.Query().Get("base")
+		if base == "" {
+			base = baseURL
+		}
+
+		var entries []redis.TrafficLog
+		err = archive.ScanStream(r.Context(), redisClient, q, func(e redis.TrafficLog) bool {
+			entries = append(entries, e)
+			return len(entries) < limit
+		})
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to read traffic")
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="traffic.har"`)
+		response.JSON(w, http.StatusOK, har.Export(entries, base))
+	}
+}
+
+// ImportHAR publishes the entries of an uploaded HAR file as traffic and,
+// unless ghost=false, seeds Ghost Mode with their successful responses for
+// ttl seconds. host limits the import to one host of a browser session.
+func ImportHAR(redisClient *redis.Client, traffic *middleware.TrafficPublisher, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		ttl := harGhostTTL
+		if v := params.Get("ttl"); v != "" {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				response.Error(w, http.StatusBadRequest, "'ttl' must be a positive number of seconds")
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+
+		h, err := har.Decode(http.MaxBytesReader(w, r.Body, harMaxUpload))
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		entries := h.Traffic(params.Get("host"))
+
+		if err := traffic.Import(r.Context(), entries); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to publish traffic")
+			return
+		}
+
+		var ghosts []har.Ghost
+		if params.Get("ghost") != "false" {
+			ghosts = har.Ghosts(entries)
+			for _, g := range ghosts {
+				if err := redisClient.SaveGhostResponse(r.Context(), g.Method, g.Path, g.Response, ttl); err != nil {
+					response.Error(w, http.StatusInternalServerError, "Failed to save ghost responses")
+					return
+				}
+			}
+		}
+
+		result := har.ImportResult{Entries: len(entries), Ghosts: len(ghosts)}
+		recordAudit(r, auditLog, auditEntry(r, "har.import", fmt.Sprintf("%d entries, %d ghosts", result.Entries, result.Ghosts)))
+		response.JSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/metrics"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// GetMetrics returns the steady-state metrics of live proxied traffic.
+func GetMetrics(window *metrics.Window) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, window.Snapshot(time.Now()))
+	}
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/elliot/chaosProxy/pkg/redact"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// GetPIIStats returns the PII detected in captured traffic per route, so
+// leaky endpoints can be found.
+func GetPIIStats(redactor *redact.Redactor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, redactor.Stats())
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/replay"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+const (
+	replayDefaultLimit = 1000
+	replayMaxLimit     = 100000
+)
+
+// StartReplay loads the traffic selected by the JSON spec from the stream,
+// the local archive in archiveDir or an inline HAR file, and replays it
+// against the spec's target in the background.
+func StartReplay(redisClient *redis.Client, manager *replay.Manager, archiveDir string, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var spec replay.Spec
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, harMaxUpload)).Decode(&spec); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid replay: "+err.Error())
+			return
+		}
+		q, err := spec.Query()
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if spec.Limit == 0 {
+			spec.Limit = replayDefaultLimit
+		}
+		if spec.Limit < 0 || spec.Limit > replayMaxLimit {
+			response.Error(w, http.StatusBadRequest, fmt.Sprintf("'limit' must be between 1 and %d", replayMaxLimit))
+			return
+		}
+
+		var entries []redis.TrafficLog
+		switch spec.Source {
+		case replay.SourceRedis:
+			entries, err = replay.FromStream(r.Context(), redisClient, q, spec.Limit)
+		case replay.SourceJSONL:
+			if archiveDir == "" {
+				response.Error(w, http.StatusBadRequest, "TRAFFIC_ARCHIVE_DIR is not set")
+				return
+			}
+			entries, err = replay.FromJSONL(archiveDir, q, spec.Limit)
+		case replay.SourceHAR:
+			if spec.HAR == nil {
+				response.Error(w, http.StatusBadRequest, "Source 'har' needs a 'har' file")
+				return
+			}
+			entries = replay.Filter(spec.HAR.Traffic(""), q, spec.Limit)
+		default:
+			response.Error(w, http.StatusBadRequest, "'source' must be redis, jsonl or har")
+			return
+		}
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to read traffic")
+			return
+		}
+		if len(entries) == 0 {
+			response.Error(w, http.StatusBadRequest, "No recorded traffic matches the filters")
+			return
+		}
+
+		run, err := manager.Start(spec.Source, entries, spec.Options)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		recordAudit(r, auditLog, auditEntry(r, "replay.start", fmt.Sprintf("%s (%d %s entries to %s)", run.ID, run.Entries, run.Source, run.Options.Target)))
+		response.JSON(w, http.StatusAccepted, run)
+	}
+}
+
+// ListReplays returns the recent replays, newest first.
+func ListReplays(manager *replay.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, manager.List())
+	}
+}
+
+// GetReplay returns the progress of a replay and, once it has ended, its
+// summary.
+func GetReplay(manager *replay.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		run, err := manager.Get(r.PathValue("id"))
+		if err != nil {
+			replayError(w, err)
+			return
+		}
+		response.JSON(w, http.StatusOK, run)
+	}
+}
+
+// CancelReplay stops sending the remaining requests of a replay.
+func CancelReplay(manager *replay.Manager, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		run, err := manager.Cancel(r.PathValue("id"))
+		if err != nil {
+			replayError(w, err)
+			return
+		}
+		recordAudit(r, auditLog, auditEntry(r, "replay.cancel", run.ID))
+		response.JSON(w, http.StatusOK, run)
+	}
+}
+
+func replayError(w http.ResponseWriter, err error) {
+	if errors.Is(err, replay.ErrNotFound) {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Error(w, http.StatusInternalServerError, "Failed to read replay")
+}
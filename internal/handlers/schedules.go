@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// ListSchedules returns every chaos schedule.
+func ListSchedules(scheduler *chaos.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schedules, err := scheduler.List(r.Context())
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to fetch schedules")
+			return
+		}
+		response.JSON(w, http.StatusOK, schedules)
+	}
+}
+
+// SaveSchedule creates or replaces a schedule from the JSON body.
+func SaveSchedule(scheduler *chaos.Scheduler, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sched chaos.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid schedule: "+err.Error())
+			return
+		}
+
+		saved, err := scheduler.Save(r.Context(), &sched)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		recordAudit(r, auditLog, auditEntry(r, "schedule.save", saved.ID+" ("+saved.Name+")"))
+		response.JSON(w, http.StatusOK, saved)
+	}
+}
+
+// DeleteSchedule removes a schedule.
+func DeleteSchedule(scheduler *chaos.Scheduler, auditLog *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if err := scheduler.Delete(r.Context(), id); err != nil {
+			if errors.Is(err, chaos.ErrNotFound) {
+				response.Error(w, http.StatusNotFound, "Schedule not found")
+				return
+			}
+			response.Error(w, http.StatusInternalServerError, "Failed to delete schedule")
+			return
+		}
+
+		recordAudit(r, auditLog, auditEntry(r, "schedule.delete", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DryRunSchedules shows what would be active at ?at=<RFC3339> (default: now).
+func DryRunSchedules(scheduler *chaos.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		at := time.Now()
+		if v := r.URL.Query().Get("at"); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				response.Error(w, http.StatusBadRequest, "Invalid 'at', expected RFC3339")
+				return
+			}
+			at = parsed
+		}
+
+		plan, err := scheduler.Plan(r.Context(), at)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to evaluate schedules")
+			return
+		}
+		response.JSON(w, http.StatusOK, map[string]interface{}{
+			"at":        at,
+			"schedules": plan,
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/elliot/chaosProxy/pkg/middleware"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// GetShadowStats returns the shadow mirroring counters.
+func GetShadowStats(shadow *middleware.Shadower) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, shadow.Stats())
+	}
+}
+
+// GetShadowDiff returns the live diff of shadow and primary responses.
+func GetShadowDiff(shadow *middleware.Shadower) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := shadow.Report()
+		if report == nil {
+			response.Error(w, http.StatusNotFound, "Shadow diffing is off (set SHADOW_URL and SHADOW_DIFF=true)")
+			return
+		}
+		response.JSON(w, http.StatusOK, report)
+	}
+}
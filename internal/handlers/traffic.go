@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/live"
+	"github.com/elliot/chaosProxy/pkg/middleware"
+	"github.com/elliot/chaosProxy/pkg/response"
+)
+
+// GetTrafficStats returns the traffic log publishing counters, including
+// entries dropped because the queue was full.
+func GetTrafficStats(traffic *middleware.TrafficPublisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, traffic.Stats())
+	}
+}
+
+// streamHeartbeat keeps idle streams open through proxies, and streamWriteTimeout
+// disconnects clients that stop reading.
+const (
+	streamHeartbeat    = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// StreamTraffic streams published traffic entries as Server-Sent Events
+// ("traffic" events), filtered by the query parameters of live.ParseFilter.
+// A client that falls behind loses entries and gets a "dropped" event with
+// the count instead of slowing down the proxy.
+func StreamTraffic(hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := live.ParseFilter(r.URL.Query())
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sub, err := hub.Subscribe(filter)
+		if errors.Is(err, live.ErrTooManySubscribers) {
+			response.Error(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		defer hub.Unsubscribe(sub)
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 3000\n: connected\n\n")
+		rc.Flush()
+
+		// Each write must finish in time; the deadline is lifted when the stream ends.
+		defer rc.SetWriteDeadline(time.Time{})
+		write := func(format string, args ...any) bool {
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := fmt.Fprintf(w, format, args...); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if !write(": keepalive\n\n") {
+					return
+				}
+			case entry := <-sub.C:
+				if n := sub.Dropped(); n > 0 && !write("event: dropped\ndata: {\"dropped\": %d}\n\n", n) {
+					return
+				}
+				data, err := json.Marshal(entry)
+				if err != nil {
+					continue
+				}
+				if !write("event: traffic\ndata: %s\n\n", data) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// GetTrafficStreamStats returns the live stream subscribers and the entries
+// they were sent or lost.
+func GetTrafficStreamStats(hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.JSON(w, http.StatusOK, hub.Stats())
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/live"
+)
+
+func TestStreamTraffic(t *testing.T) {
+	hub := live.NewHub(1, 1)
+	srv := httptest.NewServer(StreamTraffic(hub))
+	defer srv.Close()
+
+	if resp, _ := http.Get(srv.URL + "?status=oops"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an invalid filter to be rejected, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?status=5xx", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	// The stream is subscribed once it has written its preamble.
+	buf := make([]byte, 4096)
+	n, _ := resp.Body.Read(buf)
+	if !strings.Contains(string(buf[:n]), ": connected") {
+		t.Fatalf("Unexpected preamble %q", buf[:n])
+	}
+	if resp, _ := http.Get(srv.URL); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a full hub to refuse subscribers, got %d", resp.StatusCode)
+	}
+
+	hub.WriteTraffic(ctx, redis.TrafficLog{Path: "/ok", Status: 200})
+	hub.WriteTraffic(ctx, redis.TrafficLog{Path: "/boom", Status: 503})
+
+	var got strings.Builder
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(got.String(), "\n\n") && time.Now().Before(deadline) {
+		n, err := resp.Body.Read(buf)
+		got.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	if !strings.HasPrefix(got.String(), "event: traffic\ndata: {") || !strings.Contains(got.String(), `"path":"/boom"`) {
+		t.Errorf("Expected the 5xx entry as a traffic event, got %q", got.String())
+	}
+
+	cancel()
+	for i := 0; i < 100 && hub.Stats().Subscribers > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Stats().Subscribers != 0 {
+		t.Error("Expected the subscriber to leave when the client disconnects")
+	}
+}
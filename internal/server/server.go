@@ -1,28 +1,125 @@
 package server
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/elliot/chaosProxy/internal/config"
 	"github.com/elliot/chaosProxy/internal/handlers"
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/codec"
 	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/live"
+	"github.com/elliot/chaosProxy/pkg/metrics"
 	"github.com/elliot/chaosProxy/pkg/middleware"
+	"github.com/elliot/chaosProxy/pkg/redact"
+	"github.com/elliot/chaosProxy/pkg/replay"
 )
 
 type Server struct {
 	cfg         *config.Config
 	redisClient *redis.Client
+	audit       *audit.Log
+	chaos       *middleware.ChaosMiddleware
+	experiments *chaos.Manager
+	schedules   *chaos.Scheduler
+	guard       *chaos.Guard
+	metrics     *metrics.Window
+	redactor    *redact.Redactor
+	traffic     *middleware.TrafficPublisher
+	archive     *archive.Writer // nil unless TRAFFIC_ARCHIVE_DIR is set
+	live        *live.Hub
+	replays     *replay.Manager
+	shadow      *middleware.Shadower
+	cassette    *middleware.Cassette
+	admins      map[string]string // admin token -> audit actor
 }
 
-func NewServer(cfg *config.Config, redisClient *redis.Client) *Server {
+func NewServer(cfg *config.Config, redisClient *redis.Client) (*Server, error) {
+	limits, err := cfg.ChaosLimits()
+	if err != nil {
+		return nil, err
+	}
+	if limits.Disabled {
+		log.Printf("🛡️ Chaos is disabled in production (set CHAOS_ALLOW_PRODUCTION=true to allow it)")
+	}
+	admins, err := cfg.AdminActors()
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return nil, err
+	}
+	capture, err := cfg.TrafficCapture()
+	if err != nil {
+		return nil, err
+	}
+	traffic := middleware.NewTrafficPublisher(redisClient, capture, redactor)
+	var trafficArchive *archive.Writer
+	if cfg.TrafficArchiveDir != "" {
+		if trafficArchive, err = archive.NewWriter(cfg.TrafficArchive()); err != nil {
+			return nil, fmt.Errorf("TRAFFIC_ARCHIVE_DIR: %w", err)
+		}
+		traffic.AddSink(trafficArchive)
+	}
+	liveHub := live.NewHub(cfg.TrafficLiveBuffer, cfg.TrafficLiveMaxClients)
+	traffic.AddSink(liveHub)
+	shadowCfg, err := cfg.Shadow()
+	if err != nil {
+		return nil, err
+	}
+	shadow, err := middleware.NewShadower(shadowCfg, traffic)
+	if err != nil {
+		return nil, fmt.Errorf("SHADOW_URL: %w", err)
+	}
+	cassetteCfg, err := cfg.Cassette()
+	if err != nil {
+		return nil, err
+	}
+	cassetteCfg.Redactor = redactor
+	cassettes, err := middleware.NewCassette(cassetteCfg)
+	if err != nil {
+		return nil, fmt.Errorf("CASSETTE_DIR: %w", err)
+	}
+
+	auditLog := audit.NewLog(redisClient)
+	experiments := chaos.NewManager(redisClient)
+	schedules := chaos.NewScheduler(redisClient, experiments, auditLog)
+	chaosMiddleware := middleware.NewChaosMiddleware(redisClient, cfg.SimulateRegion, cfg.ChaosDirectivesSecret)
+	chaosMiddleware.AddRuleSource(experiments)
+	chaosMiddleware.AddRuleSource(schedules)
+	chaosMiddleware.SetLimits(limits)
+	chaosMiddleware.SetPatternStore(chaos.NewPatternStore(redisClient))
+	window := metrics.NewWindow(time.Duration(cfg.SteadyStateWindow) * time.Second)
+
 	return &Server{
 		cfg:         cfg,
 		redisClient: redisClient,
-	}
+		audit:       auditLog,
+		chaos:       chaosMiddleware,
+		experiments: experiments,
+		schedules:   schedules,
+		guard:       chaos.NewGuard(experiments, redisClient, auditLog, window, cfg.WebhookURL),
+		metrics:     window,
+		redactor:    redactor,
+		traffic:     traffic,
+		archive:     trafficArchive,
+		live:        liveHub,
+		replays:     replay.NewManager(),
+		shadow:      shadow,
+		cassette:    cassettes,
+		admins:      admins,
+	}, nil
 }
 
 func (s *Server) Start() error {
@@ -42,20 +139,44 @@ func (s *Server) Start() error {
 
 	s.setupProxy(proxy, target)
 
+	// Start Settings Sync, Experiment Lifecycle Loop, Schedules and Steady-State Guards
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.chaos.Watch(ctx)
+	go s.experiments.Run(ctx)
+	go s.schedules.Run(ctx)
+	go s.guard.Run(ctx)
+	go s.audit.Watch(ctx, 5*time.Second)
+	go s.traffic.Run(ctx)
+	if s.archive != nil {
+		go s.archive.Run(ctx)
+	}
+	go s.cassette.Run(ctx)
+
+	if err := s.audit.RecordConfig(ctx, s.cfg.AuditFields()); err != nil {
+		log.Printf("Failed to audit configuration: %v", err)
+	}
+
 	// Setup Router (Mux)
 	mux := http.NewServeMux()
 
 	// Register Health Check
 	mux.HandleFunc("/healthz", handlers.HealthCheck(s.redisClient))
 	// Register Blocked IPs API
-	mux.HandleFunc("/api/blocked-ips", handlers.GetBlockedIPs(s.redisClient))
+	mux.HandleFunc("GET /api/blocked-ips", handlers.GetBlockedIPs(s.redisClient))
+	// Register Admin API
+	s.setupAdminRoutes(mux)
 
 	// Calculate Canary Proxy
 	canaryMiddleware := middleware.NewCanary(s.cfg.CanaryURL, s.cfg.CanaryWeight)
 	finalProxy := canaryMiddleware(proxy)
 
-	// Catch-all to Proxy
-	mux.Handle("/", finalProxy)
+	// Cassettes record what the upstream answered, or replace it in playback
+	finalProxy = s.cassette.Handler(finalProxy)
+
+	// Catch-all to Proxy (chaos only applies to proxied traffic, never to the admin API;
+	// the shadow copy is taken before chaos)
+	mux.Handle("/", middleware.Chain(finalProxy, s.shadow.Mirror, middleware.SteadyState(s.metrics), s.chaos.Chaos))
 
 	// Setup Middleware Chain
 	handler := s.setupMiddleware(mux)
@@ -76,17 +197,12 @@ func (s *Server) setupProxy(proxy *httputil.ReverseProxy, target *url.URL) {
 		ghost, ghostErr := s.redisClient.GetGhostResponse(r.Context(), r.Method, r.URL.Path)
 		if ghostErr == nil && ghost != nil {
 			log.Printf("👻 Ghost Mode Activated for: %s %s", r.Method, r.URL.Path)
+			middleware.TrafficMetaFrom(r.Context()).SetGhost()
 
 			// Increment Stats
 			s.redisClient.GetRawClient().Incr(r.Context(), "chaos:stats:ghost_count")
 
-			// Set Ghost Headers
-			w.Header().Set("X-Chaos-Ghost", "true")
-			// w.Header().Set("X-Chaos-Original-Status", fmt.Sprintf("%d", ghost.Status)) // Original status might be useful
-			w.Header().Set("Content-Type", "application/json") // Assuming JSON for now
-
-			w.WriteHeader(ghost.Status)
-			w.Write([]byte(ghost.ResponseBody))
+			writeGhost(w, r, ghost)
 			return
 		}
 
@@ -100,23 +216,132 @@ func (s *Server) setupProxy(proxy *httputil.ReverseProxy, target *url.URL) {
 	proxy.Director = func(req *http.Request) {
 		originalDirector(req)
 		req.Host = target.Host // Important: Set the Host header to the target's host
+		middleware.TrafficMetaFrom(req.Context()).SetUpstream(redis.RoutePrimary, target.String())
+	}
+}
+
+// ghostSkipHeaders are learned headers that do not apply to a replayed body.
+var ghostSkipHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Set-Cookie":        true,
+}
+
+// writeGhost replays a learned response, re-encoded to match the client's
+// Accept-Encoding.
+func writeGhost(w http.ResponseWriter, r *http.Request, ghost *redis.GhostResponse) {
+	body := []byte(ghost.Body)
+	if ghost.BodyBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(ghost.Body)
+		if err != nil {
+			log.Printf("💀 Ghost response for %s %s is corrupt: %v", r.Method, r.URL.Path, err)
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"error": "Service temporarily unavailable"}`))
+			return
+		}
+		body = decoded
+	}
+
+	for name, values := range ghost.Headers {
+		if !ghostSkipHeaders[http.CanonicalHeaderKey(name)] {
+			w.Header()[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("X-Chaos-Ghost", "true")
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if coding := codec.Negotiate(r.Header.Get("Accept-Encoding")); coding != codec.Identity && len(body) > 0 {
+		if encoded, err := codec.Encode(body, coding); err == nil {
+			body = encoded
+			w.Header().Set("Content-Encoding", coding)
+		}
+	}
+
+	status := ghost.Status
+	if status == 0 {
+		status = http.StatusOK
 	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func (s *Server) setupAdminRoutes(mux *http.ServeMux) {
+	admin := handlers.AdminAuth(s.admins)
+	// Captured traffic and requests sent to other hosts stay closed without a token.
+	restricted := handlers.RequireAdminAuth(s.admins)
+	if len(s.admins) == 0 {
+		log.Printf("⚠️ ADMIN_TOKEN is not set. Admin API is unauthenticated; traffic stream, HAR and replay endpoints are disabled.")
+	}
+
+	// Chaos Settings
+	mux.HandleFunc("GET /api/chaos/settings", admin(handlers.GetChaosSettings(s.chaos)))
+	mux.HandleFunc("PUT /api/chaos/settings", admin(handlers.UpdateChaosSettings(s.redisClient, s.audit)))
+	mux.HandleFunc("POST /api/chaos/kill", admin(handlers.EngageKillSwitch(s.redisClient, s.experiments, s.audit)))
+	mux.HandleFunc("DELETE /api/chaos/kill", admin(handlers.ReleaseKillSwitch(s.redisClient, s.audit)))
+
+	// Blocklist
+	mux.HandleFunc("POST /api/blocked-ips", admin(handlers.BlockIP(s.redisClient, s.audit)))
+	mux.HandleFunc("DELETE /api/blocked-ips/{ip}", admin(handlers.UnblockIP(s.redisClient, s.audit)))
+
+	// Experiments
+	mux.HandleFunc("GET /api/experiments", admin(handlers.ListExperiments(s.experiments)))
+	mux.HandleFunc("POST /api/experiments", admin(handlers.CreateExperiment(s.experiments, s.audit)))
+	mux.HandleFunc("GET /api/experiments/{id}", admin(handlers.GetExperiment(s.experiments)))
+	mux.HandleFunc("POST /api/experiments/{id}/{action}", admin(handlers.ExperimentAction(s.experiments, s.audit)))
+
+	// Schedules
+	mux.HandleFunc("GET /api/schedules", admin(handlers.ListSchedules(s.schedules)))
+	mux.HandleFunc("POST /api/schedules", admin(handlers.SaveSchedule(s.schedules, s.audit)))
+	mux.HandleFunc("GET /api/schedules/dry-run", admin(handlers.DryRunSchedules(s.schedules)))
+	mux.HandleFunc("DELETE /api/schedules/{id}", admin(handlers.DeleteSchedule(s.schedules, s.audit)))
+
+	// Audit Log
+	mux.HandleFunc("GET /api/audit", admin(handlers.ListAudit(s.audit)))
+
+	// Steady-State Metrics
+	mux.HandleFunc("GET /api/metrics", admin(handlers.GetMetrics(s.metrics)))
+
+	// PII Detection
+	mux.HandleFunc("GET /api/pii/stats", admin(handlers.GetPIIStats(s.redactor)))
+
+	// Traffic Log Publishing and HAR Import/Export
+	mux.HandleFunc("GET /api/traffic/stats", admin(handlers.GetTrafficStats(s.traffic)))
+	mux.HandleFunc("GET /api/traffic/stream", restricted(handlers.StreamTraffic(s.live)))
+	mux.HandleFunc("GET /api/traffic/stream/stats", admin(handlers.GetTrafficStreamStats(s.live)))
+	mux.HandleFunc("GET /api/traffic/har", restricted(handlers.ExportHAR(s.redisClient, s.cfg.TargetURL)))
+	mux.HandleFunc("POST /api/traffic/har", restricted(handlers.ImportHAR(s.redisClient, s.traffic, s.audit)))
+
+	// Traffic Replay
+	mux.HandleFunc("GET /api/replays", admin(handlers.ListReplays(s.replays)))
+	mux.HandleFunc("POST /api/replays", restricted(handlers.StartReplay(s.redisClient, s.replays, s.cfg.TrafficArchiveDir, s.audit)))
+	mux.HandleFunc("GET /api/replays/{id}", admin(handlers.GetReplay(s.replays)))
+	mux.HandleFunc("DELETE /api/replays/{id}", admin(handlers.CancelReplay(s.replays, s.audit)))
+
+	// Shadow Mirroring
+	mux.HandleFunc("GET /api/shadow/stats", admin(handlers.GetShadowStats(s.shadow)))
+	mux.HandleFunc("GET /api/shadow/diff", admin(handlers.GetShadowDiff(s.shadow)))
+
+	// Cassettes
+	mux.HandleFunc("GET /api/cassettes/stats", admin(handlers.GetCassetteStats(s.cassette)))
 }
 
 func (s *Server) setupMiddleware(handler http.Handler) http.Handler {
-	// Order: Recovery -> RateLimit -> IPFilter -> Chaos -> Logger -> TrafficLogger -> Mux
+	// Order: Recovery -> RateLimit -> IPFilter -> Logger -> TrafficLogger -> Mux (Chaos wraps the proxy route)
 	rateLimiter := middleware.NewRateLimiter(100, time.Minute) // 100 requests per minute per IP
-	chaosMiddleware := middleware.NewChaosMiddleware(s.redisClient, s.cfg.SimulateRegion)
-	trafficMiddleware := middleware.TrafficLogger(s.redisClient)
 
 	return middleware.Chain(
 		handler,
 		middleware.RequestID,
 		middleware.PoweredBy,
-		trafficMiddleware,
+		s.traffic.TrafficLogger,
 		middleware.Logger,
 		middleware.SecurityFuzzer(s.cfg.SecurityFuzzingEnabled),
-		chaosMiddleware.Chaos,
 		middleware.IPFilter(s.redisClient),
 		middleware.RateLimit(rateLimiter),
 		middleware.Recovery,
@@ -0,0 +1,119 @@
+// Package admin is a client for Sentinel's admin API, used by chaosctl.
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/har"
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+// Client talks to a running Sentinel's admin API.
+type Client struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// StartExperiment creates the experiment and starts it immediately.
+func (c *Client) StartExperiment(ctx context.Context, e *chaos.Experiment) (*chaos.Experiment, error) {
+	var created chaos.Experiment
+	if err := c.do(ctx, http.MethodPost, "/api/experiments", e, &created); err != nil {
+		return nil, err
+	}
+
+	var started chaos.Experiment
+	if err := c.do(ctx, http.MethodPost, "/api/experiments/"+created.ID+"/start", nil, &started); err != nil {
+		return nil, err
+	}
+	return &started, nil
+}
+
+func (c *Client) AbortExperiment(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/experiments/"+id+"/abort", nil, nil)
+}
+
+func (c *Client) Metrics(ctx context.Context) (metrics.Snapshot, error) {
+	var s metrics.Snapshot
+	err := c.do(ctx, http.MethodGet, "/api/metrics", nil, &s)
+	return s, err
+}
+
+// SetKillSwitch engages or releases the kill switch on every Sentinel.
+func (c *Client) SetKillSwitch(ctx context.Context, engaged bool) error {
+	method := http.MethodPost
+	if !engaged {
+		method = http.MethodDelete
+	}
+	return c.do(ctx, method, "/api/chaos/kill", nil, nil)
+}
+
+// ExportHAR downloads the traffic selected by params as HAR.
+func (c *Client) ExportHAR(ctx context.Context, params url.Values) (*har.HAR, error) {
+	var h har.HAR
+	err := c.do(ctx, http.MethodGet, "/api/traffic/har?"+params.Encode(), nil, &h)
+	return &h, err
+}
+
+// ImportHAR uploads a HAR file as traffic and ghost responses.
+func (c *Client) ImportHAR(ctx context.Context, h *har.HAR, params url.Values) (har.ImportResult, error) {
+	var result har.ImportResult
+	err := c.do(ctx, http.MethodPost, "/api/traffic/har?"+params.Encode(), h, &result)
+	return result, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, apiErr.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,274 @@
+// Package archive keeps traffic on local disk as gzip-compressed JSONL
+// segments, rotated by size and age and pruned after a retention period, so
+// days of traffic can be replayed and analysed without growing Redis.
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+const (
+	segmentPrefix = "traffic-"
+	segmentExt    = ".jsonl.gz"
+	activeExt     = ".part" // appended while a segment is being written
+	timeLayout    = "20060102T150405.000Z"
+
+	// flushInterval bounds how long written entries stay buffered before
+	// queries can read them from the active segment.
+	flushInterval = time.Second
+)
+
+// Options configures a Writer.
+type Options struct {
+	Dir       string
+	MaxSize   int64         // compressed bytes per segment, 0 = 100MB
+	MaxAge    time.Duration // time per segment, 0 = 1h
+	Retention time.Duration // finished segments are deleted after this, 0 = keep
+}
+
+// Writer appends traffic entries to the active segment. It is safe for
+// concurrent use.
+type Writer struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	gz      *gzip.Writer
+	size    int64
+	started time.Time
+	dirty   bool // entries written since the last flush
+}
+
+// NewWriter creates the archive directory, finishes segments left active by
+// a previous run and applies retention.
+func NewWriter(opts Options) (*Writer, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("archive directory is required")
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 100 << 20
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = time.Hour
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	w := &Writer{opts: opts, now: time.Now}
+	segments, err := Segments(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range segments {
+		if s.Active {
+			// Flushed up to the last entry; readers tolerate the missing trailer.
+			os.Rename(s.Path, strings.TrimSuffix(s.Path, activeExt))
+		}
+	}
+	w.prune()
+	return w, nil
+}
+
+// WriteTraffic appends an entry, rotating the segment first if it is full
+// or too old.
+func (w *Writer) WriteTraffic(ctx context.Context, entry redis.TrafficLog) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil && (w.size >= w.opts.MaxSize || w.now().Sub(w.started) >= w.opts.MaxAge) {
+		if err := w.closeSegment(); err != nil {
+			return err
+		}
+		w.prune()
+	}
+	if w.file == nil {
+		if err := w.openSegment(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.gz.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	w.dirty = true
+	return nil
+}
+
+// Flush makes the entries written so far readable by queries of the active
+// segment. Run flushes every second.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.gz == nil || !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.gz.Flush()
+}
+
+// Run flushes the active segment every second, and rotates idle segments
+// and applies retention every minute until ctx is done, then closes the
+// active segment.
+func (w *Writer) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := w.Close(); err != nil {
+				log.Printf("Failed to close traffic archive: %v", err)
+			}
+			return
+		case <-flush.C:
+			if err := w.Flush(); err != nil {
+				log.Printf("Failed to flush traffic archive: %v", err)
+			}
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.file != nil && w.now().Sub(w.started) >= w.opts.MaxAge {
+				if err := w.closeSegment(); err != nil {
+					log.Printf("Failed to rotate traffic archive: %v", err)
+				}
+			}
+			w.prune()
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Close finishes the active segment.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.closeSegment()
+}
+
+func (w *Writer) openSegment() error {
+	w.started = w.now().UTC().Truncate(time.Millisecond)
+	var f *os.File
+	for {
+		path := filepath.Join(w.opts.Dir, segmentPrefix+w.started.Format(timeLayout)+segmentExt)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if f, err = os.OpenFile(path+activeExt, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644); err == nil {
+				break
+			}
+			if !os.IsExist(err) {
+				return err
+			}
+		}
+		// Segments rotated within the same millisecond.
+		w.started = w.started.Add(time.Millisecond)
+	}
+	w.file = f
+	w.gz = gzip.NewWriter(countWriter{f, &w.size})
+	w.size = 0
+	return nil
+}
+
+func (w *Writer) closeSegment() error {
+	path := w.file.Name()
+	err := w.gz.Close()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file, w.gz, w.dirty = nil, nil, false
+	if err != nil {
+		return err
+	}
+	return os.Rename(path, strings.TrimSuffix(path, activeExt))
+}
+
+// prune deletes finished segments last written before the retention period.
+func (w *Writer) prune() {
+	if w.opts.Retention <= 0 {
+		return
+	}
+	segments, err := Segments(w.opts.Dir)
+	if err != nil {
+		log.Printf("Failed to list traffic archive: %v", err)
+		return
+	}
+	cutoff := w.now().Add(-w.opts.Retention)
+	for _, s := range segments {
+		if s.Active {
+			continue
+		}
+		if info, err := os.Stat(s.Path); err == nil && info.ModTime().Before(cutoff) {
+			if err := os.Remove(s.Path); err != nil {
+				log.Printf("Failed to delete archive segment %s: %v", s.Path, err)
+			}
+		}
+	}
+}
+
+// countWriter counts the compressed bytes written to a segment.
+type countWriter struct {
+	f *os.File
+	n *int64
+}
+
+func (c countWriter) Write(b []byte) (int, error) {
+	n, err := c.f.Write(b)
+	*c.n += int64(n)
+	return n, err
+}
+
+// Segment is one archive file.
+type Segment struct {
+	Path   string
+	Start  time.Time
+	Active bool // still being written
+}
+
+// Segments lists the archive segments in dir, oldest first.
+func Segments(dir string) ([]Segment, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, segmentPrefix) {
+			continue
+		}
+		stamp, active := strings.CutSuffix(name, activeExt)
+		stamp, ok := strings.CutSuffix(strings.TrimPrefix(stamp, segmentPrefix), segmentExt)
+		if !ok {
+			continue
+		}
+		start, err := time.Parse(timeLayout, stamp)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, Segment{Path: filepath.Join(dir, name), Start: start, Active: active})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Start.Before(segments[j].Start) })
+	return segments, nil
+}
@@ -0,0 +1,213 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// clock is a settable time source for the writer.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestWriter(t *testing.T, opts Options) (*Writer, *clock) {
+	t.Helper()
+	opts.Dir = t.TempDir()
+	w, err := NewWriter(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &clock{t: time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)}
+	w.now = c.now
+	return w, c
+}
+
+func entry(ts time.Time, path string, status int) redis.TrafficLog {
+	return redis.TrafficLog{Version: redis.TrafficLogVersion, Timestamp: ts, Method: "GET", Path: path, Status: status, RequestID: path}
+}
+
+func collect(t *testing.T, dir string, q Query) []string {
+	t.Helper()
+	var paths []string
+	if err := Scan(dir, q, func(e redis.TrafficLog) bool {
+		paths = append(paths, e.Path)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestWriter_RotatesByAge(t *testing.T) {
+	w, c := newTestWriter(t, Options{MaxAge: time.Hour})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		w.WriteTraffic(ctx, entry(c.t, fmt.Sprintf("/%d", i), 200))
+		c.t = c.t.Add(40 * time.Minute)
+	}
+
+	segments, _ := Segments(w.opts.Dir)
+	if len(segments) != 2 || segments[0].Active || !segments[1].Active {
+		t.Fatalf("Expected a finished and an active segment, got %+v", segments)
+	}
+	// The active segment is readable once flushed, before it is closed.
+	w.Flush()
+	if got := collect(t, w.opts.Dir, Query{}); len(got) != 3 {
+		t.Errorf("Expected 3 entries, got %v", got)
+	}
+
+	w.Close()
+	if segments, _ := Segments(w.opts.Dir); segments[1].Active {
+		t.Error("Expected Close to finish the active segment")
+	}
+}
+
+func TestWriter_RotatesBySize(t *testing.T) {
+	w, c := newTestWriter(t, Options{MaxSize: 1})
+	for i := 0; i < 3; i++ {
+		w.WriteTraffic(context.Background(), entry(c.t, "/", 200))
+	}
+	w.Close()
+
+	if segments, _ := Segments(w.opts.Dir); len(segments) != 3 {
+		t.Errorf("Expected a segment per entry, got %d", len(segments))
+	}
+}
+
+func TestWriter_Retention(t *testing.T) {
+	w, c := newTestWriter(t, Options{MaxAge: time.Hour, Retention: 24 * time.Hour})
+	ctx := context.Background()
+
+	w.WriteTraffic(ctx, entry(c.t, "/old", 200))
+	w.Close()
+	segments, _ := Segments(w.opts.Dir)
+	old := c.t.Add(-48 * time.Hour)
+	os.Chtimes(segments[0].Path, old, old)
+
+	c.t = c.t.Add(2 * time.Hour)
+	w.WriteTraffic(ctx, entry(c.t, "/new", 200))
+	w.Flush()
+	w.prune()
+
+	if got := collect(t, w.opts.Dir, Query{}); len(got) != 1 || got[0] != "/new" {
+		t.Errorf("Expected the expired segment to be deleted, got %v", got)
+	}
+}
+
+func TestNewWriter_FinishesActiveSegments(t *testing.T) {
+	w, c := newTestWriter(t, Options{})
+	w.WriteTraffic(context.Background(), entry(c.t, "/crash", 200))
+	w.Flush()
+	// Simulate a crash: the segment is never closed.
+
+	if _, err := NewWriter(Options{Dir: w.opts.Dir}); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ := Segments(w.opts.Dir)
+	if len(segments) != 1 || segments[0].Active {
+		t.Fatalf("Expected the segment to be finished, got %+v", segments)
+	}
+	if got := collect(t, w.opts.Dir, Query{}); len(got) != 1 {
+		t.Errorf("Expected the flushed entry to be readable, got %v", got)
+	}
+}
+
+func TestScan_Query(t *testing.T) {
+	w, c := newTestWriter(t, Options{MaxAge: time.Hour})
+	ctx := context.Background()
+	start := c.t
+
+	for i, status := range []int{200, 404, 500, 503} {
+		e := entry(c.t, fmt.Sprintf("/api/%d", i), status)
+		if i == 3 {
+			e.Route = redis.RouteCanary
+		}
+		w.WriteTraffic(ctx, e)
+		c.t = c.t.Add(time.Hour)
+	}
+	w.Close()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"all", Query{}, 4},
+		{"since", Query{Since: start.Add(90 * time.Minute)}, 2},
+		{"until", Query{Until: start.Add(time.Hour)}, 1},
+		{"5xx", Query{StatusMin: 500, StatusMax: 599}, 2},
+		{"route", Query{Route: redis.RoutePrimary}, 3},
+		{"path", Query{Path: "/api/1"}, 1},
+		{"request id", Query{RequestID: "/api/2"}, 1},
+	}
+	for _, tt := range tests {
+		if got := collect(t, w.opts.Dir, tt.query); len(got) != tt.want {
+			t.Errorf("%s: expected %d entries, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	n := 0
+	Scan(w.opts.Dir, Query{}, func(redis.TrafficLog) bool { n++; return false })
+	if n != 1 {
+		t.Errorf("Expected the scan to stop, got %d entries", n)
+	}
+}
+
+func TestScan_TruncatedSegment(t *testing.T) {
+	w, c := newTestWriter(t, Options{})
+	for i := 0; i < 2; i++ {
+		w.WriteTraffic(context.Background(), entry(c.t, "/", 200))
+	}
+	w.Close()
+
+	segments, _ := Segments(w.opts.Dir)
+	info, _ := os.Stat(segments[0].Path)
+	os.Truncate(segments[0].Path, info.Size()-10)
+
+	if got := collect(t, w.opts.Dir, Query{}); len(got) != 2 {
+		t.Errorf("Expected entries before the damage, got %v", got)
+	}
+	os.WriteFile(filepath.Join(w.opts.Dir, "notes.txt"), []byte("ignored"), 0o644)
+	if segments, _ := Segments(w.opts.Dir); len(segments) != 1 {
+		t.Errorf("Expected other files to be ignored, got %d segments", len(segments))
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := map[string][2]int{"404": {404, 404}, "5xx": {500, 599}, "400-499": {400, 499}}
+	for spec, want := range tests {
+		min, max, err := ParseStatus(spec)
+		if err != nil || min != want[0] || max != want[1] {
+			t.Errorf("ParseStatus(%q) = %d, %d, %v", spec, min, max, err)
+		}
+	}
+	for _, spec := range []string{"", "6xx", "500-400", "ok"} {
+		if _, _, err := ParseStatus(spec); err == nil {
+			t.Errorf("Expected %q to fail", spec)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(url.Values{"since": {"1h"}, "status": {"5xx"}, "path": {"/api"}, "request_id": {"abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(q.Since) < 59*time.Minute || q.StatusMin != 500 || q.Path != "/api" || q.RequestID != "abc" {
+		t.Errorf("Unexpected query: %+v", q)
+	}
+
+	for _, v := range []url.Values{{"since": {"yesterday"}}, {"until": {"2025-13-01"}}, {"status": {"teapot"}}} {
+		if _, err := ParseQuery(v); err == nil {
+			t.Errorf("Expected %v to fail", v)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// Query selects archived entries. Zero fields match everything.
+type Query struct {
+	Since     time.Time
+	Until     time.Time
+	Path      string // path prefix
+	Route     string // primary, canary or shadow
+	StatusMin int
+	StatusMax int
+	RequestID string
+}
+
+// Match reports whether entry is selected by q.
+func (q Query) Match(entry redis.TrafficLog) bool {
+	route := entry.Route
+	if route == "" {
+		route = redis.RoutePrimary // version 1 entries
+	}
+	switch {
+	case !q.Since.IsZero() && entry.Timestamp.Before(q.Since),
+		!q.Until.IsZero() && !entry.Timestamp.Before(q.Until),
+		q.Path != "" && !strings.HasPrefix(entry.Path, q.Path),
+		q.Route != "" && route != q.Route,
+		q.StatusMin > 0 && entry.Status < q.StatusMin,
+		q.StatusMax > 0 && entry.Status > q.StatusMax,
+		q.RequestID != "" && entry.RequestID != q.RequestID:
+		return false
+	}
+	return true
+}
+
+// ParseStatus parses a status filter: "404", "5xx" or "400-499".
+func ParseStatus(spec string) (min, max int, err error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if class, ok := strings.CutSuffix(spec, "xx"); ok {
+		n, err := strconv.Atoi(class)
+		if err != nil || n < 1 || n > 5 {
+			return 0, 0, fmt.Errorf("invalid status class %q", spec)
+		}
+		return n * 100, n*100 + 99, nil
+	}
+	if lo, hi, ok := strings.Cut(spec, "-"); ok {
+		min, err1 := strconv.Atoi(lo)
+		max, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || min > max {
+			return 0, 0, fmt.Errorf("invalid status range %q", spec)
+		}
+		return min, max, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid status %q", spec)
+	}
+	return n, n, nil
+}
+
+// errStop ends a scan early.
+var errStop = errors.New("stop")
+
+// Scan calls fn with every archived entry in dir matching q, oldest segment
+// first, until fn returns false. Segments that end before q.Since are
+// skipped, and segments cut short by a crash are read up to the damage.
+func Scan(dir string, q Query, fn func(redis.TrafficLog) bool) error {
+	segments, err := Segments(dir)
+	if err != nil {
+		return err
+	}
+
+	for i, s := range segments {
+		// Entries are written before the next segment starts.
+		if !q.Since.IsZero() && i+1 < len(segments) && !segments[i+1].Start.After(q.Since) {
+			continue
+		}
+		err := scanSegment(s.Path, func(entry redis.TrafficLog) error {
+			if q.Match(entry) && !fn(entry) {
+				return errStop
+			}
+			return nil
+		})
+		if err == errStop {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Path, err)
+		}
+	}
+	return nil
+}
+
+// ScanFile calls fn with every entry of a single JSONL file matching q,
+// such as a segment or the output of archive query, until fn returns false.
+// Files ending in .gz are decompressed.
+func ScanFile(path string, q Query, fn func(redis.TrafficLog) bool) error {
+	err := scanSegment(path, func(entry redis.TrafficLog) error {
+		if q.Match(entry) && !fn(entry) {
+			return errStop
+		}
+		return nil
+	})
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+func scanSegment(path string, fn func(redis.TrafficLog) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+	if strings.HasSuffix(strings.TrimSuffix(path, activeExt), ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err == io.EOF {
+			return nil // created but never written
+		}
+		if err != nil {
+			return err
+		}
+		src = gz
+	}
+	r := bufio.NewReader(src)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 && err == nil {
+			var entry redis.TrafficLog
+			if jerr := json.Unmarshal(line, &entry); jerr == nil {
+				if ferr := fn(entry); ferr != nil {
+					return ferr
+				}
+			}
+		}
+		switch {
+		case err == io.EOF, errors.Is(err, io.ErrUnexpectedEOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// ParseTime parses an RFC 3339 time or a duration before now, e.g. "2h".
+// An empty value is the zero time.
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or a duration such as 2h", value)
+	}
+	return t, nil
+}
+
+// ParseQuery reads a query from URL parameters: since, until, path, route,
+// status and request_id.
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{Path: v.Get("path"), Route: v.Get("route"), RequestID: v.Get("request_id")}
+	var err error
+	if q.Since, err = ParseTime(v.Get("since")); err != nil {
+		return Query{}, err
+	}
+	if q.Until, err = ParseTime(v.Get("until")); err != nil {
+		return Query{}, err
+	}
+	if status := v.Get("status"); status != "" {
+		if q.StatusMin, q.StatusMax, err = ParseStatus(status); err != nil {
+			return Query{}, err
+		}
+	}
+	return q, nil
+}
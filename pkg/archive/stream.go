@@ -0,0 +1,37 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// streamPage is the number of stream entries read per round trip.
+const streamPage = 500
+
+// ScanStream calls fn with every entry of the Redis traffic stream matching
+// q, oldest first, until fn returns false.
+func ScanStream(ctx context.Context, client *redis.Client, q Query, fn func(redis.TrafficLog) bool) error {
+	// Stream IDs are publish times, never earlier than the entry timestamp.
+	start := "-"
+	if !q.Since.IsZero() {
+		start = fmt.Sprintf("%d-0", q.Since.UnixMilli())
+	}
+
+	for {
+		messages, err := client.TrafficRange(ctx, start, "+", streamPage)
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			if q.Match(m.Entry) && !fn(m.Entry) {
+				return nil
+			}
+		}
+		if len(messages) < streamPage {
+			return nil
+		}
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+const (
+	streamKey = "chaos:audit"
+	// maxEntries caps the stream; older entries are trimmed approximately.
+	maxEntries = 10000
+)
+
+// Sources of audit entries.
+const (
+	SourceAdminAPI  = "admin-api"
+	SourceRedis     = "redis" // out-of-band change made directly in Redis
+	SourceGuard     = "guard"
+	SourceScheduler = "scheduler"
+	SourceSentinel  = "sentinel"
+)
+
+// Change is the before/after value of a single field.
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Entry is one audit record.
+type Entry struct {
+	ID        string            `json:"id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Actor     string            `json:"actor"`
+	Source    string            `json:"source"`
+	Client    string            `json:"client,omitempty"`
+	Action    string            `json:"action"`
+	Target    string            `json:"target,omitempty"`
+	Diff      map[string]Change `json:"diff,omitempty"`
+}
+
+// Log is an append-only audit trail stored in a Redis Stream.
+type Log struct {
+	redisClient *redis.Client
+	resources   map[string]func(ctx context.Context) (map[string]string, error)
+}
+
+func NewLog(redisClient *redis.Client) *Log {
+	l := &Log{redisClient: redisClient}
+	l.resources = map[string]func(ctx context.Context) (map[string]string, error){
+		ResourceSettings:  l.readSettings,
+		ResourceBlocklist: l.readBlocklist,
+	}
+	return l
+}
+
+// Record appends an entry to the stream.
+func (l *Log) Record(ctx context.Context, e Entry) error {
+	return l.redisClient.GetRawClient().XAdd(ctx, l.xaddArgs(e)).Err()
+}
+
+func (l *Log) xaddArgs(e Entry) *goredis.XAddArgs {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	diff, _ := json.Marshal(e.Diff)
+
+	return &goredis.XAddArgs{
+		Stream: streamKey,
+		MaxLen: maxEntries,
+		Approx: true,
+		Values: map[string]interface{}{
+			"timestamp": e.Timestamp.Format(time.RFC3339Nano),
+			"actor":     e.Actor,
+			"source":    e.Source,
+			"client":    e.Client,
+			"action":    e.Action,
+			"target":    e.Target,
+			"diff":      string(diff),
+		},
+	}
+}
+
+// Query filters entries. Zero values match everything.
+type Query struct {
+	Since  time.Time
+	Until  time.Time
+	Actor  string
+	Source string
+	Action string
+	Limit  int
+}
+
+// List returns matching entries, newest first.
+func (l *Log) List(ctx context.Context, q Query) ([]Entry, error) {
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+
+	start, end := "-", "+"
+	if !q.Since.IsZero() {
+		start = strconv.FormatInt(q.Since.UnixMilli(), 10)
+	}
+	if !q.Until.IsZero() {
+		end = strconv.FormatInt(q.Until.UnixMilli(), 10)
+	}
+
+	var entries []Entry
+	for end != "" && len(entries) < q.Limit {
+		batch, err := l.redisClient.GetRawClient().XRevRangeN(ctx, streamKey, end, start, 200).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, msg := range batch {
+			e := parseEntry(msg)
+			if matches(e, q) {
+				entries = append(entries, e)
+				if len(entries) == q.Limit {
+					break
+				}
+			}
+		}
+
+		if len(batch) < 200 {
+			break
+		}
+		end = "(" + batch[len(batch)-1].ID
+	}
+	return entries, nil
+}
+
+func matches(e Entry, q Query) bool {
+	return (q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Source == "" || e.Source == q.Source) &&
+		(q.Action == "" || e.Action == q.Action)
+}
+
+func parseEntry(msg goredis.XMessage) Entry {
+	str := func(key string) string {
+		v, _ := msg.Values[key].(string)
+		return v
+	}
+
+	e := Entry{
+		ID:     msg.ID,
+		Actor:  str("actor"),
+		Source: str("source"),
+		Client: str("client"),
+		Action: str("action"),
+		Target: str("target"),
+	}
+	e.Timestamp, _ = time.Parse(time.RFC3339Nano, str("timestamp"))
+	if diff := str("diff"); diff != "" && diff != "null" {
+		if err := json.Unmarshal([]byte(diff), &e.Diff); err != nil {
+			e.Diff = map[string]Change{"raw": {To: fmt.Sprint(diff)}}
+		}
+	}
+	return e
+}
+
+// Diff returns the fields that differ between before and after.
+func Diff(before, after map[string]string) map[string]Change {
+	diff := make(map[string]Change)
+	for k, v := range after {
+		if old, ok := before[k]; !ok {
+			diff[k] = Change{From: nil, To: v}
+		} else if old != v {
+			diff[k] = Change{From: old, To: v}
+		}
+	}
+	for k, v := range before {
+		if _, ok := after[k]; !ok {
+			diff[k] = Change{From: v, To: nil}
+		}
+	}
+	return diff
+}
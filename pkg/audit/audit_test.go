@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before := map[string]string{"failure_enabled": "false", "failure_rate": "10", "latency_min": "100"}
+	after := map[string]string{"failure_enabled": "true", "failure_rate": "10", "latency_max": "900"}
+
+	diff := Diff(before, after)
+
+	if len(diff) != 3 {
+		t.Fatalf("Expected 3 changes, got %d: %v", len(diff), diff)
+	}
+	if c := diff["failure_enabled"]; c.From != "false" || c.To != "true" {
+		t.Errorf("Unexpected change for failure_enabled: %+v", c)
+	}
+	if c := diff["latency_min"]; c.From != "100" || c.To != nil {
+		t.Errorf("Expected latency_min removal, got %+v", c)
+	}
+	if c := diff["latency_max"]; c.From != nil || c.To != "900" {
+		t.Errorf("Expected latency_max addition, got %+v", c)
+	}
+	if _, ok := diff["failure_rate"]; ok {
+		t.Error("Unchanged field should not be in the diff")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	e := Entry{Actor: "alice", Source: SourceAdminAPI, Action: "blocklist.add"}
+
+	if !matches(e, Query{}) {
+		t.Error("Empty query should match everything")
+	}
+	if !matches(e, Query{Actor: "alice", Action: "blocklist.add"}) {
+		t.Error("Expected actor and action to match")
+	}
+	if matches(e, Query{Source: SourceRedis}) {
+		t.Error("Source mismatch should not match")
+	}
+}
@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// Resources whose changes are tracked for out-of-band edits.
+const (
+	ResourceSettings  = "chaos.settings"
+	ResourceBlocklist = "blocklist"
+	ResourceConfig    = "config"
+)
+
+// knownKeyPrefix stores the last audited state of each resource.
+const knownKeyPrefix = "chaos:audit:known:"
+
+// applyingKeyPrefix counts the audited changes being applied to each
+// resource. Out-of-band detection skips a resource while one is in flight.
+const applyingKeyPrefix = "chaos:audit:applying:"
+
+// applyingTTL releases the marker of a change whose Sentinel died mid-way.
+const applyingTTL = 30 * time.Second
+
+// releaseScript withdraws one in-flight change, never leaving a negative
+// count behind after the marker expired.
+var releaseScript = goredis.NewScript(`
+local n = redis.call('DECR', KEYS[1])
+if n <= 0 then redis.call('DEL', KEYS[1]) end
+return n`)
+
+func (l *Log) readSettings(ctx context.Context) (map[string]string, error) {
+	settings, err := l.redisClient.GetRawClient().HGetAll(ctx, "chaos:settings").Result()
+	if err != nil {
+		return nil, err
+	}
+	delete(settings, "version") // bumped on every write, not a setting itself
+	return settings, nil
+}
+
+func (l *Log) readBlocklist(ctx context.Context) (map[string]string, error) {
+	ips, err := l.redisClient.GetRawClient().SMembers(ctx, "chaos:settings:blocked_ips").Result()
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[string]string, len(ips))
+	for _, ip := range ips {
+		state[ip] = "blocked"
+	}
+	return state, nil
+}
+
+// Change applies a change to a tracked resource and records it with the
+// resulting diff. The change is announced before it is applied, and the new
+// state acknowledged before the announcement is withdrawn, so Watch never
+// reports it as an out-of-band change.
+func (l *Log) Change(ctx context.Context, resource string, e Entry, apply func() error) error {
+	read := l.resources[resource]
+	before, err := read(ctx)
+	if err != nil {
+		return err
+	}
+
+	rdb := l.redisClient.GetRawClient()
+	applying := applyingKeyPrefix + resource
+	pipe := rdb.TxPipeline()
+	pipe.Incr(ctx, applying)
+	pipe.PExpire(ctx, applying, applyingTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	// A detached context, so the marker is withdrawn even if ctx is done.
+	defer releaseScript.Run(context.WithoutCancel(ctx), rdb, []string{applying})
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	after, err := read(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.Diff = Diff(before, after)
+	if e.Target == "" {
+		e.Target = resource
+	}
+	if err := l.Record(ctx, e); err != nil {
+		return err
+	}
+	return l.acknowledge(ctx, resource, after)
+}
+
+func (l *Log) acknowledge(ctx context.Context, resource string, state map[string]string) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return l.redisClient.GetRawClient().Set(ctx, knownKeyPrefix+resource, data, 0).Err()
+}
+
+// Watch checks tracked resources for out-of-band changes (edits made
+// directly in Redis, e.g. by the dashboard or redis-cli) every interval.
+func (l *Log) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for resource, read := range l.resources {
+			state, err := read(ctx)
+			if err != nil {
+				continue
+			}
+			if err := l.detect(ctx, resource, state, Entry{Actor: "unknown", Source: SourceRedis, Action: resource + ".out_of_band"}); err != nil {
+				log.Printf("Failed to check %s for out-of-band changes: %v", resource, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecordConfig audits changes of Sentinel's configuration between restarts.
+func (l *Log) RecordConfig(ctx context.Context, config map[string]string) error {
+	return l.detect(ctx, ResourceConfig, config, Entry{Actor: "sentinel", Source: SourceSentinel, Action: "config.change"})
+}
+
+// detect compares state with the last known state of resource and records
+// e if they differ. The check-and-record is a transaction on the known key,
+// so only one Sentinel instance reports a given change.
+func (l *Log) detect(ctx context.Context, resource string, state map[string]string, e Entry) error {
+	key := knownKeyPrefix + resource
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	applying := applyingKeyPrefix + resource
+	txf := func(tx *goredis.Tx) error {
+		// An audited change is in flight; it acknowledges its own state.
+		if n, err := tx.Get(ctx, applying).Int(); err == nil && n > 0 {
+			return nil
+		}
+
+		raw, err := tx.Get(ctx, key).Result()
+		if err != nil && !redis.IsNil(err) {
+			return err
+		}
+
+		var diff map[string]Change
+		if err == nil {
+			var known map[string]string
+			if err := json.Unmarshal([]byte(raw), &known); err != nil {
+				return err
+			}
+			if diff = Diff(known, state); len(diff) == 0 {
+				return nil
+			}
+		}
+		// A missing known state is the first run: record a baseline silently.
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			if diff != nil {
+				e.Target = resource
+				e.Diff = diff
+				pipe.XAdd(ctx, l.xaddArgs(e))
+			}
+			return nil
+		})
+		if err == nil && diff != nil {
+			log.Printf("📝 AUDIT: %s changed (%s by %s)", resource, e.Source, e.Actor)
+		}
+		return err
+	}
+
+	err = l.redisClient.GetRawClient().Watch(ctx, txf, key, applying)
+	if errors.Is(err, goredis.TxFailedErr) {
+		return nil // another instance recorded it first
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+// Package cassette records proxied exchanges to files on disk and plays them
+// back, so tests can run against a hermetic copy of a real backend.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/codec"
+)
+
+// Modes Sentinel runs cassettes in.
+const (
+	ModeOff      = "off"
+	ModeRecord   = "record"   // forward requests and write every exchange
+	ModePlayback = "playback" // answer only from cassettes
+)
+
+// Request fields a Matcher can compare.
+const (
+	MatchMethod = "method"
+	MatchPath   = "path"
+	MatchQuery  = "query"
+	MatchBody   = "body"
+)
+
+// DefaultMatch is the field list used when none is configured.
+var DefaultMatch = []string{MatchMethod, MatchPath, MatchQuery, MatchBody}
+
+// Matcher selects the request fields that identify an exchange. Two
+// requests with the same key are the same exchange.
+type Matcher struct {
+	Method  bool     `json:"method"`
+	Path    bool     `json:"path"`
+	Query   bool     `json:"query"` // parameter order is ignored
+	Body    bool     `json:"body"`  // JSON key order and whitespace are ignored
+	Headers []string `json:"headers,omitempty"`
+}
+
+// ParseMatcher builds a Matcher from field names such as "method,path" and
+// header names.
+func ParseMatcher(fields, headers []string) (Matcher, error) {
+	var m Matcher
+	for _, f := range fields {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case MatchMethod:
+			m.Method = true
+		case MatchPath:
+			m.Path = true
+		case MatchQuery:
+			m.Query = true
+		case MatchBody:
+			m.Body = true
+		default:
+			return Matcher{}, fmt.Errorf("unknown match field %q (want method, path, query or body)", f)
+		}
+	}
+	for _, h := range headers {
+		m.Headers = append(m.Headers, http.CanonicalHeaderKey(strings.TrimSpace(h)))
+	}
+	sort.Strings(m.Headers)
+	if !m.Method && !m.Path && !m.Query && !m.Body && len(m.Headers) == 0 {
+		return Matcher{}, fmt.Errorf("the matcher needs at least one field")
+	}
+	return m, nil
+}
+
+// Key identifies a request under the matcher.
+func (m Matcher) Key(req Request) string {
+	h := sha256.New()
+	if m.Method {
+		fmt.Fprintf(h, "method %s\n", strings.ToUpper(req.Method))
+	}
+	if m.Path {
+		fmt.Fprintf(h, "path %s\n", req.Path)
+	}
+	if m.Query {
+		q, _ := url.ParseQuery(req.Query)
+		fmt.Fprintf(h, "query %s\n", q.Encode())
+	}
+	if m.Body {
+		body, _ := req.Body.Bytes()
+		body = canonicalBody(body)
+		fmt.Fprintf(h, "body %d\n", len(body))
+		h.Write(body)
+	}
+	for _, name := range m.Headers {
+		fmt.Fprintf(h, "header %s: %s\n", name, strings.Join(http.Header(req.Headers).Values(name), ","))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// canonicalBody re-encodes JSON with sorted keys and no whitespace; other
+// bodies are compared byte for byte.
+func canonicalBody(body []byte) []byte {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if len(body) == 0 || dec.Decode(&v) != nil || dec.More() {
+		return body
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// Interaction is one recorded exchange.
+type Interaction struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+}
+
+type Request struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   string              `json:"query,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"` // only the matched headers
+	Body    Body                `json:"body,omitzero"`
+}
+
+type Response struct {
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    Body                `json:"body,omitzero"`
+}
+
+// Body is stored as text, or base64-encoded when binary.
+type Body struct {
+	Text   string `json:"text,omitempty"`
+	Base64 bool   `json:"base64,omitempty"`
+}
+
+// NewBody stores body as text unless it is binary.
+func NewBody(body []byte, contentType string) Body {
+	if len(body) == 0 {
+		return Body{}
+	}
+	if codec.IsBinary(contentType, body) {
+		return Body{Text: base64.StdEncoding.EncodeToString(body), Base64: true}
+	}
+	return Body{Text: string(body)}
+}
+
+// Bytes returns the body as sent.
+func (b Body) Bytes() ([]byte, error) {
+	if b.Base64 {
+		return base64.StdEncoding.DecodeString(b.Text)
+	}
+	return []byte(b.Text), nil
+}
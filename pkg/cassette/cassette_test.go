@@ -0,0 +1,139 @@
+package cassette
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatcher_Key(t *testing.T) {
+	m, err := ParseMatcher(DefaultMatch, []string{"x-tenant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := Request{
+		Method:  "POST",
+		Path:    "/orders",
+		Query:   "a=1&b=2",
+		Headers: map[string][]string{"X-Tenant": {"blue"}},
+		Body:    Body{Text: `{"qty": 1, "sku": "a"}`},
+	}
+	same := base
+	same.Query = "b=2&a=1"
+	same.Body = Body{Text: `{"sku":"a","qty":1}`}
+	if m.Key(base) != m.Key(same) {
+		t.Error("Expected query order and JSON formatting to be ignored")
+	}
+
+	for name, change := range map[string]func(*Request){
+		"method": func(r *Request) { r.Method = "PUT" },
+		"path":   func(r *Request) { r.Path = "/carts" },
+		"query":  func(r *Request) { r.Query = "a=2&b=2" },
+		"body":   func(r *Request) { r.Body = Body{Text: `{"qty": 2, "sku": "a"}`} },
+		"header": func(r *Request) { r.Headers = map[string][]string{"X-Tenant": {"red"}} },
+	} {
+		other := base
+		change(&other)
+		if m.Key(base) == m.Key(other) {
+			t.Errorf("Expected a different %s to change the key", name)
+		}
+	}
+
+	loose, _ := ParseMatcher([]string{"method", "path"}, nil)
+	other := base
+	other.Query, other.Body = "", Body{}
+	if loose.Key(base) != loose.Key(other) {
+		t.Error("Expected fields left out of the matcher to be ignored")
+	}
+
+	if _, err := ParseMatcher([]string{"cookie"}, nil); err == nil {
+		t.Error("Expected an unknown field to fail")
+	}
+	if _, err := ParseMatcher(nil, nil); err == nil {
+		t.Error("Expected an empty matcher to fail")
+	}
+}
+
+func TestStore_RecordAndLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cassettes")
+	m, _ := ParseMatcher(DefaultMatch, nil)
+	s, err := NewStore(dir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := Request{Method: "GET", Path: "/api/orders/42"}
+	for _, status := range []int{200, 404} {
+		if _, err := s.Record(Interaction{Request: req, Response: Response{Status: status}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Record(Interaction{Request: Request{Method: "GET", Path: "/"}, Response: Response{Status: 204}})
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 || filepath.Base(files[0]) != "get_api-orders-42_"+m.Key(req)+".json" {
+		t.Fatalf("Expected one file per key, got %v", files)
+	}
+
+	loaded, err := Load(dir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 3 {
+		t.Errorf("Expected 3 interactions, got %d", loaded.Len())
+	}
+	for _, want := range []int{200, 404, 404} {
+		in, _, ok := loaded.Find(req)
+		if !ok || in.Response.Status != want {
+			t.Errorf("Expected %d in order, then the last repeated; got %d (%v)", want, in.Response.Status, ok)
+		}
+	}
+	if _, _, ok := loaded.Find(Request{Method: "DELETE", Path: "/api/orders/42"}); ok {
+		t.Error("Expected a miss")
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing"), m); err == nil {
+		t.Error("Expected a missing directory to fail")
+	}
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644)
+	if _, err := Load(dir, m); err == nil {
+		t.Error("Expected a broken cassette to fail")
+	}
+}
+
+func TestStore_Full(t *testing.T) {
+	m, _ := ParseMatcher(DefaultMatch, nil)
+	s, err := NewStore(t.TempDir(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := Request{Method: "GET", Path: "/health"}
+	for i := 0; i < MaxInteractions; i++ {
+		if _, err := s.Record(Interaction{Request: req}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Record(Interaction{Request: req}); !errors.Is(err, ErrFull) {
+		t.Errorf("Expected a full cassette, got %v", err)
+	}
+	if s.Len() != MaxInteractions {
+		t.Errorf("Expected %d interactions, got %d", MaxInteractions, s.Len())
+	}
+}
+
+func TestBody(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00")
+	b := NewBody(png, "image/png")
+	if !b.Base64 {
+		t.Fatal("Expected a binary body to be base64-encoded")
+	}
+	if got, _ := b.Bytes(); string(got) != string(png) {
+		t.Errorf("Expected the body back, got %q", got)
+	}
+	if b := NewBody([]byte(`{"ok":true}`), "application/json"); b.Base64 || b.Text != `{"ok":true}` {
+		t.Errorf("Expected a text body, got %+v", b)
+	}
+}
@@ -0,0 +1,217 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MaxInteractions bounds the exchanges recorded for one key; playback
+// repeats the last one anyway.
+const MaxInteractions = 50
+
+// ErrFull is returned by Record once a key has MaxInteractions exchanges.
+var ErrFull = errors.New("cassette is full")
+
+// Cassette is the content of one file: the exchanges recorded for one key,
+// in order.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Store holds the cassettes of a directory. Playback answers repeated
+// requests with the recorded exchanges in order, then repeats the last one.
+type Store struct {
+	dir     string
+	matcher Matcher
+
+	mu    sync.Mutex
+	tapes map[string]*tape // by key
+
+	writeMu sync.Mutex    // serialises Flush
+	wake    chan struct{} // a recorded tape is waiting to be written
+}
+
+type tape struct {
+	file         string // written by this store; empty for loaded tapes
+	interactions []Interaction
+	next         int
+	dirty        bool // recorded since last written
+}
+
+// NewStore creates an empty store recording into dir.
+func NewStore(dir string, matcher Matcher) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, matcher: matcher, tapes: make(map[string]*tape), wake: make(chan struct{}, 1)}, nil
+}
+
+// Load reads every cassette in dir. Keys are computed with matcher, so
+// cassettes recorded with another matcher can still be played back.
+func Load(dir string, matcher Matcher) (*Store, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	s := &Store{dir: dir, matcher: matcher, tapes: make(map[string]*tape)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var c Cassette
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, in := range c.Interactions {
+			key := matcher.Key(in.Request)
+			t, ok := s.tapes[key]
+			if !ok {
+				t = &tape{}
+				s.tapes[key] = t
+			}
+			t.interactions = append(t.interactions, in)
+		}
+	}
+	return s, nil
+}
+
+// Len returns the number of interactions in the store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, t := range s.tapes {
+		n += len(t.interactions)
+	}
+	return n
+}
+
+// Find returns the next recorded exchange for req and its key.
+func (s *Store) Find(req Request) (Interaction, string, bool) {
+	key := s.matcher.Key(req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tapes[key]
+	if !ok || len(t.interactions) == 0 {
+		return Interaction{}, key, false
+	}
+	in := t.interactions[t.next]
+	if t.next < len(t.interactions)-1 {
+		t.next++
+	}
+	return in, key, true
+}
+
+// Record appends an exchange to the cassette of its key. The file is
+// written by Run or Flush; the first exchange recorded for a key replaces
+// an older cassette.
+func (s *Store) Record(in Interaction) (string, error) {
+	key := s.matcher.Key(in.Request)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tapes[key]
+	if !ok {
+		t = &tape{file: filepath.Join(s.dir, fileName(in.Request, key))}
+		s.tapes[key] = t
+	}
+	if len(t.interactions) >= MaxInteractions {
+		return key, ErrFull
+	}
+	t.interactions = append(t.interactions, in)
+	t.dirty = true
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return key, nil
+}
+
+// Run writes recorded cassettes in the background until ctx is done, then
+// writes what is left.
+func (s *Store) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				log.Printf("Failed to write cassettes: %v", err)
+			}
+			return
+		case <-s.wake:
+			if err := s.Flush(); err != nil {
+				log.Printf("Failed to write cassettes: %v", err)
+			}
+		}
+	}
+}
+
+// Flush writes the cassettes recorded since the last flush. Each file is
+// replaced whole, through a temporary file.
+func (s *Store) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	type pending struct {
+		tape         *tape
+		interactions []Interaction
+	}
+	var writes []pending
+	s.mu.Lock()
+	for _, t := range s.tapes {
+		if t.dirty {
+			// Recorded interactions are never modified, so the slice can be
+			// encoded outside the lock.
+			writes = append(writes, pending{t, t.interactions})
+			t.dirty = false
+		}
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, w := range writes {
+		data, err := json.MarshalIndent(Cassette{Interactions: w.interactions}, "", "  ")
+		if err == nil {
+			tmp := w.tape.file + ".tmp"
+			if err = os.WriteFile(tmp, append(data, '\n'), 0o644); err == nil {
+				err = os.Rename(tmp, w.tape.file)
+			}
+		}
+		if err != nil {
+			// Retried on the next flush.
+			s.mu.Lock()
+			w.tape.dirty = true
+			s.mu.Unlock()
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(w.tape.file), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileName names a cassette after its request, e.g.
+// get_api-orders-42_3f2a9c1b07de4c1e.json.
+func fileName(req Request, key string) string {
+	slug := strings.Trim(unsafeName.ReplaceAllString(req.Path, "-"), "-.")
+	if len(slug) > 80 {
+		slug = slug[:80]
+	}
+	if slug == "" {
+		slug = "root"
+	}
+	return strings.ToLower(req.Method) + "_" + slug + "_" + key + ".json"
+}
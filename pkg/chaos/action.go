@@ -0,0 +1,32 @@
+package chaos
+
+// Protocol-semantic actions a fault can take instead of a plain error status.
+// They fire with the fault's failure rate.
+const (
+	ActionAuthExpiry   = "auth_expiry"   // 401 with WWW-Authenticate
+	ActionThrottle     = "throttle"      // 429 with a varying Retry-After
+	ActionStaleETag    = "stale_etag"    // 304 with an ETag the client never saw
+	ActionRedirectLoop = "redirect_loop" // redirect back to the same URL
+	ActionSessionLoss  = "session_loss"  // expire every cookie the client sent
+	ActionClockSkew    = "clock_skew"    // skew the Date response header
+)
+
+// Actions lists every known action.
+var Actions = []string{
+	ActionAuthExpiry,
+	ActionThrottle,
+	ActionStaleETag,
+	ActionRedirectLoop,
+	ActionSessionLoss,
+	ActionClockSkew,
+}
+
+// ValidAction reports whether name is a known action.
+func ValidAction(name string) bool {
+	for _, a := range Actions {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
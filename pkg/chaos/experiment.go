@@ -0,0 +1,210 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+// State is the lifecycle state of an experiment.
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StatePaused    State = "paused"
+	StateCompleted State = "completed"
+	StateAborted   State = "aborted"
+)
+
+// RampStep raises the failure rate of every rule once the experiment
+// has been running for After, e.g. 1% -> 10% -> 50%.
+type RampStep struct {
+	After       Duration `json:"after" yaml:"after"`
+	FailureRate int      `json:"failure_rate" yaml:"failure_rate"`
+}
+
+// Condition is a steady-state requirement such as "p99_latency_ms under 800".
+// Metric is one of p50_latency_ms, p99_latency_ms, error_rate or ghost_rate
+// (rates are percentages).
+type Condition struct {
+	Metric string  `json:"metric" yaml:"metric"`
+	Max    float64 `json:"max" yaml:"max"`
+}
+
+// Experiment is a time-boxed chaos run. Its rules only apply while it is
+// running and within its duration, so chaos reverts on its own when the
+// duration ends, even if no Sentinel was alive to observe it.
+type Experiment struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hypothesis string     `json:"hypothesis,omitempty"`
+	Rules      []Rule     `json:"rules"`
+	StartAt    *time.Time `json:"start_at,omitempty"` // optional scheduled start
+	Duration   Duration   `json:"duration"`
+	Ramp       []RampStep `json:"ramp,omitempty"`
+
+	// SteadyState conditions must hold while the experiment runs. If any is
+	// violated for longer than GuardWindow, all chaos is halted.
+	SteadyState []Condition `json:"steady_state,omitempty"`
+	GuardWindow Duration    `json:"guard_window,omitempty"`
+
+	State     State      `json:"state"`
+	CreatedAt time.Time  `json:"created_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	PausedAt  *time.Time `json:"paused_at,omitempty"`
+	Paused    Duration   `json:"paused"` // total time spent paused
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+
+	stored string // JSON as last read from or written to Redis
+}
+
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// Validate checks the experiment definition.
+func (e *Experiment) Validate() error {
+	if e.Name == "" {
+		return errors.New("name is required")
+	}
+	if e.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if len(e.Rules) == 0 {
+		return errors.New("at least one rule is required")
+	}
+	for _, rule := range e.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, c := range e.SteadyState {
+		if _, ok := (metrics.Snapshot{}).Value(c.Metric); !ok {
+			return fmt.Errorf("unknown steady-state metric %q", c.Metric)
+		}
+	}
+	for i, step := range e.Ramp {
+		if step.FailureRate < 0 || step.FailureRate > 100 {
+			return fmt.Errorf("ramp failure rate %d out of range", step.FailureRate)
+		}
+		if i > 0 && step.After <= e.Ramp[i-1].After {
+			return fmt.Errorf("ramp step %d must come after the previous one", i+1)
+		}
+	}
+	return nil
+}
+
+// Elapsed returns how long the experiment has been actively running at now.
+func (e *Experiment) Elapsed(now time.Time) time.Duration {
+	if e.StartedAt == nil {
+		return 0
+	}
+
+	end := now
+	if e.EndedAt != nil {
+		end = *e.EndedAt
+	} else if e.PausedAt != nil {
+		end = *e.PausedAt
+	}
+	return end.Sub(*e.StartedAt) - time.Duration(e.Paused)
+}
+
+// Active reports whether the experiment's rules apply at now.
+func (e *Experiment) Active(now time.Time) bool {
+	return e.State == StateRunning && e.Elapsed(now) < time.Duration(e.Duration)
+}
+
+// EffectiveRules returns the rules with the ramp schedule applied, or nil
+// if the experiment is not active at now.
+func (e *Experiment) EffectiveRules(now time.Time) []Rule {
+	if !e.Active(now) {
+		return nil
+	}
+
+	elapsed := e.Elapsed(now)
+	rate := -1
+	for _, step := range e.Ramp {
+		if elapsed >= time.Duration(step.After) {
+			rate = step.FailureRate
+		}
+	}
+
+	rules := make([]Rule, len(e.Rules))
+	copy(rules, e.Rules)
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = e.Name
+		}
+		rules[i].ID = "experiment:" + e.ID + ":" + strconv.Itoa(i)
+		if rate >= 0 {
+			rules[i].Fault.FailureRate = rate
+		}
+	}
+	return rules
+}
+
+// Start moves a pending or paused experiment to running.
+func (e *Experiment) Start(now time.Time) error {
+	switch e.State {
+	case StatePending:
+		e.StartedAt = &now
+	case StatePaused:
+		e.Paused += Duration(now.Sub(*e.PausedAt))
+		e.PausedAt = nil
+	default:
+		return fmt.Errorf("%w: cannot start a %s experiment", ErrInvalidTransition, e.State)
+	}
+	e.State = StateRunning
+	return nil
+}
+
+// Pause suspends a running experiment; its clock stops until it is started again.
+func (e *Experiment) Pause(now time.Time) error {
+	if e.State != StateRunning {
+		return fmt.Errorf("%w: cannot pause a %s experiment", ErrInvalidTransition, e.State)
+	}
+	e.State = StatePaused
+	e.PausedAt = &now
+	return nil
+}
+
+// Abort ends the experiment immediately.
+func (e *Experiment) Abort(now time.Time, reason string) error {
+	if e.finished() {
+		return fmt.Errorf("%w: experiment already %s", ErrInvalidTransition, e.State)
+	}
+	if e.PausedAt != nil {
+		e.Paused += Duration(now.Sub(*e.PausedAt))
+		e.PausedAt = nil
+	}
+	e.State = StateAborted
+	e.EndedAt = &now
+	e.Reason = reason
+	return nil
+}
+
+// advance performs time-driven transitions: scheduled starts and completion.
+// It reports whether the experiment changed.
+func (e *Experiment) advance(now time.Time) bool {
+	switch {
+	case e.State == StatePending && e.StartAt != nil && !now.Before(*e.StartAt):
+		start := *e.StartAt
+		e.Start(start)
+		e.advance(now)
+		return true
+	case e.State == StateRunning && e.Elapsed(now) >= time.Duration(e.Duration):
+		end := e.StartedAt.Add(time.Duration(e.Duration) + time.Duration(e.Paused))
+		e.State = StateCompleted
+		e.EndedAt = &end
+		e.Reason = "duration elapsed"
+		return true
+	}
+	return false
+}
+
+func (e *Experiment) finished() bool {
+	return e.State == StateCompleted || e.State == StateAborted
+}
@@ -0,0 +1,159 @@
+package chaos
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+func newTestExperiment() *Experiment {
+	return &Experiment{
+		ID:       "exp1",
+		Name:     "orders-failure",
+		Rules:    []Rule{{Match: Matcher{PathPrefix: "/orders"}, Fault: Fault{FailureRate: 5}}},
+		Duration: Duration(10 * time.Minute),
+		Ramp: []RampStep{
+			{After: 0, FailureRate: 1},
+			{After: Duration(2 * time.Minute), FailureRate: 10},
+			{After: Duration(5 * time.Minute), FailureRate: 50},
+		},
+		State: StatePending,
+	}
+}
+
+func TestExperiment_Ramp(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	e := newTestExperiment()
+	if err := e.Start(start); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	tests := []struct {
+		offset   time.Duration
+		expected int
+	}{
+		{offset: 30 * time.Second, expected: 1},
+		{offset: 3 * time.Minute, expected: 10},
+		{offset: 9 * time.Minute, expected: 50},
+	}
+
+	for _, tt := range tests {
+		rules := e.EffectiveRules(start.Add(tt.offset))
+		if len(rules) != 1 {
+			t.Fatalf("Expected 1 rule at %s, got %d", tt.offset, len(rules))
+		}
+		if rules[0].Fault.FailureRate != tt.expected {
+			t.Errorf("At %s expected failure rate %d, got %d", tt.offset, tt.expected, rules[0].Fault.FailureRate)
+		}
+		if rules[0].Name != "orders-failure" {
+			t.Errorf("Expected rule to inherit experiment name, got '%s'", rules[0].Name)
+		}
+	}
+
+	if rules := e.EffectiveRules(start.Add(11 * time.Minute)); rules != nil {
+		t.Error("Rules should revert once the duration has elapsed")
+	}
+}
+
+func TestExperiment_RampOrder(t *testing.T) {
+	e := newTestExperiment()
+	if err := e.Validate(); err != nil {
+		t.Fatalf("Expected an ordered ramp to be valid, got %v", err)
+	}
+	e.Ramp[1], e.Ramp[2] = e.Ramp[2], e.Ramp[1]
+	if err := e.Validate(); err == nil {
+		t.Error("Expected ramp steps out of order to be rejected")
+	}
+}
+
+func TestExperiment_PauseStopsClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	e := newTestExperiment()
+	e.Start(start)
+
+	e.Pause(start.Add(4 * time.Minute))
+	if e.EffectiveRules(start.Add(5*time.Minute)) != nil {
+		t.Error("Paused experiment should not inject chaos")
+	}
+
+	e.Start(start.Add(14 * time.Minute))
+	if got := e.Elapsed(start.Add(15 * time.Minute)); got != 5*time.Minute {
+		t.Errorf("Expected elapsed 5m, got %s", got)
+	}
+	if !e.Active(start.Add(19 * time.Minute)) {
+		t.Error("Experiment should still be active after resuming")
+	}
+}
+
+func TestExperiment_Advance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	e := newTestExperiment()
+	e.StartAt = &start
+
+	if !e.advance(start.Add(time.Second)) || e.State != StateRunning {
+		t.Fatalf("Scheduled experiment should start, state is %s", e.State)
+	}
+
+	// Simulates a Sentinel restart long after the experiment should have ended
+	if !e.advance(start.Add(time.Hour)) || e.State != StateCompleted {
+		t.Fatalf("Expired experiment should complete, state is %s", e.State)
+	}
+	if !e.EndedAt.Equal(start.Add(10 * time.Minute)) {
+		t.Errorf("Expected end time at duration, got %s", e.EndedAt)
+	}
+}
+
+func TestExperiment_InvalidTransitions(t *testing.T) {
+	now := time.Now()
+	e := newTestExperiment()
+
+	if err := e.Pause(now); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Pausing a pending experiment should fail, got %v", err)
+	}
+
+	e.Abort(now, "test")
+	if err := e.Start(now); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Starting an aborted experiment should fail, got %v", err)
+	}
+}
+
+func TestMatcher_Matches(t *testing.T) {
+	m := Matcher{Methods: []string{"post"}, PathPrefix: "/payments", Headers: map[string]string{"X-Region": "eu"}}
+
+	req := httptest.NewRequest("POST", "/payments/42", nil)
+	req.Header.Set("X-Region", "eu")
+	if !m.Matches(req) {
+		t.Error("Expected request to match")
+	}
+
+	req = httptest.NewRequest("GET", "/payments/42", nil)
+	req.Header.Set("X-Region", "eu")
+	if m.Matches(req) {
+		t.Error("Method mismatch should not match")
+	}
+}
+
+func TestViolations(t *testing.T) {
+	conditions := []Condition{
+		{Metric: "p99_latency_ms", Max: 800},
+		{Metric: "error_rate", Max: 5},
+	}
+
+	healthy := metrics.Snapshot{Requests: 100, ErrorRate: 1, P99LatencyMs: 300}
+	if v := Violations(conditions, healthy); len(v) != 0 {
+		t.Errorf("Expected no violations, got %v", v)
+	}
+
+	breached := metrics.Snapshot{Requests: 100, ErrorRate: 12, P99LatencyMs: 950}
+	if v := Violations(conditions, breached); len(v) != 2 {
+		t.Errorf("Expected 2 violations, got %v", v)
+	}
+
+	tooFew := metrics.Snapshot{Requests: 3, ErrorRate: 100}
+	if v := Violations(conditions, tooFew); len(v) != 0 {
+		t.Errorf("Too few requests should not violate, got %v", v)
+	}
+}
@@ -0,0 +1,142 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/alert"
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+// minGuardRequests avoids tripping a guard on a handful of requests.
+const minGuardRequests = 10
+
+// Guard continuously checks the steady-state conditions of active
+// experiments against live traffic and halts all chaos when one is
+// violated for longer than the experiment's guard window.
+type Guard struct {
+	manager       *Manager
+	redisClient   *redis.Client
+	auditLog      *audit.Log
+	window        *metrics.Window
+	webhookURL    string
+	violatedSince map[string]time.Time // experiment ID -> first violation
+}
+
+func NewGuard(manager *Manager, redisClient *redis.Client, auditLog *audit.Log, window *metrics.Window, webhookURL string) *Guard {
+	return &Guard{
+		manager:       manager,
+		redisClient:   redisClient,
+		auditLog:      auditLog,
+		window:        window,
+		webhookURL:    webhookURL,
+		violatedSince: make(map[string]time.Time),
+	}
+}
+
+// Run evaluates the guards every second until ctx is done.
+func (g *Guard) Run(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			g.check(ctx, now)
+		}
+	}
+}
+
+func (g *Guard) check(ctx context.Context, now time.Time) {
+	snapshot := g.window.Snapshot(now)
+	active := g.manager.Active(now)
+
+	seen := make(map[string]bool, len(active))
+	for _, e := range active {
+		if len(e.SteadyState) == 0 {
+			continue
+		}
+		seen[e.ID] = true
+
+		violations := Violations(e.SteadyState, snapshot)
+		if len(violations) == 0 {
+			delete(g.violatedSince, e.ID)
+			continue
+		}
+
+		since, ok := g.violatedSince[e.ID]
+		if !ok {
+			since = now
+			g.violatedSince[e.ID] = now
+		}
+
+		if now.Sub(since) >= time.Duration(e.GuardWindow) {
+			g.halt(ctx, e, violations, snapshot)
+			return
+		}
+	}
+
+	for id := range g.violatedSince {
+		if !seen[id] {
+			delete(g.violatedSince, id)
+		}
+	}
+}
+
+// halt engages the kill switch, which also suppresses schedule rules, and
+// aborts every experiment. Global chaos is disabled too, so releasing the
+// kill switch does not bring it back.
+func (g *Guard) halt(ctx context.Context, e *Experiment, violations []string, s metrics.Snapshot) {
+	reason := fmt.Sprintf("steady state violated (%s)", strings.Join(violations, ", "))
+	log.Printf("🛑 GUARD: Experiment %q %s. Halting all chaos.", e.Name, reason)
+
+	entry := audit.Entry{Actor: "guard", Source: audit.SourceGuard, Action: "chaos.halt", Target: e.Name}
+	err := g.auditLog.Change(ctx, audit.ResourceSettings, entry, func() error {
+		if err := g.redisClient.SetKillSwitch(ctx, true); err != nil {
+			return err
+		}
+		return g.redisClient.DisableChaos(ctx)
+	})
+	if err != nil {
+		log.Printf("Failed to engage kill switch: %v", err)
+	}
+	if _, err := g.manager.AbortAll(ctx, reason); err != nil {
+		log.Printf("Failed to abort experiments: %v", err)
+	}
+	g.violatedSince = make(map[string]time.Time)
+
+	message := fmt.Sprintf("🛑 Chaos halted by steady-state guard of experiment *%s*\n"+
+		"Violations: %s\n"+
+		"Requests: %d | Error rate: %.2f%% | Ghost rate: %.2f%% | p50: %.0fms | p99: %.0fms",
+		e.Name, strings.Join(violations, ", "),
+		s.Requests, s.ErrorRate, s.GhostRate, s.P50LatencyMs, s.P99LatencyMs)
+	go func() {
+		if err := alert.Send(g.webhookURL, message); err != nil {
+			log.Printf("Failed to send guard alert: %v", err)
+		}
+	}()
+}
+
+// Violations returns a description of every condition that s breaks.
+// Snapshots with too few requests never violate anything.
+func Violations(conditions []Condition, s metrics.Snapshot) []string {
+	if s.Requests < minGuardRequests {
+		return nil
+	}
+
+	var violations []string
+	for _, c := range conditions {
+		value, ok := s.Value(c.Metric)
+		if ok && value >= c.Max {
+			violations = append(violations, fmt.Sprintf("%s %.2f >= %.2f", c.Metric, value, c.Max))
+		}
+	}
+	return violations
+}
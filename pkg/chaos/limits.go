@@ -0,0 +1,116 @@
+package chaos
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Limits bound the blast radius of every chaos source: global settings,
+// experiments, schedules and per-request directives.
+type Limits struct {
+	// Disabled turns chaos off entirely, e.g. in production unless explicitly allowed.
+	Disabled       bool
+	MaxFailureRate int           // 0-100
+	MaxLatency     time.Duration // total latency chaos may add to a request; 0 means unlimited
+
+	ExcludedRoutes  []string     // path prefixes never affected by chaos
+	ExcludedClients []*net.IPNet // client IPs never affected by chaos
+	ExcludedGroups  []string     // values of GroupHeader never affected by chaos
+	GroupHeader     string
+}
+
+// DefaultLimits places no restrictions on chaos.
+func DefaultLimits() Limits {
+	return Limits{MaxFailureRate: 100}
+}
+
+// Excludes reports whether r must never receive chaos.
+func (l Limits) Excludes(r *http.Request, clientIP string) bool {
+	for _, prefix := range l.ExcludedRoutes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	if ip := net.ParseIP(clientIP); ip != nil {
+		for _, network := range l.ExcludedClients {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	if l.GroupHeader != "" {
+		if group := r.Header.Get(l.GroupHeader); group != "" {
+			for _, excluded := range l.ExcludedGroups {
+				if strings.EqualFold(group, excluded) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Clamp caps the failure rate and latency of f. Request faults count as
+// failures and are capped by the same rate.
+func (l Limits) Clamp(f Fault) Fault {
+	if f.FailureRate > l.MaxFailureRate {
+		f.FailureRate = l.MaxFailureRate
+	}
+	if f.Request != nil && f.Request.Percent() > l.MaxFailureRate {
+		if l.MaxFailureRate == 0 {
+			f.Request = nil
+		} else {
+			req := *f.Request
+			req.Rate = l.MaxFailureRate
+			f.Request = &req
+		}
+	}
+	if l.MaxLatency > 0 {
+		maxMs := int(l.MaxLatency / time.Millisecond)
+		if f.LatencyMax > maxMs {
+			f.LatencyMax = maxMs
+		}
+		if f.LatencyMin > maxMs {
+			f.LatencyMin = maxMs
+		}
+	}
+	return f
+}
+
+// ClampDelay caps the total delay added to a request.
+func (l Limits) ClampDelay(d time.Duration) time.Duration {
+	if l.MaxLatency > 0 && d > l.MaxLatency {
+		return l.MaxLatency
+	}
+	return d
+}
+
+// ParseNetworks parses IPs and CIDRs such as "10.0.0.0/8" or "192.168.1.5".
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,36 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimits_Clamp(t *testing.T) {
+	l := Limits{MaxFailureRate: 20, MaxLatency: 500 * time.Millisecond}
+
+	f := l.Clamp(Fault{LatencyMin: 800, LatencyMax: 2000, FailureRate: 50, Status: 503})
+	if f.FailureRate != 20 || f.LatencyMin != 500 || f.LatencyMax != 500 || f.Status != 503 {
+		t.Errorf("Unexpected clamped fault: %+v", f)
+	}
+
+	if d := l.ClampDelay(3 * time.Second); d != 500*time.Millisecond {
+		t.Errorf("Expected delay to be clamped to 500ms, got %s", d)
+	}
+	if d := DefaultLimits().ClampDelay(3 * time.Second); d != 3*time.Second {
+		t.Errorf("Expected default limits not to clamp delay, got %s", d)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"192.168.1.5", "10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 3 || networks[0].String() != "192.168.1.5/32" || networks[2].String() != "::1/128" {
+		t.Errorf("Unexpected networks: %v", networks)
+	}
+
+	if _, err := ParseNetworks([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected an error for an invalid entry")
+	}
+}
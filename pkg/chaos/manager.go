@@ -0,0 +1,307 @@
+package chaos
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+const experimentsKey = "chaos:experiments"
+
+var ErrNotFound = errors.New("not found")
+
+// errChanged is returned when an experiment was changed in Redis since it
+// was read, e.g. by a tick on another Sentinel.
+var errChanged = errors.New("experiment changed concurrently")
+
+// transitionAttempts bounds how often a transition is retried on errChanged.
+const transitionAttempts = 5
+
+// casScript stores an experiment only if Redis still holds the copy it was
+// derived from, so a stale copy cannot overwrite a newer state.
+var casScript = goredis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then return 0 end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+return 1`)
+
+// Manager owns the experiment lifecycle. Experiments live in Redis so every
+// Sentinel instance sees the same state and survives restarts; the manager
+// keeps an in-memory copy that is refreshed on every tick.
+type Manager struct {
+	redisClient *redis.Client
+	mu          sync.RWMutex
+	experiments map[string]*Experiment
+}
+
+func NewManager(redisClient *redis.Client) *Manager {
+	return &Manager{
+		redisClient: redisClient,
+		experiments: make(map[string]*Experiment),
+	}
+}
+
+// Run reloads experiments and advances their lifecycle every second until ctx is done.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		m.tick(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) tick(ctx context.Context, now time.Time) {
+	if err := m.load(ctx); err != nil {
+		log.Printf("Failed to load experiments: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	var changed []*Experiment
+	for _, e := range m.experiments {
+		if e.advance(now) {
+			log.Printf("🧪 Experiment %q is now %s", e.Name, e.State)
+			changed = append(changed, e)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, e := range changed {
+		// A changed copy means an admin call or another Sentinel got there
+		// first; the next tick starts from its state.
+		if err := m.update(ctx, e); err != nil && !errors.Is(err, errChanged) {
+			log.Printf("Failed to save experiment %s: %v", e.ID, err)
+		}
+	}
+}
+
+func (m *Manager) load(ctx context.Context) error {
+	raw, err := m.redisClient.GetRawClient().HGetAll(ctx, experimentsKey).Result()
+	if err != nil {
+		return err
+	}
+
+	experiments := make(map[string]*Experiment, len(raw))
+	for id, data := range raw {
+		var e Experiment
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			log.Printf("Skipping malformed experiment %s: %v", id, err)
+			continue
+		}
+		e.stored = data
+		experiments[id] = &e
+	}
+
+	m.mu.Lock()
+	m.experiments = experiments
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) save(ctx context.Context, e *Experiment) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := m.redisClient.GetRawClient().HSet(ctx, experimentsKey, e.ID, data).Err(); err != nil {
+		return err
+	}
+	e.stored = string(data)
+	return nil
+}
+
+// update stores e if the stored experiment is still the one e was read as,
+// and returns errChanged otherwise.
+func (m *Manager) update(ctx context.Context, e *Experiment) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ok, err := casScript.Run(ctx, m.redisClient.GetRawClient(), []string{experimentsKey}, e.ID, e.stored, data).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errChanged
+	}
+	e.stored = string(data)
+	return nil
+}
+
+// Create validates and stores a new pending experiment.
+func (m *Manager) Create(ctx context.Context, e *Experiment) (*Experiment, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	e.ID = newID()
+	e.State = StatePending
+	e.CreatedAt = time.Now()
+	e.StartedAt, e.PausedAt, e.EndedAt = nil, nil, nil
+	e.Paused = 0
+	e.Reason = ""
+
+	if err := m.save(ctx, e); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.experiments[e.ID] = e
+	m.mu.Unlock()
+	return e, nil
+}
+
+// Get returns a fresh copy of the experiment from Redis.
+func (m *Manager) Get(ctx context.Context, id string) (*Experiment, error) {
+	data, err := m.redisClient.GetRawClient().HGet(ctx, experimentsKey, id).Result()
+	if err != nil {
+		if redis.IsNil(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var e Experiment
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal experiment: %w", err)
+	}
+	e.stored = data
+	e.advance(time.Now())
+	return &e, nil
+}
+
+// List returns all experiments, newest first.
+func (m *Manager) List(ctx context.Context) ([]*Experiment, error) {
+	if err := m.load(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	list := make([]*Experiment, 0, len(m.experiments))
+	for _, e := range m.experiments {
+		list = append(list, e)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Start, Pause and Abort apply a lifecycle transition and persist it.
+func (m *Manager) Start(ctx context.Context, id string) (*Experiment, error) {
+	return m.transition(ctx, id, func(e *Experiment, now time.Time) error {
+		return e.Start(now)
+	})
+}
+
+func (m *Manager) Pause(ctx context.Context, id string) (*Experiment, error) {
+	return m.transition(ctx, id, func(e *Experiment, now time.Time) error {
+		return e.Pause(now)
+	})
+}
+
+func (m *Manager) Abort(ctx context.Context, id, reason string) (*Experiment, error) {
+	return m.transition(ctx, id, func(e *Experiment, now time.Time) error {
+		return e.Abort(now, reason)
+	})
+}
+
+// transition applies fn to the stored experiment and saves the result only
+// if nothing changed it in between; otherwise it starts over from the new
+// state, so a stop or abort is never overwritten by a stale copy.
+func (m *Manager) transition(ctx context.Context, id string, fn func(*Experiment, time.Time) error) (*Experiment, error) {
+	var e *Experiment
+	for attempt := 0; ; attempt++ {
+		var err error
+		if e, err = m.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := fn(e, time.Now()); err != nil {
+			return nil, err
+		}
+		err = m.update(ctx, e)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errChanged) || attempt == transitionAttempts-1 {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	m.experiments[e.ID] = e
+	m.mu.Unlock()
+	return e, nil
+}
+
+// AbortAll aborts every experiment that has not finished yet.
+func (m *Manager) AbortAll(ctx context.Context, reason string) ([]*Experiment, error) {
+	list, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var aborted []*Experiment
+	for _, e := range list {
+		if e.finished() {
+			continue
+		}
+		if e, err := m.Abort(ctx, e.ID, reason); err == nil {
+			aborted = append(aborted, e)
+		}
+	}
+	return aborted, nil
+}
+
+// Active returns the experiments that are active at now.
+func (m *Manager) Active(now time.Time) []*Experiment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var active []*Experiment
+	for _, e := range m.experiments {
+		if e.Active(now) {
+			active = append(active, e)
+		}
+	}
+	return active
+}
+
+// ActiveRules returns the rules of every experiment active at now.
+func (m *Manager) ActiveRules(now time.Time) []Rule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rules []Rule
+	for _, e := range m.experiments {
+		rules = append(rules, e.EffectiveRules(now)...)
+	}
+	return rules
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("exp-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
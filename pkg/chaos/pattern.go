@@ -0,0 +1,174 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// Pattern kinds.
+const (
+	PatternEveryNth       = "every_nth"       // fail every Nth request
+	PatternBurst          = "burst"           // fail for For, every Every
+	PatternDegrade        = "degrade"         // ramp from healthy to the full fault over Over
+	PatternFlap           = "flap"            // alternate healthy and failing phases of about Period
+	PatternAfterSuccesses = "after_successes" // fail after N requests per client within Window
+)
+
+// patternIdleTTL is how long pattern state survives without matching requests.
+const patternIdleTTL = 10 * time.Minute
+
+// Pattern replaces the random roll of a fault with a stateful shape. When a
+// pattern is set the fault's failure_rate defaults to 100, unless the fault
+// only adds latency or mutates the request.
+type Pattern struct {
+	Kind      string   `json:"kind" yaml:"kind"`
+	N         int      `json:"n,omitempty" yaml:"n,omitempty"`
+	For       Duration `json:"for,omitempty" yaml:"for,omitempty"`
+	Every     Duration `json:"every,omitempty" yaml:"every,omitempty"`
+	Over      Duration `json:"over,omitempty" yaml:"over,omitempty"`
+	Period    Duration `json:"period,omitempty" yaml:"period,omitempty"`
+	Window    Duration `json:"window,omitempty" yaml:"window,omitempty"`
+	PerClient bool     `json:"per_client,omitempty" yaml:"per_client,omitempty"` // keep state per client instead of per rule
+}
+
+// Validate checks the pattern definition.
+func (p *Pattern) Validate() error {
+	switch p.Kind {
+	case PatternEveryNth:
+		if p.N < 1 {
+			return errors.New("every_nth needs n >= 1")
+		}
+	case PatternBurst:
+		if p.For <= 0 || p.Every <= p.For {
+			return errors.New("burst needs 0 < for < every")
+		}
+	case PatternDegrade:
+		if p.Over <= 0 {
+			return errors.New("degrade needs a positive over")
+		}
+	case PatternFlap:
+		if p.Period <= 0 {
+			return errors.New("flap needs a positive period")
+		}
+	case PatternAfterSuccesses:
+		if p.N < 0 || p.Window <= 0 {
+			return errors.New("after_successes needs n >= 0 and a positive window")
+		}
+	default:
+		return fmt.Errorf("unknown pattern %q", p.Kind)
+	}
+	return nil
+}
+
+// Apply evaluates the pattern for one request. It returns false if the
+// fault must not apply, otherwise the fault with the pattern's intensity.
+func (p *Pattern) Apply(ctx context.Context, store PatternStore, rule Rule, client string, now time.Time) (Fault, bool, error) {
+	// Unnamed rules share their experiment's name; the ID tells them apart.
+	id := rule.ID
+	if id == "" {
+		id = rule.Name
+	}
+	key := "chaos:patterns:" + id + ":" + p.Kind
+	if p.PerClient || p.Kind == PatternAfterSuccesses {
+		key += ":" + client
+	}
+
+	intensity := 1.0
+	switch p.Kind {
+	case PatternEveryNth:
+		n, err := store.Incr(ctx, key, now, patternIdleTTL)
+		if err != nil {
+			return Fault{}, false, err
+		}
+		if n%int64(p.N) != 0 {
+			return Fault{}, false, nil
+		}
+
+	case PatternAfterSuccesses:
+		n, err := store.Incr(ctx, key, now, time.Duration(p.Window))
+		if err != nil {
+			return Fault{}, false, err
+		}
+		if n <= int64(p.N) {
+			return Fault{}, false, nil
+		}
+
+	case PatternBurst:
+		since, err := store.First(ctx, key, now, patternIdleTTL)
+		if err != nil {
+			return Fault{}, false, err
+		}
+		if now.Sub(since)%time.Duration(p.Every) >= time.Duration(p.For) {
+			return Fault{}, false, nil
+		}
+
+	case PatternDegrade:
+		since, err := store.First(ctx, key, now, patternIdleTTL)
+		if err != nil {
+			return Fault{}, false, err
+		}
+		intensity = float64(now.Sub(since)) / float64(p.Over)
+		if intensity > 1 {
+			intensity = 1
+		}
+
+	case PatternFlap:
+		since, err := store.First(ctx, key, now, patternIdleTTL)
+		if err != nil {
+			return Fault{}, false, err
+		}
+		if !flapFailing(key, time.Duration(p.Period), now.Sub(since)) {
+			return Fault{}, false, nil
+		}
+	}
+
+	return scaleFault(rule.Fault, intensity), true, nil
+}
+
+// flapFailing reports whether the flap phase at elapsed is failing. Phase k
+// starts at k*period plus a jitter of up to a quarter period, derived from
+// key so every Sentinel agrees on the schedule. Even phases are healthy.
+func flapFailing(key string, period, elapsed time.Duration) bool {
+	boundary := func(k int64) time.Duration {
+		if k <= 0 {
+			return 0
+		}
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s:%d", key, k)
+		jitter := time.Duration(h.Sum64()%uint64(period/2+1)) - period/4
+		return time.Duration(k)*period + jitter
+	}
+
+	k := int64(elapsed / period)
+	if elapsed < boundary(k) {
+		k--
+	} else if elapsed >= boundary(k+1) {
+		k++
+	}
+	return k%2 == 1
+}
+
+// scaleFault applies a pattern's intensity to a fault.
+func scaleFault(f Fault, intensity float64) Fault {
+	fails := f.Status != 0 || f.Action != "" || (f.LatencyMax == 0 && f.Request == nil)
+	if f.FailureRate == 0 && fails {
+		f.FailureRate = 100
+	}
+
+	f.FailureRate = int(float64(f.FailureRate) * intensity)
+	f.LatencyMin = int(float64(f.LatencyMin) * intensity)
+	f.LatencyMax = int(float64(f.LatencyMax) * intensity)
+	if intensity < 1 && f.Request != nil {
+		req := *f.Request
+		req.Rate = int(float64(req.Percent()) * intensity)
+		if req.Rate == 0 {
+			f.Request = nil
+		} else {
+			f.Request = &req
+		}
+	}
+	return f
+}
@@ -0,0 +1,171 @@
+package chaos
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// PatternStore keeps the counters and start times of fault patterns.
+type PatternStore interface {
+	// Incr increments key and returns the new value. ttl is set when the key is created.
+	Incr(ctx context.Context, key string, now time.Time, ttl time.Duration) (int64, error)
+	// First returns when key was first seen, storing now if it is new.
+	// ttl is refreshed on every call.
+	First(ctx context.Context, key string, now time.Time, ttl time.Duration) (time.Time, error)
+}
+
+// NewPatternStore shares pattern state through Redis and falls back to
+// local state while Redis is unavailable.
+func NewPatternStore(redisClient *redis.Client) PatternStore {
+	return &fallbackStore{primary: &redisStore{redisClient: redisClient}, local: NewLocalPatternStore()}
+}
+
+var incrScript = goredis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`)
+
+var firstScript = goredis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v then
+  v = ARGV[1]
+  redis.call('SET', KEYS[1], v)
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return v`)
+
+type redisStore struct {
+	redisClient *redis.Client
+}
+
+func (s *redisStore) Incr(ctx context.Context, key string, now time.Time, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.redisClient.GetRawClient(), []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (s *redisStore) First(ctx context.Context, key string, now time.Time, ttl time.Duration) (time.Time, error) {
+	v, err := firstScript.Run(ctx, s.redisClient.GetRawClient(), []string{key}, now.UnixMilli(), ttl.Milliseconds()).Text()
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// patternRetryAfter is how long the fallback store uses local state after
+// the primary fails, before trying it again.
+const patternRetryAfter = 5 * time.Second
+
+// fallbackStore uses local state whenever the primary store fails. After a
+// failure the primary is left alone for patternRetryAfter, so requests do
+// not each wait for a Redis timeout during an outage.
+type fallbackStore struct {
+	primary PatternStore
+	local   PatternStore
+	failing atomic.Bool
+	retryAt atomic.Int64 // unix nanoseconds
+}
+
+func (s *fallbackStore) Incr(ctx context.Context, key string, now time.Time, ttl time.Duration) (int64, error) {
+	if s.cooling(now) {
+		return s.local.Incr(ctx, key, now, ttl)
+	}
+	n, err := s.primary.Incr(ctx, key, now, ttl)
+	if s.failed(err, now) {
+		return s.local.Incr(ctx, key, now, ttl)
+	}
+	return n, nil
+}
+
+func (s *fallbackStore) First(ctx context.Context, key string, now time.Time, ttl time.Duration) (time.Time, error) {
+	if s.cooling(now) {
+		return s.local.First(ctx, key, now, ttl)
+	}
+	t, err := s.primary.First(ctx, key, now, ttl)
+	if s.failed(err, now) {
+		return s.local.First(ctx, key, now, ttl)
+	}
+	return t, nil
+}
+
+// cooling reports whether the primary failed less than patternRetryAfter ago.
+func (s *fallbackStore) cooling(now time.Time) bool {
+	return now.UnixNano() < s.retryAt.Load()
+}
+
+// failed records the primary's health and logs transitions.
+func (s *fallbackStore) failed(err error, now time.Time) bool {
+	if err != nil {
+		s.retryAt.Store(now.Add(patternRetryAfter).UnixNano())
+		if !s.failing.Swap(true) {
+			log.Printf("⚠️ Pattern state unavailable in Redis, using local counters for %v: %v", patternRetryAfter, err)
+		}
+		return true
+	}
+	if s.failing.Swap(false) {
+		log.Printf("✅ Pattern state shared through Redis again")
+	}
+	return false
+}
+
+// LocalPatternStore keeps pattern state in memory, for a single Sentinel.
+type LocalPatternStore struct {
+	mu      sync.Mutex
+	entries map[string]*localEntry
+}
+
+type localEntry struct {
+	count   int64
+	first   time.Time
+	expires time.Time
+}
+
+func NewLocalPatternStore() *LocalPatternStore {
+	return &LocalPatternStore{entries: make(map[string]*localEntry)}
+}
+
+func (s *LocalPatternStore) Incr(ctx context.Context, key string, now time.Time, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(key, now, ttl)
+	e.count++
+	return e.count, nil
+}
+
+func (s *LocalPatternStore) First(ctx context.Context, key string, now time.Time, ttl time.Duration) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(key, now, ttl)
+	e.expires = now.Add(ttl)
+	return e.first, nil
+}
+
+// entry returns the live entry for key, creating it if needed. Expired
+// entries are swept whenever a new one is created.
+func (s *LocalPatternStore) entry(key string, now time.Time, ttl time.Duration) *localEntry {
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e
+	}
+
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	e := &localEntry{first: now, expires: now.Add(ttl)}
+	s.entries[key] = e
+	return e
+}
@@ -0,0 +1,188 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func applyN(t *testing.T, p *Pattern, store PatternStore, client string, times []time.Time) []bool {
+	t.Helper()
+	rule := Rule{Name: "r", Fault: Fault{Status: 503}, Match: Matcher{}}
+	var got []bool
+	for _, now := range times {
+		_, ok, err := p.Apply(context.Background(), store, rule, client, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ok)
+	}
+	return got
+}
+
+func repeat(now time.Time, n int) []time.Time {
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = now
+	}
+	return times
+}
+
+func TestPattern_EveryNth(t *testing.T) {
+	now := time.Now()
+	got := applyN(t, &Pattern{Kind: PatternEveryNth, N: 3}, NewLocalPatternStore(), "c1", repeat(now, 6))
+	want := []bool{false, false, true, false, false, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Request %d: expected %v, got %v", i+1, want[i], got[i])
+		}
+	}
+}
+
+func TestPattern_KeyedByRuleID(t *testing.T) {
+	store := NewLocalPatternStore()
+	p := &Pattern{Kind: PatternEveryNth, N: 2}
+	now := time.Now()
+	for _, id := range []string{"experiment:e1:0", "experiment:e1:1"} {
+		rule := Rule{Name: "checkout", ID: id}
+		if _, ok, _ := p.Apply(context.Background(), store, rule, "", now); ok {
+			t.Errorf("Expected rule %s to keep its own counter", id)
+		}
+	}
+}
+
+// brokenStore fails every call, like Redis during an outage.
+type brokenStore struct{ calls int }
+
+func (s *brokenStore) Incr(context.Context, string, time.Time, time.Duration) (int64, error) {
+	s.calls++
+	return 0, errors.New("connection refused")
+}
+
+func (s *brokenStore) First(context.Context, string, time.Time, time.Duration) (time.Time, error) {
+	s.calls++
+	return time.Time{}, errors.New("connection refused")
+}
+
+func TestFallbackStore_RetryAfter(t *testing.T) {
+	primary := &brokenStore{}
+	store := &fallbackStore{primary: primary, local: NewLocalPatternStore()}
+	now := time.Now()
+	for i := int64(1); i <= 3; i++ {
+		if n, err := store.Incr(context.Background(), "k", now, time.Minute); err != nil || n != i {
+			t.Fatalf("Expected local counter %d, got %d (%v)", i, n, err)
+		}
+	}
+	if primary.calls != 1 {
+		t.Errorf("Expected the primary to be left alone after failing, got %d calls", primary.calls)
+	}
+	store.First(context.Background(), "k", now.Add(patternRetryAfter), time.Minute)
+	if primary.calls != 2 {
+		t.Errorf("Expected the primary to be retried after %v, got %d calls", patternRetryAfter, primary.calls)
+	}
+}
+
+func TestPattern_AfterSuccesses(t *testing.T) {
+	store := NewLocalPatternStore()
+	p := &Pattern{Kind: PatternAfterSuccesses, N: 2, Window: Duration(time.Minute)}
+	now := time.Now()
+
+	got := applyN(t, p, store, "c1", repeat(now, 3))
+	if got[0] || got[1] || !got[2] {
+		t.Errorf("Expected the third request to fail, got %v", got)
+	}
+
+	if applyN(t, p, store, "c2", repeat(now, 1))[0] {
+		t.Error("Expected another client to have its own counter")
+	}
+
+	if applyN(t, p, store, "c1", repeat(now.Add(2*time.Minute), 1))[0] {
+		t.Error("Expected the counter to reset after the window")
+	}
+}
+
+func TestPattern_Burst(t *testing.T) {
+	start := time.Now()
+	p := &Pattern{Kind: PatternBurst, For: Duration(10 * time.Second), Every: Duration(time.Minute)}
+	got := applyN(t, p, NewLocalPatternStore(), "", []time.Time{
+		start, start.Add(9 * time.Second), start.Add(11 * time.Second), start.Add(65 * time.Second), start.Add(75 * time.Second),
+	})
+	want := []bool{true, true, false, true, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Sample %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestPattern_Degrade(t *testing.T) {
+	store := NewLocalPatternStore()
+	p := &Pattern{Kind: PatternDegrade, Over: Duration(100 * time.Second)}
+	rule := Rule{Name: "r", Fault: Fault{LatencyMin: 100, LatencyMax: 1000, FailureRate: 40}}
+	start := time.Now()
+
+	for _, tt := range []struct {
+		at      time.Duration
+		rate    int
+		latency int
+	}{
+		{0, 0, 0},
+		{50 * time.Second, 20, 500},
+		{200 * time.Second, 40, 1000},
+	} {
+		f, ok, err := p.Apply(context.Background(), store, rule, "", start.Add(tt.at))
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result at %s: %v %v", tt.at, ok, err)
+		}
+		if f.FailureRate != tt.rate || f.LatencyMax != tt.latency {
+			t.Errorf("At %s: expected rate %d and latency %d, got %d and %d", tt.at, tt.rate, tt.latency, f.FailureRate, f.LatencyMax)
+		}
+	}
+}
+
+func TestFlapFailing(t *testing.T) {
+	period := 10 * time.Second
+	changes := 0
+	prev := flapFailing("k", period, 0)
+	if prev {
+		t.Error("Expected flapping to start healthy")
+	}
+	for elapsed := time.Duration(0); elapsed < 100*period; elapsed += 100 * time.Millisecond {
+		state := flapFailing("k", period, elapsed)
+		if state != prev {
+			changes++
+			prev = state
+		}
+	}
+	if changes < 90 || changes > 110 {
+		t.Errorf("Expected about 100 phase changes, got %d", changes)
+	}
+}
+
+func TestScaleFault_Defaults(t *testing.T) {
+	if f := scaleFault(Fault{Status: 503}, 1); f.FailureRate != 100 {
+		t.Errorf("Expected failure rate to default to 100, got %d", f.FailureRate)
+	}
+	if f := scaleFault(Fault{LatencyMax: 500}, 1); f.FailureRate != 0 {
+		t.Errorf("Expected latency-only fault not to fail, got %d", f.FailureRate)
+	}
+	if f := scaleFault(Fault{Request: &RequestFault{Duplicates: 1}}, 1); f.FailureRate != 0 {
+		t.Errorf("Expected request-only fault not to fail, got %d", f.FailureRate)
+	}
+}
+
+func TestPattern_Validate(t *testing.T) {
+	invalid := []Pattern{
+		{Kind: "sometimes"},
+		{Kind: PatternEveryNth},
+		{Kind: PatternBurst, For: Duration(time.Minute), Every: Duration(time.Second)},
+		{Kind: PatternFlap},
+		{Kind: PatternAfterSuccesses, N: 3},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", p)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package chaos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDuplicates bounds how many extra copies of a request a fault may send.
+const maxDuplicates = 10
+
+// RequestFault mutates a matched request before it reaches the backend.
+// Field paths are dot-separated ("user.address.city"); "*" or an index
+// selects array elements ("items.*.price", "items.0.price").
+type RequestFault struct {
+	Rate int `json:"rate,omitempty" yaml:"rate,omitempty"` // 0-100, 0 means every matched request
+
+	DropFields   []string               `json:"drop_fields,omitempty" yaml:"drop_fields,omitempty"`
+	RenameFields map[string]string      `json:"rename_fields,omitempty" yaml:"rename_fields,omitempty"` // path -> new key
+	InjectFields map[string]interface{} `json:"inject_fields,omitempty" yaml:"inject_fields,omitempty"` // path -> value
+	RetypeFields map[string]string      `json:"retype_fields,omitempty" yaml:"retype_fields,omitempty"` // path -> string, number, bool, array, object or null
+
+	StripHeaders     []string `json:"strip_headers,omitempty" yaml:"strip_headers,omitempty"`
+	DuplicateHeaders []string `json:"duplicate_headers,omitempty" yaml:"duplicate_headers,omitempty"`
+
+	Duplicates  int      `json:"duplicates,omitempty" yaml:"duplicates,omitempty"`     // extra copies sent alongside the request
+	ReplayAfter Duration `json:"replay_after,omitempty" yaml:"replay_after,omitempty"` // send the request again after this delay
+}
+
+// Validate checks the request fault definition.
+func (f *RequestFault) Validate() error {
+	if f.Rate < 0 || f.Rate > 100 {
+		return fmt.Errorf("request fault rate %d out of range", f.Rate)
+	}
+	if f.Duplicates < 0 || f.Duplicates > maxDuplicates {
+		return fmt.Errorf("duplicates must be between 0 and %d", maxDuplicates)
+	}
+	if f.ReplayAfter < 0 || time.Duration(f.ReplayAfter) > time.Hour {
+		return errors.New("replay_after must be between 0 and 1h")
+	}
+	for path, kind := range f.RetypeFields {
+		if _, err := retype("", kind); err != nil {
+			return fmt.Errorf("retype %s: %w", path, err)
+		}
+	}
+	for path, name := range f.RenameFields {
+		if name == "" || strings.Contains(name, ".") {
+			return fmt.Errorf("rename %s: new name must be a single key", path)
+		}
+	}
+	return nil
+}
+
+// Percent returns the share of matched requests the fault applies to.
+func (f *RequestFault) Percent() int {
+	if f.Rate == 0 {
+		return 100
+	}
+	return f.Rate
+}
+
+// MutatesBody reports whether the fault changes the JSON body.
+func (f *RequestFault) MutatesBody() bool {
+	return len(f.DropFields) > 0 || len(f.RenameFields) > 0 || len(f.InjectFields) > 0 || len(f.RetypeFields) > 0
+}
+
+// MutateHeaders strips and duplicates headers in place.
+func (f *RequestFault) MutateHeaders(h http.Header) {
+	for _, name := range f.StripHeaders {
+		h.Del(name)
+	}
+	for _, name := range f.DuplicateHeaders {
+		for _, value := range h.Values(name) {
+			h.Add(name, value)
+		}
+	}
+}
+
+// MutateJSON applies the field faults to a JSON document. Paths that do not
+// exist are ignored, except for injected fields whose parent object exists.
+func (f *RequestFault) MutateJSON(body []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, path := range f.DropFields {
+		walk(doc, splitPath(path), func(parent map[string]interface{}, key string) {
+			delete(parent, key)
+		})
+	}
+	for path, name := range f.RenameFields {
+		walk(doc, splitPath(path), func(parent map[string]interface{}, key string) {
+			if v, ok := parent[key]; ok {
+				delete(parent, key)
+				parent[name] = v
+			}
+		})
+	}
+	for path, kind := range f.RetypeFields {
+		walk(doc, splitPath(path), func(parent map[string]interface{}, key string) {
+			if v, ok := parent[key]; ok {
+				parent[key], _ = retype(v, kind)
+			}
+		})
+	}
+	for path, value := range f.InjectFields {
+		walk(doc, splitPath(path), func(parent map[string]interface{}, key string) {
+			parent[key] = value
+		})
+	}
+
+	return json.Marshal(doc)
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "."), ".")
+}
+
+// walk calls fn with every object holding the last segment of path.
+func walk(node interface{}, path []string, fn func(parent map[string]interface{}, key string)) {
+	if len(path) == 0 {
+		return
+	}
+	segment := path[0]
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			fn(v, segment)
+			return
+		}
+		if segment == "*" {
+			for _, child := range v {
+				walk(child, path[1:], fn)
+			}
+			return
+		}
+		if child, ok := v[segment]; ok {
+			walk(child, path[1:], fn)
+		}
+	case []interface{}:
+		if segment == "*" {
+			for _, child := range v {
+				walk(child, path[1:], fn)
+			}
+			return
+		}
+		if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(v) {
+			walk(v[i], path[1:], fn)
+		}
+	}
+}
+
+// retype converts v to the given JSON type, keeping as much of its value as possible.
+func retype(v interface{}, kind string) (interface{}, error) {
+	switch kind {
+	case "string":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		data, _ := json.Marshal(v)
+		return string(data), nil
+	case "number":
+		switch t := v.(type) {
+		case float64:
+			return t, nil
+		case bool:
+			if t {
+				return 1.0, nil
+			}
+			return 0.0, nil
+		case string:
+			if n, err := strconv.ParseFloat(t, 64); err == nil {
+				return n, nil
+			}
+			return float64(len(t)), nil
+		}
+		return 0.0, nil
+	case "bool":
+		switch t := v.(type) {
+		case bool:
+			return t, nil
+		case float64:
+			return t != 0, nil
+		case string:
+			return t != "", nil
+		}
+		return v != nil, nil
+	case "array":
+		if a, ok := v.([]interface{}); ok {
+			return a, nil
+		}
+		return []interface{}{v}, nil
+	case "object":
+		if m, ok := v.(map[string]interface{}); ok {
+			return m, nil
+		}
+		return map[string]interface{}{"value": v}, nil
+	case "null":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", kind)
+}
@@ -0,0 +1,116 @@
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRequestFault_MutateJSON(t *testing.T) {
+	f := &RequestFault{
+		DropFields:   []string{"user.password", "missing.field"},
+		RenameFields: map[string]string{"user.email": "mail"},
+		InjectFields: map[string]interface{}{"debug": true, "user.role": "admin"},
+		RetypeFields: map[string]string{"items.*.price": "string", "count": "bool"},
+	}
+
+	body := `{"user":{"email":"a@b.c","password":"x"},"items":[{"price":10},{"price":2.5}],"count":3}`
+	out, err := f.MutateJSON([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	json.Unmarshal(out, &got)
+	want := map[string]interface{}{
+		"user":  map[string]interface{}{"mail": "a@b.c", "role": "admin"},
+		"items": []interface{}{map[string]interface{}{"price": "10"}, map[string]interface{}{"price": "2.5"}},
+		"count": true,
+		"debug": true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected mutation:\n got %v\nwant %v", got, want)
+	}
+
+	if _, err := f.MutateJSON([]byte("not json")); err == nil {
+		t.Error("Expected an error for a non-JSON body")
+	}
+}
+
+func TestRetype(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		kind string
+		want interface{}
+	}{
+		{"42", "number", 42.0},
+		{"abc", "number", 3.0},
+		{42.0, "string", "42"},
+		{"x", "array", []interface{}{"x"}},
+		{"x", "object", map[string]interface{}{"value": "x"}},
+		{"x", "null", nil},
+		{0.0, "bool", false},
+	}
+	for _, tt := range tests {
+		got, err := retype(tt.in, tt.kind)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("retype(%v, %s) = %v, %v; want %v", tt.in, tt.kind, got, err, tt.want)
+		}
+	}
+}
+
+func TestRequestFault_MutateHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer x")
+	h.Set("Idempotency-Key", "k1")
+
+	f := &RequestFault{StripHeaders: []string{"Authorization"}, DuplicateHeaders: []string{"Idempotency-Key"}}
+	f.MutateHeaders(h)
+
+	if h.Get("Authorization") != "" {
+		t.Error("Expected Authorization to be stripped")
+	}
+	if got := h.Values("Idempotency-Key"); len(got) != 2 {
+		t.Errorf("Expected Idempotency-Key to be duplicated, got %v", got)
+	}
+}
+
+func TestRequestFault_Validate(t *testing.T) {
+	invalid := []*RequestFault{
+		{Rate: 101},
+		{Duplicates: 50},
+		{RetypeFields: map[string]string{"a": "date"}},
+		{RenameFields: map[string]string{"a": "b.c"}},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", f)
+		}
+	}
+
+	rule := Rule{Name: "r", Fault: Fault{Request: &RequestFault{Duplicates: 2}}}
+	if err := rule.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRule_ValidateAction(t *testing.T) {
+	if err := (Rule{Fault: Fault{Action: ActionThrottle}}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := (Rule{Fault: Fault{Action: "teleport"}}).Validate(); err == nil {
+		t.Error("Expected an error for an unknown action")
+	}
+}
+
+func TestRule_ValidateFault(t *testing.T) {
+	for _, f := range []Fault{{Status: 42}, {Status: 1000}, {LatencyMin: -5}, {LatencyMax: -1}} {
+		if err := (Rule{Name: "r", Fault: f}).Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", f)
+		}
+	}
+	if err := (Rule{Name: "r", Fault: Fault{Status: 503, LatencyMin: 10, LatencyMax: 20}}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package chaos
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Matcher selects the requests a rule applies to. Empty fields match everything.
+type Matcher struct {
+	Methods    []string          `json:"methods,omitempty" yaml:"methods,omitempty"`
+	PathPrefix string            `json:"path_prefix,omitempty" yaml:"path_prefix,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// Matches reports whether r is selected by the matcher.
+func (m Matcher) Matches(r *http.Request) bool {
+	if len(m.Methods) > 0 {
+		found := false
+		for _, method := range m.Methods {
+			if strings.EqualFold(method, r.Method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if m.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+
+	for k, v := range m.Headers {
+		if r.Header.Get(k) != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Fault describes what happens to a matched request.
+type Fault struct {
+	LatencyMin  int `json:"latency_min,omitempty" yaml:"latency_min,omitempty"`   // ms
+	LatencyMax  int `json:"latency_max,omitempty" yaml:"latency_max,omitempty"`   // ms
+	FailureRate int `json:"failure_rate,omitempty" yaml:"failure_rate,omitempty"` // 0-100
+	Status      int `json:"status,omitempty" yaml:"status,omitempty"`             // defaults to 500
+
+	// Action replaces the plain error status with a protocol-semantic fault.
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+
+	Request *RequestFault `json:"request,omitempty" yaml:"request,omitempty"`
+	Pattern *Pattern      `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// Rule binds a fault to the requests selected by its matcher.
+type Rule struct {
+	Name  string  `json:"name" yaml:"name"`
+	Match Matcher `json:"match" yaml:"match"`
+	Fault Fault   `json:"fault" yaml:"fault"`
+
+	// ID identifies an active rule across requests, e.g. its experiment ID
+	// and index; it keys pattern state. Set by EffectiveRules.
+	ID string `json:"-" yaml:"-"`
+}
+
+// Validate checks the rule definition.
+func (r Rule) Validate() error {
+	if r.Fault.FailureRate < 0 || r.Fault.FailureRate > 100 {
+		return fmt.Errorf("rule %q: failure rate %d out of range", r.Name, r.Fault.FailureRate)
+	}
+	if r.Fault.Status != 0 && (r.Fault.Status < 100 || r.Fault.Status > 599) {
+		return fmt.Errorf("rule %q: status %d out of range", r.Name, r.Fault.Status)
+	}
+	if r.Fault.LatencyMin < 0 || r.Fault.LatencyMax < 0 {
+		return fmt.Errorf("rule %q: latency must not be negative", r.Name)
+	}
+	if r.Fault.Action != "" && !ValidAction(r.Fault.Action) {
+		return fmt.Errorf("rule %q: unknown action %q", r.Name, r.Fault.Action)
+	}
+	if r.Fault.Request != nil {
+		if err := r.Fault.Request.Validate(); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+	}
+	if r.Fault.Pattern != nil {
+		if err := r.Fault.Pattern.Validate(); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// maxScheduleDuration bounds how far back a schedule looks for its last firing.
+const maxScheduleDuration = 24 * time.Hour
+
+// Window is a closed time range, e.g. a release freeze.
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Note  string    `json:"note,omitempty"`
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Schedule activates rules, or runs an experiment, every time its cron
+// expression fires, for Duration. Blackout windows suppress it.
+type Schedule struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Cron       string   `json:"cron"`
+	TimeZone   string   `json:"time_zone,omitempty"` // IANA name, defaults to UTC
+	Duration   Duration `json:"duration"`
+	Rules      []Rule   `json:"rules,omitempty"`
+	Experiment string   `json:"experiment,omitempty"` // ID of an experiment to use as template
+	Blackouts  []Window `json:"blackouts,omitempty"`
+	Enabled    bool     `json:"enabled"`
+}
+
+// Validate checks the schedule definition.
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if _, err := ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if _, err := s.location(); err != nil {
+		return err
+	}
+	if s.Duration <= 0 || time.Duration(s.Duration) > maxScheduleDuration {
+		return fmt.Errorf("duration must be positive and at most %s", maxScheduleDuration)
+	}
+	if len(s.Rules) == 0 && s.Experiment == "" {
+		return errors.New("either rules or an experiment is required")
+	}
+	for _, rule := range s.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+// Status describes a schedule at a point in time.
+type Status struct {
+	Active   bool       `json:"active"`
+	FiredAt  *time.Time `json:"fired_at,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+	Blackout *Window    `json:"blackout,omitempty"`
+}
+
+// StatusAt evaluates the schedule at t. A schedule is active if its cron
+// fired within the last Duration and t is not inside a blackout window.
+func (s *Schedule) StatusAt(t time.Time) Status {
+	var status Status
+	if !s.Enabled {
+		return status
+	}
+
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return status
+	}
+	loc, err := s.location()
+	if err != nil {
+		return status
+	}
+
+	firings := s.firings(cron, t.In(loc), 1)
+	if len(firings) == 0 {
+		return status
+	}
+	until := firings[0].Add(time.Duration(s.Duration))
+	status.FiredAt, status.Until = &firings[0], &until
+
+	for _, b := range s.Blackouts {
+		if b.Contains(t) {
+			blackout := b
+			status.Blackout = &blackout
+			return status
+		}
+	}
+
+	status.Active = true
+	return status
+}
+
+// firingsAt returns the firings still within their duration at t, newest
+// first. Firings overlap when the duration is longer than the cron interval.
+func (s *Schedule) firingsAt(t time.Time) []time.Time {
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return nil
+	}
+	loc, err := s.location()
+	if err != nil {
+		return nil
+	}
+	return s.firings(cron, t.In(loc), 0)
+}
+
+// firings returns up to max firings (0 for all) within the duration before t.
+func (s *Schedule) firings(cron *Cron, t time.Time, max int) []time.Time {
+	var fired []time.Time
+	for m := t.Truncate(time.Minute); t.Sub(m) < time.Duration(s.Duration); m = m.Add(-time.Minute) {
+		if cron.Matches(m) {
+			fired = append(fired, m)
+			if len(fired) == max {
+				break
+			}
+		}
+	}
+	return fired
+}
+
+// EffectiveRules returns the schedule's rules named after the schedule where unnamed.
+func (s *Schedule) EffectiveRules() []Rule {
+	rules := make([]Rule, len(s.Rules))
+	copy(rules, s.Rules)
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = s.Name
+		}
+		rules[i].ID = "schedule:" + s.ID + ":" + strconv.Itoa(i)
+	}
+	return rules
+}
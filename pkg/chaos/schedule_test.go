@@ -0,0 +1,103 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		at      time.Time
+		matches bool
+	}{
+		{expr: "0 10 * * TUE", at: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), matches: true}, // Tuesday
+		{expr: "0 10 * * TUE", at: time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC), matches: false},
+		{expr: "*/15 9-17 * * MON-FRI", at: time.Date(2024, 1, 5, 9, 45, 0, 0, time.UTC), matches: true},
+		{expr: "*/15 9-17 * * MON-FRI", at: time.Date(2024, 1, 6, 9, 45, 0, 0, time.UTC), matches: false}, // Saturday
+		{expr: "30 2 1,15 * *", at: time.Date(2024, 3, 15, 2, 30, 0, 0, time.UTC), matches: true},
+		{expr: "0 0 * * 7", at: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), matches: true}, // 7 = Sunday
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+		}
+		if got := c.Matches(tt.at); got != tt.matches {
+			t.Errorf("%q at %s: expected %v, got %v", tt.expr, tt.at, tt.matches, got)
+		}
+	}
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * * * FUNDAY", "*/0 * * * *"} {
+		if _, err := ParseCron(bad); err == nil {
+			t.Errorf("ParseCron(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSchedule_StatusAt(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	freeze := Window{
+		Start: time.Date(2024, 1, 9, 0, 0, 0, 0, istanbul),
+		End:   time.Date(2024, 1, 10, 0, 0, 0, 0, istanbul),
+	}
+	s := &Schedule{
+		Name:      "game-day",
+		Cron:      "0 10 * * TUE",
+		TimeZone:  "Europe/Istanbul",
+		Duration:  Duration(time.Hour),
+		Rules:     []Rule{{Fault: Fault{FailureRate: 10}}},
+		Blackouts: []Window{freeze},
+		Enabled:   true,
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		active   bool
+		blackout bool
+	}{
+		{name: "Inside window", at: time.Date(2024, 1, 2, 10, 30, 0, 0, istanbul), active: true},
+		{name: "Same instant in UTC", at: time.Date(2024, 1, 2, 7, 59, 0, 0, time.UTC), active: true},
+		{name: "After window", at: time.Date(2024, 1, 2, 11, 0, 0, 0, istanbul), active: false},
+		{name: "Release freeze", at: time.Date(2024, 1, 9, 10, 15, 0, 0, istanbul), active: false, blackout: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := s.StatusAt(tt.at)
+			if status.Active != tt.active {
+				t.Errorf("Expected active=%v, got %v", tt.active, status.Active)
+			}
+			if (status.Blackout != nil) != tt.blackout {
+				t.Errorf("Expected blackout=%v, got %v", tt.blackout, status.Blackout)
+			}
+		})
+	}
+
+	s.Enabled = false
+	if s.StatusAt(time.Date(2024, 1, 2, 10, 30, 0, 0, istanbul)).Active {
+		t.Error("Disabled schedule should never be active")
+	}
+}
+
+func TestSchedule_OverlappingFirings(t *testing.T) {
+	s := &Schedule{Name: "every-10m", Cron: "*/10 * * * *", Duration: Duration(25 * time.Minute), Enabled: true}
+	at := time.Date(2024, 1, 2, 10, 23, 0, 0, time.UTC)
+
+	fired := s.firingsAt(at)
+	if len(fired) != 3 || !fired[0].Equal(time.Date(2024, 1, 2, 10, 20, 0, 0, time.UTC)) || !fired[2].Equal(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the 10:20, 10:10 and 10:00 firings, got %v", fired)
+	}
+	if status := s.StatusAt(at); !status.FiredAt.Equal(fired[0]) {
+		t.Errorf("Expected the status to report the latest firing, got %v", status.FiredAt)
+	}
+}
@@ -0,0 +1,284 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/elliot/chaosProxy/pkg/audit"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+const schedulesKey = "chaos:schedules"
+
+// Scheduler evaluates schedules stored in Redis. Rules of active schedules
+// are served through ActiveRules; experiment schedules start a fresh copy
+// of their template experiment once per firing, across all instances.
+type Scheduler struct {
+	redisClient *redis.Client
+	manager     *Manager
+	auditLog    *audit.Log
+	mu          sync.RWMutex
+	schedules   []*Schedule
+	active      []Rule
+}
+
+func NewScheduler(redisClient *redis.Client, manager *Manager, auditLog *audit.Log) *Scheduler {
+	return &Scheduler{
+		redisClient: redisClient,
+		manager:     manager,
+		auditLog:    auditLog,
+	}
+}
+
+// Run re-evaluates schedules every second until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	schedules, err := s.List(ctx)
+	if err != nil {
+		log.Printf("Failed to load schedules: %v", err)
+		return
+	}
+
+	// No experiments are started while the kill switch is engaged, e.g.
+	// after a steady-state guard halted chaos.
+	killed := false
+	if settings, err := s.redisClient.GetChaosSettings(ctx); err == nil {
+		killed = settings.KillSwitch
+	}
+
+	var active []Rule
+	for _, sched := range schedules {
+		status := sched.StatusAt(now)
+		if !status.Active {
+			if status.Blackout != nil && sched.Experiment != "" {
+				for _, firedAt := range sched.firingsAt(now) {
+					s.abortFired(ctx, sched, firedAt, status.Blackout)
+				}
+			}
+			continue
+		}
+
+		active = append(active, sched.EffectiveRules()...)
+		if sched.Experiment != "" && !killed {
+			s.fireExperiment(ctx, sched, *status.FiredAt, *status.Until)
+		}
+	}
+
+	s.mu.Lock()
+	s.schedules = schedules
+	s.active = active
+	s.mu.Unlock()
+}
+
+// firedKey marks a firing of a schedule. It holds the ID of the experiment
+// started for it, once started.
+func firedKey(sched *Schedule, firedAt time.Time) string {
+	return fmt.Sprintf("chaos:schedules:fired:%s:%d", sched.ID, firedAt.Unix())
+}
+
+// firedAborted marks a firing whose experiment was aborted by a blackout.
+const firedAborted = "aborted"
+
+// fireExperiment starts a copy of the template experiment for this firing.
+// SETNX makes sure only one Sentinel instance does so.
+func (s *Scheduler) fireExperiment(ctx context.Context, sched *Schedule, firedAt, until time.Time) {
+	key := firedKey(sched, firedAt)
+	first, err := s.redisClient.GetRawClient().SetNX(ctx, key, "1", time.Until(until)+time.Minute).Result()
+	if err != nil || !first {
+		return
+	}
+
+	template, err := s.manager.Get(ctx, sched.Experiment)
+	if err != nil {
+		log.Printf("Schedule %q: failed to load experiment %s: %v", sched.Name, sched.Experiment, err)
+		return
+	}
+
+	run := &Experiment{
+		Name:        fmt.Sprintf("%s (%s @ %s)", template.Name, sched.Name, firedAt.Format(time.RFC3339)),
+		Hypothesis:  template.Hypothesis,
+		Rules:       template.Rules,
+		Duration:    Duration(time.Until(until)),
+		Ramp:        template.Ramp,
+		SteadyState: template.SteadyState,
+		GuardWindow: template.GuardWindow,
+	}
+	created, err := s.manager.Create(ctx, run)
+	if err != nil {
+		log.Printf("Schedule %q: failed to create experiment: %v", sched.Name, err)
+		return
+	}
+	// The experiment is only started once the marker holds its ID, so a
+	// blackout that began meanwhile either finds it there or has already
+	// marked the firing aborted.
+	claimed, err := claimFiredScript.Run(ctx, s.redisClient.GetRawClient(), []string{key}, created.ID).Bool()
+	if err != nil || !claimed {
+		reason := "blackout window began"
+		if err != nil {
+			log.Printf("Schedule %q: failed to remember experiment %s: %v", sched.Name, created.ID, err)
+			reason = "schedule could not record the firing"
+		}
+		if _, err := s.manager.Abort(ctx, created.ID, reason); err != nil {
+			log.Printf("Schedule %q: failed to abort experiment %s: %v", sched.Name, created.ID, err)
+		}
+		return
+	}
+	if _, err := s.manager.Start(ctx, created.ID); err != nil {
+		if !errors.Is(err, ErrInvalidTransition) {
+			log.Printf("Schedule %q: failed to start experiment: %v", sched.Name, err)
+		}
+		return // aborted by a blackout in between
+	}
+	log.Printf("⏰ Schedule %q started experiment %q", sched.Name, created.Name)
+
+	entry := audit.Entry{Actor: sched.Name, Source: audit.SourceScheduler, Action: "experiment.start", Target: created.ID + " (" + created.Name + ")"}
+	if err := s.auditLog.Record(ctx, entry); err != nil {
+		log.Printf("Failed to record audit entry: %v", err)
+	}
+}
+
+// ActiveRules returns the rules of every schedule active at the last tick.
+func (s *Scheduler) ActiveRules(now time.Time) []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active
+}
+
+// List returns all schedules sorted by name.
+func (s *Scheduler) List(ctx context.Context) ([]*Schedule, error) {
+	raw, err := s.redisClient.GetRawClient().HGetAll(ctx, schedulesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]*Schedule, 0, len(raw))
+	for id, data := range raw {
+		var sched Schedule
+		if err := json.Unmarshal([]byte(data), &sched); err != nil {
+			log.Printf("Skipping malformed schedule %s: %v", id, err)
+			continue
+		}
+		schedules = append(schedules, &sched)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+	return schedules, nil
+}
+
+// Save validates and stores a schedule, assigning an ID to new ones.
+func (s *Scheduler) Save(ctx context.Context, sched *Schedule) (*Schedule, error) {
+	if err := sched.Validate(); err != nil {
+		return nil, err
+	}
+	if sched.ID == "" {
+		sched.ID = newID()
+	}
+
+	data, err := json.Marshal(sched)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redisClient.GetRawClient().HSet(ctx, schedulesKey, sched.ID, data).Err(); err != nil {
+		return nil, err
+	}
+	return sched, nil
+}
+
+// Delete removes a schedule.
+func (s *Scheduler) Delete(ctx context.Context, id string) error {
+	removed, err := s.redisClient.GetRawClient().HDel(ctx, schedulesKey, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PlanEntry is the dry-run view of one schedule.
+type PlanEntry struct {
+	Schedule *Schedule `json:"schedule"`
+	Status   Status    `json:"status"`
+}
+
+// Plan shows what every schedule would do at t, without side effects.
+func (s *Scheduler) Plan(ctx context.Context, t time.Time) ([]PlanEntry, error) {
+	schedules, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]PlanEntry, 0, len(schedules))
+	for _, sched := range schedules {
+		plan = append(plan, PlanEntry{Schedule: sched, Status: sched.StatusAt(t)})
+	}
+	return plan, nil
+}
+
+// claimFiredScript stores the experiment ID in the marker of a firing that
+// is still starting ("1"). It returns 0 if a blackout marked it aborted.
+var claimFiredScript = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= '1' then return 0 end
+redis.call('SET', KEYS[1], ARGV[1], 'KEEPTTL')
+return 1`)
+
+// swapFiredScript replaces the marker of a firing, if there is one, and
+// returns the old value.
+var swapFiredScript = goredis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then redis.call('SET', KEYS[1], ARGV[1], 'KEEPTTL') end
+return v`)
+
+// abortFired aborts the experiment a schedule started for this firing when
+// a blackout window begins. Swapping the marker makes sure only one
+// Sentinel instance does so, and that the firing is not started again.
+func (s *Scheduler) abortFired(ctx context.Context, sched *Schedule, firedAt time.Time, blackout *Window) {
+	key := firedKey(sched, firedAt)
+	id, err := swapFiredScript.Run(ctx, s.redisClient.GetRawClient(), []string{key}, firedAborted).Text()
+	if err != nil || id == "1" || id == firedAborted {
+		return // not fired, still starting (fireExperiment sees the mark) or already aborted
+	}
+
+	reason := "blackout window began"
+	if blackout.Note != "" {
+		reason += " (" + blackout.Note + ")"
+	}
+	e, err := s.manager.Abort(ctx, id, reason)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidTransition) {
+			log.Printf("Schedule %q: failed to abort experiment %s: %v", sched.Name, id, err)
+		}
+		return
+	}
+	log.Printf("⏰ Schedule %q aborted experiment %q: %s", sched.Name, e.Name, reason)
+
+	entry := audit.Entry{Actor: sched.Name, Source: audit.SourceScheduler, Action: "experiment.abort", Target: e.ID + " (" + e.Name + ")"}
+	if err := s.auditLog.Record(ctx, entry); err != nil {
+		log.Printf("Failed to record audit entry: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+// Package codec decodes and encodes HTTP bodies for traffic capture and
+// Ghost Mode replay.
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings.
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Brotli   = "br"
+)
+
+// supported lists the codings Encode produces, in server preference order.
+var supported = []string{Brotli, Gzip, Deflate}
+
+// Decode undoes the Content-Encoding of body. Codings are removed in reverse
+// order of application. At most limit decoded bytes are returned, so a
+// compressed body cannot expand without bound.
+func Decode(body []byte, contentEncoding string, limit int64) ([]byte, error) {
+	codings := splitCodings(contentEncoding)
+	for i := len(codings) - 1; i >= 0; i-- {
+		r, err := decoder(codings[i], body)
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(io.LimitReader(r, limit))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", codings[i], err)
+		}
+	}
+	return body, nil
+}
+
+func decoder(coding string, body []byte) (io.ReadCloser, error) {
+	switch coding {
+	case Gzip, "x-gzip":
+		return gzip.NewReader(bytes.NewReader(body))
+	case Deflate:
+		// "deflate" is zlib-wrapped, but some servers send raw deflate.
+		if r, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+			return r, nil
+		}
+		return flate.NewReader(bytes.NewReader(body)), nil
+	case Brotli:
+		return io.NopCloser(brotli.NewReader(bytes.NewReader(body))), nil
+	case Identity:
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", coding)
+}
+
+func splitCodings(contentEncoding string) []string {
+	var codings []string
+	for _, c := range strings.Split(contentEncoding, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			codings = append(codings, c)
+		}
+	}
+	return codings
+}
+
+// Encode applies a single content coding to body.
+func Encode(body []byte, coding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "", Identity:
+		return body, nil
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Deflate:
+		w, _ = zlib.NewWriterLevel(&buf, zlib.DefaultCompression)
+	case Brotli:
+		w = brotli.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", coding)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Negotiate picks the coding for a response from an Accept-Encoding header:
+// the supported coding with the highest q-value, ties going to the server
+// preference. It returns Identity if no supported coding is acceptable.
+func Negotiate(acceptEncoding string) string {
+	q := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[coding] = weight
+	}
+
+	best, bestQ := Identity, 0.0
+	for _, coding := range supported {
+		weight, ok := q[coding]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = coding, weight
+		}
+	}
+	return best
+}
+
+// textTypes are media types stored as text besides text/*.
+var textTypes = map[string]bool{
+	"application/json":                  true,
+	"application/xml":                   true,
+	"application/javascript":            true,
+	"application/ecmascript":            true,
+	"application/x-www-form-urlencoded": true,
+	"application/graphql":               true,
+	"application/yaml":                  true,
+	"application/x-yaml":                true,
+	"application/x-ndjson":              true,
+	"image/svg+xml":                     true,
+}
+
+// IsBinary reports whether a body must be stored base64-encoded. The
+// content type decides when it is known; otherwise the body is sniffed.
+func IsBinary(contentType string, body []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case strings.HasPrefix(mediaType, "text/"),
+			textTypes[mediaType],
+			strings.HasSuffix(mediaType, "+json"),
+			strings.HasSuffix(mediaType, "+xml"):
+			return !utf8.Valid(body)
+		case mediaType != "application/octet-stream":
+			return true
+		}
+	}
+	if len(body) == 0 {
+		return false
+	}
+	return !utf8.Valid(body) || !strings.HasPrefix(http.DetectContentType(body), "text/")
+}
@@ -0,0 +1,118 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	body := []byte(strings.Repeat(`{"id": 1, "name": "John"}`, 50))
+
+	for _, coding := range []string{Gzip, Deflate, Brotli, Identity} {
+		t.Run(coding, func(t *testing.T) {
+			encoded, err := Encode(body, coding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if coding != Identity && len(encoded) >= len(body) {
+				t.Errorf("Expected %s to compress, got %d bytes", coding, len(encoded))
+			}
+
+			decoded, err := Decode(encoded, coding, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, body) {
+				t.Errorf("Round trip changed the body")
+			}
+		})
+	}
+}
+
+func TestDecode_Stacked(t *testing.T) {
+	body := []byte("hello")
+	gz, _ := Encode(body, Gzip)
+	both, _ := Encode(gz, Brotli)
+
+	decoded, err := Decode(both, "gzip, br", 1<<20)
+	if err != nil || string(decoded) != "hello" {
+		t.Errorf("Expected stacked codings to be removed in reverse order, got %q, %v", decoded, err)
+	}
+}
+
+func TestDecode_RawDeflate(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write([]byte("raw"))
+	w.Close()
+
+	decoded, err := Decode(buf.Bytes(), "deflate", 1<<20)
+	if err != nil || string(decoded) != "raw" {
+		t.Errorf("Expected raw deflate to decode, got %q, %v", decoded, err)
+	}
+}
+
+func TestDecode_Limit(t *testing.T) {
+	bomb, _ := Encode(make([]byte, 10<<20), Gzip)
+	decoded, err := Decode(bomb, "gzip", 1024)
+	if err != nil || len(decoded) != 1024 {
+		t.Errorf("Expected decoding to stop at the limit, got %d bytes, %v", len(decoded), err)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	if _, err := Decode([]byte("plain"), "gzip", 1<<20); err == nil {
+		t.Error("Expected invalid gzip to fail")
+	}
+	if _, err := Decode([]byte("plain"), "zstd", 1<<20); err == nil {
+		t.Error("Expected an unsupported coding to fail")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                          Identity,
+		"gzip":                      Gzip,
+		"gzip, deflate, br":         Brotli,
+		"gzip;q=1.0, br;q=0.5":      Gzip,
+		"br;q=0, gzip;q=0":          Identity,
+		"*":                         Brotli,
+		"*;q=0.1, deflate":          Deflate,
+		"identity":                  Identity,
+		"GZIP;q=0.8, compress;q=1":  Gzip,
+		"deflate;q=0.5, gzip;q=0.5": Gzip,
+	}
+	for accept, want := range tests {
+		if got := Negotiate(accept); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		contentType string
+		body        []byte
+		binary      bool
+	}{
+		{"application/json; charset=utf-8", []byte(`{"a":1}`), false},
+		{"application/problem+json", []byte(`{"a":1}`), false},
+		{"text/html", []byte("<p>hi</p>"), false},
+		{"image/svg+xml", []byte("<svg/>"), false},
+		{"image/png", png, true},
+		{"application/pdf", []byte("%PDF-1.7"), true},
+		{"text/plain", []byte{0xff, 0xfe, 0x00}, true},
+		{"", []byte("plain text"), false},
+		{"", png, true},
+		{"application/octet-stream", []byte("hello"), false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsBinary(tt.contentType, tt.body); got != tt.binary {
+			t.Errorf("IsBinary(%q, %q) = %v, want %v", tt.contentType, tt.body, got, tt.binary)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Package diff compares recorded and replayed responses structurally, to
+// find what a new build changed.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/elliot/chaosProxy/pkg/redact"
+)
+
+// Change kinds.
+const (
+	Added        = "added"
+	Removed      = "removed"
+	TypeChanged  = "type_changed"
+	ValueChanged = "value_changed"
+)
+
+// Change is one difference between a recorded and a replayed body.
+type Change struct {
+	Path string `json:"path"` // JSONPath, "$" for the whole body
+	Kind string `json:"kind"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// Route adds ignore rules for paths starting with PathPrefix.
+type Route struct {
+	PathPrefix string   `json:"path_prefix" yaml:"path_prefix"`
+	Ignore     []string `json:"ignore" yaml:"ignore"`
+}
+
+// Config lists the volatile fields, such as timestamps and generated IDs,
+// that are not compared. Route rules extend the global ones.
+type Config struct {
+	Ignore []string `json:"ignore,omitempty" yaml:"ignore,omitempty"` // JSONPath, e.g. $..id
+	Routes []Route  `json:"routes,omitempty" yaml:"routes,omitempty"`
+}
+
+// Load reads a YAML ignore rule file. An empty path yields an empty Config.
+func Load(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Differ compares bodies with the ignore rules of their route.
+type Differ struct {
+	ignore []pattern
+	routes []routeRules // longest prefix first
+}
+
+type routeRules struct {
+	prefix string
+	ignore []pattern
+}
+
+// New compiles cfg.
+func New(cfg Config) (*Differ, error) {
+	ignore, err := compileAll(cfg.Ignore)
+	if err != nil {
+		return nil, err
+	}
+	d := &Differ{ignore: ignore}
+	for _, route := range cfg.Routes {
+		if route.PathPrefix == "" {
+			return nil, fmt.Errorf("route rules without path_prefix")
+		}
+		extra, err := compileAll(route.Ignore)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.PathPrefix, err)
+		}
+		d.routes = append(d.routes, routeRules{prefix: route.PathPrefix, ignore: append(append([]pattern(nil), ignore...), extra...)})
+	}
+	sort.SliceStable(d.routes, func(i, j int) bool {
+		return len(d.routes[i].prefix) > len(d.routes[j].prefix)
+	})
+	return d, nil
+}
+
+func compileAll(exprs []string) ([]pattern, error) {
+	patterns := make([]pattern, 0, len(exprs))
+	for _, expr := range exprs {
+		p, err := compilePath(expr)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Compare returns the differences between the recorded and replayed body of
+// a request to path. JSON bodies are compared structurally; other bodies
+// as a whole.
+func (d *Differ) Compare(path string, recorded, replayed []byte) []Change {
+	c := comparer{ignore: d.ignore}
+	for _, route := range d.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			c.ignore = route.ignore
+			break
+		}
+	}
+
+	old, oldErr := decode(recorded)
+	cur, curErr := decode(replayed)
+	switch {
+	case oldErr == nil && curErr == nil:
+		c.values(nil, old, cur)
+	case oldErr != nil && curErr != nil:
+		if !bytes.Equal(recorded, replayed) && !masked(string(recorded)) {
+			c.add(nil, ValueChanged, clip(string(recorded)), clip(string(replayed)))
+		}
+	case oldErr == nil:
+		c.add(nil, TypeChanged, typeName(old), "text")
+	default:
+		c.add(nil, TypeChanged, "text", typeName(cur))
+	}
+	return c.changes
+}
+
+// CompareBinary compares binary bodies, reporting at most one change.
+func CompareBinary(recorded, replayed []byte) []Change {
+	if bytes.Equal(recorded, replayed) {
+		return nil
+	}
+	return []Change{{Path: "$", Kind: ValueChanged, Old: fmt.Sprintf("%d bytes", len(recorded)), New: fmt.Sprintf("%d bytes", len(replayed))}}
+}
+
+type comparer struct {
+	ignore  []pattern
+	changes []Change
+}
+
+func (c *comparer) ignored(path []segment) bool {
+	for _, p := range c.ignore {
+		if p.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *comparer) add(path []segment, kind string, old, cur any) {
+	c.changes = append(c.changes, Change{Path: formatPath(path), Kind: kind, Old: old, New: cur})
+}
+
+func (c *comparer) values(path []segment, old, cur any) {
+	if c.ignored(path) {
+		return
+	}
+	if typeName(old) != typeName(cur) {
+		// Redaction turns any recorded value into a string mask.
+		if s, ok := old.(string); !ok || !masked(s) {
+			c.add(path, TypeChanged, old, cur)
+		}
+		return
+	}
+
+	switch old := old.(type) {
+	case map[string]any:
+		cur := cur.(map[string]any)
+		for _, key := range sortedKeys(old, cur) {
+			child := append(path[:len(path):len(path)], segment{key: key, index: -1})
+			o, inOld := old[key]
+			n, inCur := cur[key]
+			switch {
+			case !inCur:
+				if !c.ignored(child) {
+					c.add(child, Removed, o, nil)
+				}
+			case !inOld:
+				if !c.ignored(child) {
+					c.add(child, Added, nil, n)
+				}
+			default:
+				c.values(child, o, n)
+			}
+		}
+	case []any:
+		cur := cur.([]any)
+		for i := 0; i < len(old) || i < len(cur); i++ {
+			child := append(path[:len(path):len(path)], segment{index: i})
+			switch {
+			case i >= len(cur):
+				if !c.ignored(child) {
+					c.add(child, Removed, old[i], nil)
+				}
+			case i >= len(old):
+				if !c.ignored(child) {
+					c.add(child, Added, nil, cur[i])
+				}
+			default:
+				c.values(child, old[i], cur[i])
+			}
+		}
+	case json.Number:
+		if !equalNumbers(old, cur.(json.Number)) {
+			c.add(path, ValueChanged, old, cur)
+		}
+	case string:
+		if old != cur.(string) && !masked(old) {
+			c.add(path, ValueChanged, old, cur)
+		}
+	default: // bool, nil
+		if old != cur {
+			c.add(path, ValueChanged, old, cur)
+		}
+	}
+}
+
+// decode parses a JSON document, keeping numbers exact.
+func decode(body []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("trailing data")
+	}
+	return v, nil
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// equalNumbers treats 1, 1.0 and 1e0 as equal.
+func equalNumbers(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	x, errA := a.Float64()
+	y, errB := b.Float64()
+	return errA == nil && errB == nil && x == y
+}
+
+// piiToken matches values tokenized by the redaction policy.
+var piiToken = regexp.MustCompile(`\[[A-Z_]+:[0-9a-f]{12}\]`)
+
+// masked reports whether a recorded value was masked before it was logged,
+// so the replayed value cannot be compared with it.
+func masked(s string) bool {
+	return strings.Contains(s, redact.Mask) || piiToken.MatchString(s)
+}
+
+// clip shortens text bodies kept as change examples.
+func clip(s string) string {
+	const max = 200
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "…"
+}
+
+func sortedKeys(a, b map[string]any) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
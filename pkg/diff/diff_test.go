@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompare_Kinds(t *testing.T) {
+	d, _ := New(Config{})
+	recorded := `{"id": 1, "name": "pen", "price": 1.50, "tags": ["a", "b"], "stock": {"count": 3}, "legacy": true}`
+	replayed := `{"id": 1, "name": "Pen", "price": 1.5, "tags": ["a"], "stock": "3", "color": null}`
+
+	got := map[string]string{}
+	for _, c := range d.Compare("/items/1", []byte(recorded), []byte(replayed)) {
+		got[c.Path] = c.Kind
+	}
+	want := map[string]string{
+		"$.name":    ValueChanged,
+		"$.tags[1]": Removed,
+		"$.stock":   TypeChanged,
+		"$.legacy":  Removed,
+		"$.color":   Added,
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d changes, got %v", len(want), got)
+	}
+	for path, kind := range want {
+		if got[path] != kind {
+			t.Errorf("Expected %s at %s, got %q", kind, path, got[path])
+		}
+	}
+}
+
+func TestCompare_IgnoreRules(t *testing.T) {
+	d, err := New(Config{
+		Ignore: []string{"$..id", "$.meta.*", "$['request id']"},
+		Routes: []Route{{PathPrefix: "/api/orders", Ignore: []string{"$.items[*].created_at"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := `{"id": 7, "request id": "a", "meta": {"at": "10:00", "host": "a"}, "items": [{"id": 1, "created_at": "10:00", "qty": 1}]}`
+	replayed := `{"id": 8, "request id": "b", "meta": {"at": "11:00"}, "items": [{"id": 2, "created_at": "11:00", "qty": 2}]}`
+
+	changes := d.Compare("/api/orders/7", []byte(recorded), []byte(replayed))
+	if len(changes) != 1 || changes[0].Path != "$.items[0].qty" || changes[0].Kind != ValueChanged {
+		t.Errorf("Expected only the quantity to change, got %+v", changes)
+	}
+
+	changes = d.Compare("/api/carts/7", []byte(recorded), []byte(replayed))
+	if len(changes) != 2 || changes[0].Path != "$.items[0].created_at" {
+		t.Errorf("Expected route rules to apply only to their prefix, got %+v", changes)
+	}
+}
+
+func TestCompare_MaskedAndText(t *testing.T) {
+	d, _ := New(Config{})
+	recorded := `{"email": "[EMAIL:3f2a9c1b07de]", "token": "[REDACTED]", "card": {"last4": "[REDACTED]"}, "note": "Bearer [REDACTED]"}`
+	replayed := `{"email": "a@example.com", "token": "t0k3n", "card": {"last4": 4242}, "note": "Bearer abc"}`
+	if changes := d.Compare("/me", []byte(recorded), []byte(replayed)); len(changes) != 0 {
+		t.Errorf("Expected masked values to be skipped, got %+v", changes)
+	}
+
+	if changes := d.Compare("/", []byte("ok"), []byte("ok")); len(changes) != 0 {
+		t.Errorf("Expected equal text bodies to match, got %+v", changes)
+	}
+	changes := d.Compare("/", []byte("<h1>v1</h1>"), []byte("<h1>v2</h1>"))
+	if len(changes) != 1 || changes[0].Path != "$" || changes[0].Kind != ValueChanged {
+		t.Errorf("Expected one text change, got %+v", changes)
+	}
+	changes = d.Compare("/", []byte(`{"ok": true}`), []byte("Internal error"))
+	if len(changes) != 1 || changes[0].Kind != TypeChanged || changes[0].Old != "object" {
+		t.Errorf("Expected a type change from JSON to text, got %+v", changes)
+	}
+}
+
+func TestCompilePath(t *testing.T) {
+	path := []segment{{key: "data", index: -1}, {key: "users", index: -1}, {index: 3}, {key: "id", index: -1}}
+	for expr, want := range map[string]bool{
+		"$.data.users[3].id":       true,
+		"$.data.users[*].id":       true,
+		"$..id":                    true,
+		"$..users[*].id":           true,
+		"$.*.users.*.id":           true,
+		`$["data"]['users'][3].id`: true,
+		"$.data.users[2].id":       false,
+		"$.data":                   false,
+		"$..name":                  false,
+	} {
+		p, err := compilePath(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := p.match(path); got != want {
+			t.Errorf("%s: expected match %v, got %v", expr, want, got)
+		}
+	}
+
+	for _, expr := range []string{"data.id", "$.", "$..", "$[x]", "$[1", "$.a b"} {
+		if _, err := compilePath(expr); err == nil {
+			t.Errorf("Expected %q to fail", expr)
+		}
+	}
+
+	if got := formatPath([]segment{{key: "a-b", index: -1}, {index: 0}, {key: "unit price", index: -1}}); got != "$.a-b[0]['unit price']" {
+		t.Errorf("Unexpected path: %s", got)
+	}
+	if keys, err := SplitPath("$.a-b[0]['unit price']"); err != nil || strings.Join(keys, "/") != "a-b/0/unit price" {
+		t.Errorf("Unexpected keys: %q (%v)", keys, err)
+	}
+	if _, err := SplitPath("$..id"); err == nil {
+		t.Error("Expected a pattern not to split into a path")
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := NewReport()
+	r.Add("GET", "/items", nil)
+	r.Add("GET", "/items", []Change{
+		{Path: "$[0].price", Kind: ValueChanged, Old: "1", New: "2"},
+		{Path: "$[1].price", Kind: ValueChanged, Old: "3", New: "4"},
+	})
+	r.Add("GET", "/items", []Change{{Path: "$[4].price", Kind: ValueChanged}, {Path: "$[0].sku", Kind: Removed}})
+	r.Add("POST", "/orders", []Change{{Path: "$.status", Kind: TypeChanged}})
+	r.Finish()
+
+	if r.Compared != 4 || r.Identical != 1 || r.Different != 3 || r.Kinds[ValueChanged] != 3 {
+		t.Errorf("Unexpected totals: %+v", r)
+	}
+	items := r.Routes[0]
+	if items.Path != "/items" || items.Different != 2 || items.Compared != 3 {
+		t.Fatalf("Expected /items first, got %+v", r.Routes)
+	}
+	top := items.Changes[0]
+	if top.Path != "$[*].price" || top.Count != 2 || top.Example.Path != "$[0].price" {
+		t.Errorf("Expected price changes counted once per response, got %+v", items.Changes)
+	}
+	if text := r.Text(); !strings.Contains(text, "GET /items: 2 of 3 differ") || !strings.Contains(text, "$[*].price ×2") {
+		t.Errorf("Unexpected text:\n%s", text)
+	}
+}
+
+func TestRoutePath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/orders/42/items":                        "/api/orders/{id}/items",
+		"/users/3f2a9c1b-07de-4c1e-9a6b-1d2e3f4a5b6c": "/users/{id}",
+		"/blobs/94b5e473e198503b":                     "/blobs/{id}",
+		"/api/v2/search":                              "/api/v2/search",
+		"/":                                           "/",
+	} {
+		if got := RoutePath(path); got != want {
+			t.Errorf("RoutePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
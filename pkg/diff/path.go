@@ -0,0 +1,167 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// segment is one step of a location in a JSON document: an object key or
+// an array index.
+type segment struct {
+	key   string
+	index int // -1 for object keys
+}
+
+// formatPath renders a location as JSONPath, e.g. $.items[2]['unit price'].
+func formatPath(path []segment) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, s := range path {
+		switch {
+		case s.index >= 0:
+			fmt.Fprintf(&b, "[%d]", s.index)
+		case identifier.MatchString(s.key):
+			b.WriteString("." + s.key)
+		default:
+			b.WriteString("['" + strings.ReplaceAll(s.key, "'", `\'`) + "']")
+		}
+	}
+	return b.String()
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// token kinds of a compiled JSONPath.
+const (
+	tokenKey      = iota // .name or ['name']
+	tokenIndex           // [n]
+	tokenWildcard        // .* or [*]
+	tokenDescend         // .., any number of steps
+)
+
+type token struct {
+	kind  int
+	key   string
+	index int
+}
+
+// pattern is a compiled JSONPath ignore rule.
+type pattern []token
+
+// compilePath parses the JSONPath subset used by ignore rules: $ followed by
+// .name, ['name'], [n], .* or [*], and .. for any depth, e.g. $..id or
+// $.items[*].created_at.
+func compilePath(expr string) (pattern, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(expr), "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid JSONPath %q: must start with $", expr)
+	}
+
+	var p pattern
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			p = append(p, token{kind: tokenDescend})
+			rest = rest[2:]
+			if rest == "" || rest[0] == '.' {
+				return nil, fmt.Errorf("invalid JSONPath %q: .. must be followed by a name", expr)
+			}
+			if rest[0] != '[' {
+				rest = "." + rest
+			}
+		case rest[0] == '.':
+			name := rest[1:]
+			if i := strings.IndexAny(name, ".["); i >= 0 {
+				name = name[:i]
+			}
+			if name == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty name", expr)
+			}
+			if strings.ContainsAny(name, " '\"]") {
+				return nil, fmt.Errorf("invalid JSONPath %q: write names with spaces or quotes as ['name']", expr)
+			}
+			if name == "*" {
+				p = append(p, token{kind: tokenWildcard})
+			} else {
+				p = append(p, token{kind: tokenKey, key: name})
+			}
+			rest = rest[1+len(name):]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: missing ]", expr)
+			}
+			inner := rest[1:end]
+			switch {
+			case inner == "*":
+				p = append(p, token{kind: tokenWildcard})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p = append(p, token{kind: tokenKey, key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid JSONPath %q: bad subscript [%s]", expr, inner)
+				}
+				p = append(p, token{kind: tokenIndex, index: n})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", expr, rest)
+		}
+	}
+	return p, nil
+}
+
+// SplitPath returns the keys of a Change path, array indexes as decimal
+// strings: $.items[2]['unit price'] is items, 2, unit price.
+func SplitPath(path string) ([]string, error) {
+	p, err := compilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(p))
+	for i, t := range p {
+		switch t.kind {
+		case tokenKey:
+			keys[i] = t.key
+		case tokenIndex:
+			keys[i] = strconv.Itoa(t.index)
+		default:
+			return nil, fmt.Errorf("invalid change path %q: not a location", path)
+		}
+	}
+	return keys, nil
+}
+
+// match reports whether the pattern selects exactly the location path.
+func (p pattern) match(path []segment) bool {
+	if len(p) == 0 {
+		return len(path) == 0
+	}
+	if p[0].kind == tokenDescend {
+		for i := 0; i <= len(path); i++ {
+			if p[1:].match(path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+
+	s := path[0]
+	switch p[0].kind {
+	case tokenKey:
+		if s.index >= 0 || s.key != p[0].key {
+			return false
+		}
+	case tokenIndex:
+		if s.index != p[0].index {
+			return false
+		}
+	}
+	return p[1:].match(path[1:])
+}
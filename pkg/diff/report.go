@@ -0,0 +1,183 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxRouteChanges bounds the distinct changes listed per route.
+const maxRouteChanges = 50
+
+// Report aggregates the changes found in many responses per route.
+type Report struct {
+	Compared  int            `json:"compared"`
+	Identical int            `json:"identical"`
+	Different int            `json:"different"`
+	Kinds     map[string]int `json:"kinds,omitempty"` // changes by kind
+	Routes    []RouteReport  `json:"routes,omitempty"`
+
+	routes map[string]*routeReport
+}
+
+// RouteReport lists the changes of one method and path, most frequent
+// first.
+type RouteReport struct {
+	Method    string       `json:"method"`
+	Path      string       `json:"path"`
+	Compared  int          `json:"compared"`
+	Different int          `json:"different"`
+	Changes   []ChangeStat `json:"changes,omitempty"`
+}
+
+// ChangeStat counts one kind of change at one location. Array indices in
+// Path are shown as [*], so a change to every item is counted once per
+// response.
+type ChangeStat struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Count   int    `json:"count"`
+	Example Change `json:"example"`
+}
+
+type routeReport struct {
+	compared, different int
+	changes             map[string]*ChangeStat
+}
+
+func NewReport() *Report {
+	return &Report{routes: make(map[string]*routeReport)}
+}
+
+// Add counts the changes found in one response to path, grouped by
+// RoutePath. Calls must not overlap.
+func (r *Report) Add(method, path string, changes []Change) {
+	key := method + " " + RoutePath(path)
+	route, ok := r.routes[key]
+	if !ok {
+		route = &routeReport{changes: make(map[string]*ChangeStat)}
+		r.routes[key] = route
+	}
+
+	r.Compared++
+	route.compared++
+	if len(changes) == 0 {
+		r.Identical++
+		return
+	}
+	r.Different++
+	route.different++
+
+	seen := make(map[string]bool)
+	for _, c := range changes {
+		if r.Kinds == nil {
+			r.Kinds = make(map[string]int)
+		}
+		r.Kinds[c.Kind]++
+
+		at := anyIndex.ReplaceAllString(c.Path, "[*]")
+		id := c.Kind + " " + at
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if stat, ok := route.changes[id]; ok {
+			stat.Count++
+		} else {
+			route.changes[id] = &ChangeStat{Path: at, Kind: c.Kind, Count: 1, Example: c}
+		}
+	}
+}
+
+var anyIndex = regexp.MustCompile(`\[\d+\]`)
+
+// idSegment matches path segments that are identifiers rather than part of
+// the route: numbers, UUIDs and long hex strings.
+var idSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// RoutePath groups the paths of one route, e.g. /orders/42 as /orders/{id}.
+func RoutePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if idSegment.MatchString(seg) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Finish lists the routes, those with the most differing responses first.
+func (r *Report) Finish() {
+	r.Routes = make([]RouteReport, 0, len(r.routes))
+	for key, route := range r.routes {
+		method, path, _ := strings.Cut(key, " ")
+		rr := RouteReport{Method: method, Path: path, Compared: route.compared, Different: route.different}
+		for _, stat := range route.changes {
+			rr.Changes = append(rr.Changes, *stat)
+		}
+		sort.Slice(rr.Changes, func(i, j int) bool {
+			a, b := rr.Changes[i], rr.Changes[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Path+a.Kind < b.Path+b.Kind
+		})
+		if len(rr.Changes) > maxRouteChanges {
+			rr.Changes = rr.Changes[:maxRouteChanges]
+		}
+		r.Routes = append(r.Routes, rr)
+	}
+	sort.Slice(r.Routes, func(i, j int) bool {
+		a, b := r.Routes[i], r.Routes[j]
+		if a.Different != b.Different {
+			return a.Different > b.Different
+		}
+		return a.Method+a.Path < b.Method+b.Path
+	})
+}
+
+// Text renders the differing routes for a terminal.
+func (r *Report) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Bodies: %d compared, %d identical, %d different\n", r.Compared, r.Identical, r.Different)
+	for _, route := range r.Routes {
+		if route.Different == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s %s: %d of %d differ\n", route.Method, route.Path, route.Different, route.Compared)
+		for _, c := range route.Changes {
+			fmt.Fprintf(&b, "    %-13s %s ×%d  (%s)\n", c.Kind, c.Path, c.Count, example(c.Example))
+		}
+	}
+	return b.String()
+}
+
+func example(c Change) string {
+	switch c.Kind {
+	case Added:
+		return "+ " + compact(c.New)
+	case Removed:
+		return "- " + compact(c.Old)
+	}
+	return compact(c.Old) + " → " + compact(c.New)
+}
+
+func compact(v any) string {
+	s := fmt.Sprintf("%v", v)
+	switch v := v.(type) {
+	case string:
+		s = fmt.Sprintf("%q", v)
+	case nil:
+		s = "null"
+	case map[string]any:
+		s = "{…}"
+	case []any:
+		s = fmt.Sprintf("[%d items]", len(v))
+	}
+	if len(s) > 60 {
+		s = s[:60] + "…"
+	}
+	return s
+}
@@ -0,0 +1,357 @@
+// Package har converts captured traffic to and from HAR 1.2, the format
+// browsers and HTTP tools use to exchange recorded sessions.
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/codec"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// Version is the HAR version written by Export.
+const Version = "1.2"
+
+// SourceHAR marks traffic entries imported from a HAR file.
+const SourceHAR = "har"
+
+// HAR is a HAR document. Only the fields Sentinel reads or writes are
+// modelled; custom fields start with an underscore, as the spec requires.
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"` // ms
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	Comment         string    `json:"comment,omitempty"`
+	RequestID       string    `json:"_requestId,omitempty"`
+	Route           string    `json:"_route,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"` // "base64" for binary bodies
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Export converts traffic entries to a HAR document. Request URLs are built
+// from baseURL (e.g. "https://api.example.com") and the entry's path and
+// query.
+func Export(entries []redis.TrafficLog, baseURL string) *HAR {
+	h := &HAR{Log: Log{
+		Version: Version,
+		Creator: Creator{Name: "chaos-proxy", Version: fmt.Sprint(redis.TrafficLogVersion)},
+		Entries: make([]Entry, 0, len(entries)),
+	}}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	for _, e := range entries {
+		u := baseURL + e.Path
+		if e.Query != "" {
+			u += "?" + e.Query
+		}
+
+		entry := Entry{
+			StartedDateTime: e.Timestamp,
+			Time:            e.DurationMs,
+			Request: Request{
+				Method:      e.Method,
+				URL:         u,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []NameValue{},
+				Headers:     nameValues(e.RequestHeaders),
+				QueryString: queryString(e.Query),
+				HeadersSize: -1,
+				BodySize:    len(e.RequestBody),
+			},
+			Response: Response{
+				Status:      e.Status,
+				StatusText:  http.StatusText(e.Status),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []NameValue{},
+				Headers:     nameValues(e.ResponseHeaders),
+				Content: Content{
+					Size:     len(e.ResponseBody),
+					MimeType: header(e.ResponseHeaders, "Content-Type"),
+					Text:     e.ResponseBody,
+				},
+				HeadersSize: -1,
+				BodySize:    len(e.ResponseBody),
+			},
+			Timings:   Timings{Send: 0, Wait: e.DurationMs, Receive: 0},
+			Comment:   comment(e),
+			RequestID: e.RequestID,
+			Route:     e.Route,
+		}
+		if e.RequestBody != "" {
+			entry.Request.PostData = &PostData{MimeType: header(e.RequestHeaders, "Content-Type"), Text: e.RequestBody}
+			if e.RequestBase64 {
+				entry.Request.PostData.Encoding = "base64"
+			}
+		}
+		if e.ResponseBase64 {
+			entry.Response.Content.Encoding = "base64"
+			if raw, err := base64.StdEncoding.DecodeString(e.ResponseBody); err == nil {
+				entry.Response.Content.Size = len(raw)
+			}
+		}
+		if e.ContentEncoding != "" {
+			entry.Response.BodySize = -1 // the encoded size was not recorded
+		}
+		h.Log.Entries = append(h.Log.Entries, entry)
+	}
+	return h
+}
+
+// comment notes what the HAR cannot show about an entry.
+func comment(e redis.TrafficLog) string {
+	var notes []string
+	if e.RequestTruncated || e.ResponseTruncated {
+		notes = append(notes, "body truncated")
+	}
+	if e.Streamed {
+		notes = append(notes, "streamed, body not captured")
+	}
+	if e.BodiesOmitted {
+		notes = append(notes, "bodies omitted by sampling")
+	}
+	if e.Ghost {
+		notes = append(notes, "served by Ghost Mode")
+	}
+	return strings.Join(notes, "; ")
+}
+
+// Decode reads a HAR document.
+func Decode(r io.Reader) (*HAR, error) {
+	var h HAR
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %w", err)
+	}
+	if h.Log.Version == "" {
+		return nil, fmt.Errorf("invalid HAR: missing log.version")
+	}
+	return &h, nil
+}
+
+// Traffic converts the HAR entries for host (any host if empty) to traffic
+// entries, oldest first. Entries without a response, such as blocked or
+// aborted browser requests, are skipped.
+func (h *HAR) Traffic(host string) []redis.TrafficLog {
+	var entries []redis.TrafficLog
+	for _, e := range h.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || e.Response.Status == 0 {
+			continue
+		}
+		if host != "" && u.Host != host && u.Hostname() != host {
+			continue
+		}
+
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		entry := redis.TrafficLog{
+			Version:         redis.TrafficLogVersion,
+			Timestamp:       e.StartedDateTime,
+			RequestID:       e.RequestID,
+			Method:          strings.ToUpper(e.Request.Method),
+			Path:            path,
+			Query:           u.RawQuery,
+			RequestHeaders:  headerMap(e.Request.Headers),
+			Status:          e.Response.Status,
+			ResponseHeaders: headerMap(e.Response.Headers),
+			DurationMs:      e.Time,
+			Duration:        time.Duration(e.Time * float64(time.Millisecond)).String(),
+			Route:           e.Route,
+			Source:          SourceHAR,
+		}
+		if p := e.Request.PostData; p != nil {
+			entry.RequestBody, entry.RequestBase64 = body(p.Text, p.Encoding, p.MimeType)
+		}
+		c := e.Response.Content
+		entry.ResponseBody, entry.ResponseBase64 = body(c.Text, c.Encoding, c.MimeType)
+		// HAR content is already decoded.
+		entry.ContentEncoding = header(entry.ResponseHeaders, "Content-Encoding")
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
+	return entries
+}
+
+// ImportResult summarizes an import through the admin API.
+type ImportResult struct {
+	Entries int `json:"entries"`
+	Ghosts  int `json:"ghosts"`
+}
+
+// Ghost is a ghost response for a method and path.
+type Ghost struct {
+	Method   string
+	Path     string
+	Response redis.GhostResponse
+}
+
+// Ghosts returns a ghost response per method and path from the successful,
+// complete entries; later entries win.
+func Ghosts(entries []redis.TrafficLog) []Ghost {
+	var ghosts []Ghost
+	index := make(map[string]int)
+	for _, e := range entries {
+		if e.Status < 200 || e.Status >= 300 || e.ResponseTruncated || e.Streamed || e.BodiesOmitted {
+			continue
+		}
+		g := Ghost{Method: e.Method, Path: e.Path, Response: redis.GhostResponse{
+			Status:     e.Status,
+			Body:       e.ResponseBody,
+			BodyBase64: e.ResponseBase64,
+			Headers:    e.ResponseHeaders,
+			Timestamp:  e.Timestamp.Format(time.RFC3339Nano),
+		}}
+		if i, ok := index[e.Method+" "+e.Path]; ok {
+			ghosts[i] = g
+			continue
+		}
+		index[e.Method+" "+e.Path] = len(ghosts)
+		ghosts = append(ghosts, g)
+	}
+	return ghosts
+}
+
+// body returns a HAR body as stored in the traffic log: base64 only if it is
+// binary.
+func body(text, encoding, mimeType string) (string, bool) {
+	if encoding != "base64" {
+		return text, false
+	}
+	raw, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return text, false
+	}
+	if codec.IsBinary(mimeType, raw) {
+		return text, true
+	}
+	return string(raw), false
+}
+
+func nameValues(h map[string][]string) []NameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []NameValue{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			out = append(out, NameValue{Name: name, Value: v})
+		}
+	}
+	return out
+}
+
+// headerMap converts HAR headers, dropping HTTP/2 pseudo-headers.
+func headerMap(nv []NameValue) map[string][]string {
+	if len(nv) == 0 {
+		return nil
+	}
+	h := make(map[string][]string)
+	for _, p := range nv {
+		if strings.HasPrefix(p.Name, ":") {
+			continue
+		}
+		name := http.CanonicalHeaderKey(p.Name)
+		h[name] = append(h[name], p.Value)
+	}
+	return h
+}
+
+// queryString splits a raw query in order, keeping masked values readable.
+func queryString(raw string) []NameValue {
+	out := []NameValue{}
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		out = append(out, NameValue{Name: name, Value: value})
+	}
+	return out
+}
+
+func header(h map[string][]string, name string) string {
+	return http.Header(h).Get(name)
+}
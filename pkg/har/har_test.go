@@ -0,0 +1,162 @@
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	ts := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	entries := []redis.TrafficLog{{
+		Version:         redis.TrafficLogVersion,
+		Timestamp:       ts,
+		RequestID:       "abc",
+		Method:          "POST",
+		Path:            "/api/orders",
+		Query:           "page=2&q=a%20b",
+		RequestHeaders:  map[string][]string{"Content-Type": {"application/json"}},
+		RequestBody:     `{"item":1}`,
+		Status:          201,
+		ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}},
+		ResponseBody:    `{"id":7}`,
+		ContentEncoding: "gzip",
+		DurationMs:      12.5,
+		Route:           redis.RouteCanary,
+	}, {
+		Timestamp:       ts.Add(time.Second),
+		Method:          "GET",
+		Path:            "/logo.png",
+		Status:          200,
+		ResponseHeaders: map[string][]string{"Content-Type": {"image/png"}},
+		ResponseBody:    "iVBORw0KGgo=",
+		ResponseBase64:  true,
+	}}
+
+	h := Export(entries, "https://api.example.com/")
+	if h.Log.Version != "1.2" || len(h.Log.Entries) != 2 {
+		t.Fatalf("Unexpected HAR: %+v", h.Log)
+	}
+	first := h.Log.Entries[0]
+	if first.Request.URL != "https://api.example.com/api/orders?page=2&q=a%20b" {
+		t.Errorf("Unexpected URL: %s", first.Request.URL)
+	}
+	if len(first.Request.QueryString) != 2 || first.Request.QueryString[1].Value != "a b" {
+		t.Errorf("Unexpected query string: %+v", first.Request.QueryString)
+	}
+	if first.Response.StatusText != "Created" || first.Response.BodySize != -1 {
+		t.Errorf("Unexpected response: %+v", first.Response)
+	}
+	if c := h.Log.Entries[1].Response.Content; c.Encoding != "base64" || c.Size != 8 {
+		t.Errorf("Expected a base64 image of 8 bytes, got %+v", c)
+	}
+
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(h)
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := decoded.Traffic("")
+	if len(back) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(back))
+	}
+	got := back[0]
+	if got.Method != "POST" || got.Path != "/api/orders" || got.Query != "page=2&q=a%20b" ||
+		got.RequestBody != `{"item":1}` || got.ResponseBody != `{"id":7}` || got.Status != 201 ||
+		got.RequestID != "abc" || got.Route != redis.RouteCanary || got.Source != SourceHAR || !got.Timestamp.Equal(ts) {
+		t.Errorf("Round trip changed the entry: %+v", got)
+	}
+	if !back[1].ResponseBase64 || back[1].ResponseBody != "iVBORw0KGgo=" {
+		t.Errorf("Expected the binary body to stay base64, got %+v", back[1])
+	}
+}
+
+// browserHAR is a trimmed HAR as saved by a browser's developer tools.
+const browserHAR = `{"log": {"version": "1.2", "creator": {"name": "WebInspector", "version": "537.36"}, "entries": [
+  {"startedDateTime": "2025-06-01T10:00:02.000Z", "time": 30,
+   "request": {"method": "GET", "url": "https://app.example.com/api/me", "httpVersion": "h2",
+     "headers": [{"name": ":authority", "value": "app.example.com"}, {"name": "accept", "value": "application/json"}],
+     "queryString": [], "cookies": [], "headersSize": -1, "bodySize": 0},
+   "response": {"status": 200, "statusText": "", "httpVersion": "h2",
+     "headers": [{"name": "content-type", "value": "application/json"}, {"name": "set-cookie", "value": "a=1"}, {"name": "set-cookie", "value": "b=2"}],
+     "content": {"size": 12, "mimeType": "application/json", "text": "eyJpZCI6IDF9", "encoding": "base64"},
+     "redirectURL": "", "cookies": [], "headersSize": -1, "bodySize": 12},
+   "cache": {}, "timings": {"send": 0, "wait": 30, "receive": 0}},
+  {"startedDateTime": "2025-06-01T10:00:01.000Z", "time": 5,
+   "request": {"method": "GET", "url": "https://app.example.com/api/me", "httpVersion": "h2", "headers": [], "queryString": [], "cookies": [], "headersSize": -1, "bodySize": 0},
+   "response": {"status": 200, "statusText": "", "httpVersion": "h2", "headers": [],
+     "content": {"size": 9, "mimeType": "application/json", "text": "{\"id\": 0}"},
+     "redirectURL": "", "cookies": [], "headersSize": -1, "bodySize": 9},
+   "cache": {}, "timings": {"send": 0, "wait": 5, "receive": 0}},
+  {"startedDateTime": "2025-06-01T10:00:03.000Z", "time": 0,
+   "request": {"method": "GET", "url": "https://ads.example.net/pixel", "httpVersion": "", "headers": [], "queryString": [], "cookies": [], "headersSize": -1, "bodySize": 0},
+   "response": {"status": 0, "statusText": "", "httpVersion": "", "headers": [], "content": {"size": 0, "mimeType": ""},
+     "redirectURL": "", "cookies": [], "headersSize": -1, "bodySize": 0},
+   "cache": {}, "timings": {"send": 0, "wait": 0, "receive": 0}},
+  {"startedDateTime": "2025-06-01T10:00:04.000Z", "time": 8,
+   "request": {"method": "get", "url": "https://cdn.example.net/app.js", "httpVersion": "h2", "headers": [], "queryString": [], "cookies": [], "headersSize": -1, "bodySize": 0},
+   "response": {"status": 200, "statusText": "", "httpVersion": "h2", "headers": [],
+     "content": {"size": 2, "mimeType": "text/javascript", "text": "1;"},
+     "redirectURL": "", "cookies": [], "headersSize": -1, "bodySize": 2},
+   "cache": {}, "timings": {"send": 0, "wait": 8, "receive": 0}}
+]}}`
+
+func TestTraffic_BrowserHAR(t *testing.T) {
+	h, err := Decode(strings.NewReader(browserHAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if all := h.Traffic(""); len(all) != 3 {
+		t.Errorf("Expected the aborted request to be skipped, got %d entries", len(all))
+	}
+
+	entries := h.Traffic("app.example.com")
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries for the host, got %d", len(entries))
+	}
+	if entries[0].ResponseBody != `{"id": 0}` {
+		t.Errorf("Expected entries in time order, got %q first", entries[0].ResponseBody)
+	}
+
+	latest := entries[1]
+	if latest.ResponseBody != `{"id": 1}` || latest.ResponseBase64 {
+		t.Errorf("Expected base64 text to be decoded, got %q", latest.ResponseBody)
+	}
+	if _, ok := latest.RequestHeaders[":authority"]; ok || latest.RequestHeaders["Accept"][0] != "application/json" {
+		t.Errorf("Unexpected request headers: %v", latest.RequestHeaders)
+	}
+	if len(latest.ResponseHeaders["Set-Cookie"]) != 2 {
+		t.Errorf("Expected repeated headers to be kept, got %v", latest.ResponseHeaders)
+	}
+
+	ghosts := Ghosts(entries)
+	if len(ghosts) != 1 || ghosts[0].Method != "GET" || ghosts[0].Path != "/api/me" || ghosts[0].Response.Body != `{"id": 1}` {
+		t.Errorf("Expected the latest response as the ghost, got %+v", ghosts)
+	}
+}
+
+func TestGhosts_SkipsIncomplete(t *testing.T) {
+	entries := []redis.TrafficLog{
+		{Method: "GET", Path: "/a", Status: 500},
+		{Method: "GET", Path: "/b", Status: 200, ResponseTruncated: true},
+		{Method: "GET", Path: "/c", Status: 200, Streamed: true},
+		{Method: "GET", Path: "/d", Status: 204},
+	}
+	if ghosts := Ghosts(entries); len(ghosts) != 1 || ghosts[0].Path != "/d" {
+		t.Errorf("Expected only the complete 2xx response, got %+v", ghosts)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, doc := range []string{"", "{}", `{"log": []}`} {
+		if _, err := Decode(strings.NewReader(doc)); err == nil {
+			t.Errorf("Expected %q to fail", doc)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -39,38 +41,198 @@ func (c *Client) GetRawClient() *redis.Client {
 	return c.rdb
 }
 
+// TrafficLogVersion is the current TrafficLog schema version. Version 1
+// entries carry no version field.
+const TrafficLogVersion = 2
+
+// Upstream routes a request can take.
+const (
+	RoutePrimary = "primary"
+	RouteCanary  = "canary"
+	RouteShadow  = "shadow" // mirrored copy, response discarded
+)
+
 type TrafficLog struct {
-	Timestamp        time.Time `json:"timestamp"`
-	Method           string    `json:"method"`
-	Path             string    `json:"path"`
-	RequestBody      string    `json:"request_body"`
-	Status           int       `json:"status"`
-	ResponseBody     string    `json:"response_body"`
-	Duration         string    `json:"duration"`
-	GraphQLOperation string    `json:"graphql_operation,omitempty"`
-}
-
-func (c *Client) PublishTraffic(ctx context.Context, logEntry TrafficLog) error {
-	// 1. Publish to channel for Brain
-	if err := c.rdb.Publish(ctx, "chaos:traffic", logEntry).Err(); err != nil {
-		return err
-	}
+	Version           int                 `json:"version"`
+	Timestamp         time.Time           `json:"timestamp"`
+	RequestID         string              `json:"request_id,omitempty"`
+	ClientIP          string              `json:"client_ip,omitempty"`
+	Method            string              `json:"method"`
+	Path              string              `json:"path"`
+	Query             string              `json:"query,omitempty"`
+	RequestHeaders    map[string][]string `json:"request_headers,omitempty"`
+	RequestBody       string              `json:"request_body"`
+	RequestBase64     bool                `json:"request_body_base64,omitempty"` // binary body, base64-encoded
+	RequestTruncated  bool                `json:"request_body_truncated,omitempty"`
+	Status            int                 `json:"status"`
+	ResponseHeaders   map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody      string              `json:"response_body"`
+	ResponseBase64    bool                `json:"response_body_base64,omitempty"` // binary body, base64-encoded
+	ResponseTruncated bool                `json:"response_body_truncated,omitempty"`
+	Streamed          bool                `json:"streamed,omitempty"`         // streaming or upgraded response, body not captured
+	ContentEncoding   string              `json:"content_encoding,omitempty"` // response Content-Encoding the body was decoded from
+	BodiesOmitted     bool                `json:"bodies_omitted,omitempty"`   // head sampling skipped body capture
+	SampleRate        float64             `json:"sample_rate,omitempty"`      // set when the route is sampled below 1
+	SampleReason      string              `json:"sample_reason,omitempty"`    // sampled, error or slow
+	Source            string              `json:"source,omitempty"`           // where a non-captured entry came from, e.g. har
+	DurationMs        float64             `json:"duration_ms"`
+	Duration          string              `json:"duration"` // human-readable, kept for version 1 consumers
+	Route             string              `json:"route,omitempty"`
+	Upstream          string              `json:"upstream,omitempty"`
+	Ghost             bool                `json:"ghost"`
+	Chaos             []AppliedChaos      `json:"chaos,omitempty"`
+	GraphQLOperation  string              `json:"graphql_operation,omitempty"`
+	Error             string              `json:"error,omitempty"`          // why no response was received
+	PrimaryStatus     int                 `json:"primary_status,omitempty"` // shadow entries: status the client got
+	Changes           []BodyChange        `json:"changes,omitempty"`        // shadow entries: differences from the primary body
+}
+
+// BodyChange records one difference between the primary and shadow bodies.
+type BodyChange struct {
+	Path string      `json:"path"` // JSONPath, "$" for the whole body
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// AppliedChaos records one piece of chaos applied to a request.
+type AppliedChaos struct {
+	Kind   string `json:"kind"` // region, latency, failure, action, request or directive
+	Rule   string `json:"rule,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
 
-	// 2. Store in Recent Logs List (capped at 50)
+// Traffic log keys. Entries are appended to TrafficStream; TrafficChannel
+// is the pub/sub channel used before streams, kept for compatibility.
+const (
+	TrafficStream  = "chaos:traffic:stream"
+	TrafficChannel = "chaos:traffic"
+	recentLogsKey  = "chaos:logs:recent"
+	recentLogsSize = 50
+)
+
+// TrafficStorage sets how PublishTraffic stores entries.
+type TrafficStorage struct {
+	MaxLen int64         // approximate stream length cap, 0 = unbounded
+	MaxAge time.Duration // entries older than this are trimmed, 0 = keep
+	PubSub bool          // also publish on TrafficChannel
+}
+
+// PublishTraffic appends an entry to the traffic stream, trimmed to the
+// storage limits, and to the recent logs list. With storage.PubSub it is
+// also published on TrafficChannel.
+func (c *Client) PublishTraffic(ctx context.Context, logEntry TrafficLog, storage TrafficStorage) error {
 	data, err := json.Marshal(logEntry)
 	if err != nil {
 		return err
 	}
 
 	pipe := c.rdb.Pipeline()
-	pipe.LPush(ctx, "chaos:logs:recent", data)
-	pipe.LTrim(ctx, "chaos:logs:recent", 0, 49) // Keep last 50
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: TrafficStream,
+		MaxLen: storage.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"data": data},
+	})
+	if storage.MaxAge > 0 {
+		// XADD takes a single trimming strategy, so age is trimmed separately.
+		minID := fmt.Sprintf("%d-0", time.Now().Add(-storage.MaxAge).UnixMilli())
+		pipe.XTrimMinIDApprox(ctx, TrafficStream, minID, 0)
+	}
+	pipe.LPush(ctx, recentLogsKey, data)
+	pipe.LTrim(ctx, recentLogsKey, 0, recentLogsSize-1)
+	if storage.PubSub {
+		pipe.Publish(ctx, TrafficChannel, data)
+	}
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
+// TrafficMessage is a traffic log entry read from the stream.
+type TrafficMessage struct {
+	ID    string // stream entry ID
+	Entry TrafficLog
+}
+
+// CreateTrafficGroup creates a consumer group on the traffic stream reading
+// from start ("0" for the retained history, "$" for new entries only). An
+// existing group is left as is.
+func (c *Client) CreateTrafficGroup(ctx context.Context, group, start string) error {
+	err := c.rdb.XGroupCreateMkStream(ctx, TrafficStream, group, start).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// ReadTrafficGroup reads up to count entries for a consumer of group,
+// waiting at most block for new ones. Entries delivered to the consumer but
+// never acknowledged are returned first, so a restarted consumer resumes
+// where it left off. It returns no messages and no error on timeout.
+func (c *Client) ReadTrafficGroup(ctx context.Context, group, consumer string, count int64, block time.Duration) ([]TrafficMessage, error) {
+	for _, id := range []string{"0", ">"} {
+		streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{TrafficStream, id},
+			Count:    count,
+			Block:    block,
+		}).Result()
+		if err == redis.Nil {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if messages := trafficMessages(streams); len(messages) > 0 || id == ">" {
+			return messages, nil
+		}
+	}
+	return nil, nil
+}
+
+// AckTraffic marks entries as processed by group.
+func (c *Client) AckTraffic(ctx context.Context, group string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return c.rdb.XAck(ctx, TrafficStream, group, ids...).Err()
+}
+
+// TrafficRange returns up to count stream entries between start and end
+// (stream IDs, "-" and "+" for the ends), oldest first.
+func (c *Client) TrafficRange(ctx context.Context, start, end string, count int64) ([]TrafficMessage, error) {
+	messages, err := c.rdb.XRangeN(ctx, TrafficStream, start, end, count).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeTraffic(messages), nil
+}
+
+func trafficMessages(streams []redis.XStream) []TrafficMessage {
+	var messages []TrafficMessage
+	for _, stream := range streams {
+		messages = append(messages, decodeTraffic(stream.Messages)...)
+	}
+	return messages
+}
+
+// decodeTraffic decodes stream entries. Entries that cannot be decoded keep
+// their ID with an empty TrafficLog, so they can still be acknowledged.
+func decodeTraffic(messages []redis.XMessage) []TrafficMessage {
+	out := make([]TrafficMessage, 0, len(messages))
+	for _, m := range messages {
+		msg := TrafficMessage{ID: m.ID}
+		if data, ok := m.Values["data"].(string); ok {
+			json.Unmarshal([]byte(data), &msg.Entry)
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
 func (c *Client) GetRecentLogs(ctx context.Context) ([]TrafficLog, error) {
-	data, err := c.rdb.LRange(ctx, "chaos:logs:recent", 0, -1).Result()
+	data, err := c.rdb.LRange(ctx, recentLogsKey, 0, -1).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -85,27 +247,53 @@ func (c *Client) GetRecentLogs(ctx context.Context) ([]TrafficLog, error) {
 	return logs, nil
 }
 
+// GhostResponse is a response learned by the Brain, stored decoded.
+type GhostResponse struct {
+	Status     int                 `json:"status"`
+	Body       string              `json:"body"`
+	BodyBase64 bool                `json:"body_base64,omitempty"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Timestamp  string              `json:"timestamp,omitempty"`
+}
+
+// SaveGhostResponse stores a ghost response in the Brain's format.
+func (c *Client) SaveGhostResponse(ctx context.Context, method, path string, ghost GhostResponse, ttl time.Duration) error {
+	data, err := json.Marshal(ghost)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, fmt.Sprintf("chaos:ghost:%s:%s", method, path), data, ttl).Err()
+}
+
 // GetGhostResponse attempts to fetch a cached response for the given method and path
-func (c *Client) GetGhostResponse(ctx context.Context, method, path string) (*TrafficLog, error) {
+func (c *Client) GetGhostResponse(ctx context.Context, method, path string) (*GhostResponse, error) {
 	key := fmt.Sprintf("chaos:ghost:%s:%s", method, path)
 	data, err := c.rdb.Get(ctx, key).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	var logEntry TrafficLog
-	if err := json.Unmarshal([]byte(data), &logEntry); err != nil {
+	var ghost GhostResponse
+	if err := json.Unmarshal([]byte(data), &ghost); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal ghost response: %w", err)
 	}
-	return &logEntry, nil
+	return &ghost, nil
 }
 
+// ChaosSettingsChannel announces changes to chaos:settings.
+const ChaosSettingsChannel = "chaos:settings:updates"
+
+// chaosSettingsKeyspace receives keyspace notifications for chaos:settings (DB 0).
+const chaosSettingsKeyspace = "__keyspace@0__:chaos:settings"
+
 type ChaosSettings struct {
-	LatencyEnabled bool `json:"latency_enabled"`
-	LatencyMin     int  `json:"latency_min"`
-	LatencyMax     int  `json:"latency_max"`
-	FailureEnabled bool `json:"failure_enabled"`
-	FailureRate    int  `json:"failure_rate"`
+	LatencyEnabled bool  `json:"latency_enabled"`
+	LatencyMin     int   `json:"latency_min"`
+	LatencyMax     int   `json:"latency_max"`
+	FailureEnabled bool  `json:"failure_enabled"`
+	FailureRate    int   `json:"failure_rate"`
+	KillSwitch     bool  `json:"kill_switch"`
+	Version        int64 `json:"version"`
 }
 
 func (c *Client) GetChaosSettings(ctx context.Context) (*ChaosSettings, error) {
@@ -118,17 +306,104 @@ func (c *Client) GetChaosSettings(ctx context.Context) (*ChaosSettings, error) {
 	settings := &ChaosSettings{
 		LatencyEnabled: val["latency_enabled"] == "true",
 		FailureEnabled: val["failure_enabled"] == "true",
+		KillSwitch:     val["kill_switch"] == "true",
 	}
 
 	// Parse ints
 	fmt.Sscanf(val["latency_min"], "%d", &settings.LatencyMin)
 	fmt.Sscanf(val["latency_max"], "%d", &settings.LatencyMax)
 	fmt.Sscanf(val["failure_rate"], "%d", &settings.FailureRate)
+	fmt.Sscanf(val["version"], "%d", &settings.Version)
 
 	return settings, nil
 }
 
+// UpdateChaosSettings writes the given fields, bumps the settings version
+// and notifies every Sentinel through ChaosSettingsChannel.
+func (c *Client) UpdateChaosSettings(ctx context.Context, fields map[string]interface{}) error {
+	pipe := c.rdb.TxPipeline()
+	pipe.HSet(ctx, "chaos:settings", fields)
+	version := pipe.HIncrBy(ctx, "chaos:settings", "version", 1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return c.rdb.Publish(ctx, ChaosSettingsChannel, version.Val()).Err()
+}
+
+// DisableChaos turns off global latency and failure injection.
+func (c *Client) DisableChaos(ctx context.Context) error {
+	return c.UpdateChaosSettings(ctx, map[string]interface{}{
+		"latency_enabled": "false",
+		"failure_enabled": "false",
+	})
+}
+
+// SetKillSwitch engages or releases the kill switch, which suppresses every
+// kind of chaos on every Sentinel until it is released.
+func (c *Client) SetKillSwitch(ctx context.Context, engaged bool) error {
+	return c.UpdateChaosSettings(ctx, map[string]interface{}{
+		"kill_switch": strconv.FormatBool(engaged),
+	})
+}
+
+// EnableKeyspaceNotifications makes Redis announce hash writes, so settings
+// edited directly in Redis are picked up too. Managed Redis services often
+// forbid CONFIG; callers should treat an error as non-fatal.
+func (c *Client) EnableKeyspaceNotifications(ctx context.Context) error {
+	current, err := c.rdb.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+
+	flags := current["notify-keyspace-events"]
+	// "A" already includes hash events; otherwise make sure K and h are set.
+	if !strings.Contains(flags, "A") {
+		for _, f := range []string{"K", "h"} {
+			if !strings.Contains(flags, f) {
+				flags += f
+			}
+		}
+	}
+	if flags == current["notify-keyspace-events"] {
+		return nil
+	}
+	return c.rdb.ConfigSet(ctx, "notify-keyspace-events", flags).Err()
+}
+
+// WatchChaosSettings calls notify whenever chaos:settings may have changed:
+// on explicit announcements ("pubsub"), keyspace notifications ("keyspace")
+// and every (re)subscription, e.g. after a reconnect ("resync").
+// It blocks until ctx is done.
+func (c *Client) WatchChaosSettings(ctx context.Context, notify func(source string)) {
+	pubsub := c.rdb.Subscribe(ctx, ChaosSettingsChannel, chaosSettingsKeyspace)
+	defer pubsub.Close()
+	messages := pubsub.ChannelWithSubscriptions()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-messages:
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				notify("resync")
+			case *redis.Message:
+				if m.Channel == ChaosSettingsChannel {
+					notify("pubsub")
+				} else {
+					notify("keyspace")
+				}
+			}
+		}
+	}
+}
+
 // IsIPBlocked checks if an IP is in the blocklist
 func (c *Client) IsIPBlocked(ctx context.Context, ip string) (bool, error) {
 	return c.rdb.SIsMember(ctx, "chaos:settings:blocked_ips", ip).Result()
 }
+
+// IsNil reports whether err is the "key does not exist" reply.
+func IsNil(err error) bool {
+	return err == redis.Nil
+}
@@ -0,0 +1,181 @@
+// Package live fans published traffic entries out to live subscribers, such
+// as Server-Sent Events clients. Slow subscribers lose entries instead of
+// slowing down the proxy.
+package live
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// ErrTooManySubscribers is returned by Subscribe when the hub is full.
+var ErrTooManySubscribers = errors.New("too many live traffic subscribers")
+
+// Filter selects the entries a subscriber receives. Zero fields match
+// everything.
+type Filter struct {
+	Route       string // primary, canary or shadow
+	StatusClass int    // 2 for 2xx, 5 for 5xx
+	Method      string
+	Path        string // path prefix
+	Ghost       *bool  // only Ghost Mode answers, or none
+	Chaos       *bool  // only requests with chaos applied, or none
+}
+
+// ParseFilter reads a filter from query parameters, e.g.
+// ?route=canary&status=5xx&ghost=true&chaos=false&method=POST&path=/api.
+func ParseFilter(v url.Values) (Filter, error) {
+	f := Filter{Route: v.Get("route"), Method: strings.ToUpper(v.Get("method")), Path: v.Get("path")}
+	switch f.Route {
+	case "", redis.RoutePrimary, redis.RouteCanary, redis.RouteShadow:
+	default:
+		return Filter{}, fmt.Errorf("invalid route %q (want primary, canary or shadow)", f.Route)
+	}
+	if s := v.Get("status"); s != "" {
+		if len(s) != 3 || s[0] < '1' || s[0] > '5' || strings.ToLower(s[1:]) != "xx" {
+			return Filter{}, fmt.Errorf("invalid status class %q (want 1xx to 5xx)", s)
+		}
+		f.StatusClass = int(s[0] - '0')
+	}
+	for name, dst := range map[string]**bool{"ghost": &f.Ghost, "chaos": &f.Chaos} {
+		switch v.Get(name) {
+		case "":
+		case "true":
+			*dst = ptr(true)
+		case "false":
+			*dst = ptr(false)
+		default:
+			return Filter{}, fmt.Errorf("invalid %s %q (want true or false)", name, v.Get(name))
+		}
+	}
+	return f, nil
+}
+
+func ptr(b bool) *bool { return &b }
+
+// Match reports whether entry is selected by f.
+func (f Filter) Match(entry redis.TrafficLog) bool {
+	route := entry.Route
+	if route == "" {
+		route = redis.RoutePrimary
+	}
+	switch {
+	case f.Route != "" && route != f.Route,
+		f.StatusClass > 0 && entry.Status/100 != f.StatusClass,
+		f.Method != "" && entry.Method != f.Method,
+		f.Path != "" && !strings.HasPrefix(entry.Path, f.Path),
+		f.Ghost != nil && entry.Ghost != *f.Ghost,
+		f.Chaos != nil && (len(entry.Chaos) > 0) != *f.Chaos:
+		return false
+	}
+	return true
+}
+
+// Subscriber receives matching entries on C until it unsubscribes.
+type Subscriber struct {
+	C      <-chan redis.TrafficLog
+	ch     chan redis.TrafficLog
+	filter Filter
+
+	dropped atomic.Int64
+}
+
+// Dropped returns and resets the number of entries dropped since the last
+// call because the subscriber fell behind.
+func (s *Subscriber) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Stats reports the subscribers and what they were sent.
+type Stats struct {
+	Subscribers    int   `json:"subscribers"`
+	MaxSubscribers int   `json:"max_subscribers"`
+	Buffer         int   `json:"buffer"`
+	Delivered      int64 `json:"delivered"`
+	Dropped        int64 `json:"dropped"` // subscriber buffer full
+}
+
+// Hub delivers published entries to subscribers. It is a traffic sink.
+type Hub struct {
+	buffer         int
+	maxSubscribers int
+
+	mu   sync.RWMutex
+	subs map[*Subscriber]struct{}
+
+	delivered atomic.Int64
+	dropped   atomic.Int64
+}
+
+// NewHub creates a hub buffering up to buffer entries per subscriber
+// (default 256) for at most maxSubscribers subscribers (default 100).
+func NewHub(buffer, maxSubscribers int) *Hub {
+	if buffer <= 0 {
+		buffer = 256
+	}
+	if maxSubscribers <= 0 {
+		maxSubscribers = 100
+	}
+	return &Hub{buffer: buffer, maxSubscribers: maxSubscribers, subs: make(map[*Subscriber]struct{})}
+}
+
+// Subscribe registers a subscriber for the entries matching f.
+func (h *Hub) Subscribe(f Filter) (*Subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs) >= h.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	ch := make(chan redis.TrafficLog, h.buffer)
+	s := &Subscriber{C: ch, ch: ch, filter: f}
+	h.subs[s] = struct{}{}
+	return s, nil
+}
+
+// Unsubscribe removes s. Its channel is not closed, as a publish may be in
+// flight.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, s)
+}
+
+// WriteTraffic delivers entry to every matching subscriber without
+// blocking: a subscriber whose buffer is full loses the entry.
+func (h *Hub) WriteTraffic(ctx context.Context, entry redis.TrafficLog) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		if !s.filter.Match(entry) {
+			continue
+		}
+		select {
+		case s.ch <- entry:
+			h.delivered.Add(1)
+		default:
+			s.dropped.Add(1)
+			h.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Stats returns the hub counters.
+func (h *Hub) Stats() Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return Stats{
+		Subscribers:    len(h.subs),
+		MaxSubscribers: h.maxSubscribers,
+		Buffer:         h.buffer,
+		Delivered:      h.delivered.Load(),
+		Dropped:        h.dropped.Load(),
+	}
+}
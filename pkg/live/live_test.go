@@ -0,0 +1,74 @@
+package live
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+func TestParseFilter(t *testing.T) {
+	f, err := ParseFilter(url.Values{"route": {"canary"}, "status": {"5xx"}, "ghost": {"false"}, "chaos": {"true"}, "method": {"post"}, "path": {"/api"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := redis.TrafficLog{Method: "POST", Path: "/api/orders", Status: 503, Route: "canary", Chaos: []redis.AppliedChaos{{Kind: "error"}}}
+	if !f.Match(match) {
+		t.Errorf("Expected %+v to match %+v", match, f)
+	}
+	for name, change := range map[string]func(*redis.TrafficLog){
+		"route":  func(e *redis.TrafficLog) { e.Route = "" },
+		"status": func(e *redis.TrafficLog) { e.Status = 200 },
+		"ghost":  func(e *redis.TrafficLog) { e.Ghost = true },
+		"chaos":  func(e *redis.TrafficLog) { e.Chaos = nil },
+		"method": func(e *redis.TrafficLog) { e.Method = "GET" },
+		"path":   func(e *redis.TrafficLog) { e.Path = "/healthz" },
+	} {
+		e := match
+		change(&e)
+		if f.Match(e) {
+			t.Errorf("Expected a different %s not to match", name)
+		}
+	}
+
+	if f, _ := ParseFilter(url.Values{"route": {"primary"}}); !f.Match(redis.TrafficLog{}) {
+		t.Error("Expected entries without a route to count as primary")
+	}
+	for _, q := range []url.Values{{"route": {"blue"}}, {"status": {"500"}}, {"status": {"9xx"}}, {"ghost": {"yes"}}} {
+		if _, err := ParseFilter(q); err == nil {
+			t.Errorf("Expected %v to fail", q)
+		}
+	}
+}
+
+func TestHub_DropsForSlowSubscribers(t *testing.T) {
+	h := NewHub(2, 2)
+	slow, _ := h.Subscribe(Filter{})
+	failures, _ := h.Subscribe(Filter{StatusClass: 5})
+	if _, err := h.Subscribe(Filter{}); err != ErrTooManySubscribers {
+		t.Errorf("Expected the hub to be full, got %v", err)
+	}
+
+	for _, status := range []int{200, 500, 200, 502} {
+		h.WriteTraffic(context.Background(), redis.TrafficLog{Status: status})
+	}
+	if n := slow.Dropped(); n != 2 {
+		t.Errorf("Expected the slow subscriber to lose 2 entries, got %d", n)
+	}
+	if n := slow.Dropped(); n != 0 {
+		t.Errorf("Expected Dropped to reset, got %d", n)
+	}
+	if len(failures.C) != 2 || failures.Dropped() != 0 {
+		t.Errorf("Expected the filtered subscriber to get both errors, got %d", len(failures.C))
+	}
+	if stats := h.Stats(); stats.Subscribers != 2 || stats.Delivered != 4 || stats.Dropped != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	h.Unsubscribe(slow)
+	h.WriteTraffic(context.Background(), redis.TrafficLog{Status: 200})
+	if stats := h.Stats(); stats.Subscribers != 1 || stats.Dropped != 2 {
+		t.Errorf("Expected an unsubscribed subscriber to get nothing, got %+v", stats)
+	}
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSamplesPerBucket caps the latency samples kept per second so memory
+// stays bounded at high RPS. Percentiles are computed from these samples.
+const maxSamplesPerBucket = 512
+
+type bucket struct {
+	second    int64
+	requests  int
+	errors    int
+	ghosts    int
+	latencies []time.Duration
+}
+
+// Snapshot is the steady state of proxied traffic over the window.
+type Snapshot struct {
+	Requests     int     `json:"requests"`
+	ErrorRate    float64 `json:"error_rate"` // percent of 5xx responses
+	GhostRate    float64 `json:"ghost_rate"` // percent served by Ghost Mode
+	P50LatencyMs float64 `json:"p50_latency_ms"`
+	P99LatencyMs float64 `json:"p99_latency_ms"`
+}
+
+// Value returns the metric with the given name, e.g. "p99_latency_ms".
+func (s Snapshot) Value(name string) (float64, bool) {
+	switch name {
+	case "error_rate":
+		return s.ErrorRate, true
+	case "ghost_rate":
+		return s.GhostRate, true
+	case "p50_latency_ms":
+		return s.P50LatencyMs, true
+	case "p99_latency_ms":
+		return s.P99LatencyMs, true
+	}
+	return 0, false
+}
+
+// Window aggregates request outcomes over a sliding window of one-second buckets.
+type Window struct {
+	mu      sync.Mutex
+	buckets []bucket
+}
+
+func NewWindow(size time.Duration) *Window {
+	seconds := int(size / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &Window{buckets: make([]bucket, seconds)}
+}
+
+// Record adds a single request outcome.
+func (w *Window) Record(now time.Time, d time.Duration, status int, ghost bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sec := now.Unix()
+	b := &w.buckets[sec%int64(len(w.buckets))]
+	if b.second != sec {
+		*b = bucket{second: sec, latencies: b.latencies[:0]}
+	}
+
+	b.requests++
+	if status >= 500 {
+		b.errors++
+	}
+	if ghost {
+		b.ghosts++
+	}
+	if len(b.latencies) < maxSamplesPerBucket {
+		b.latencies = append(b.latencies, d)
+	}
+}
+
+// Snapshot computes the steady state over the window ending at now.
+func (w *Window) Snapshot(now time.Time) Snapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var (
+		s         Snapshot
+		errors    int
+		ghosts    int
+		latencies []time.Duration
+	)
+
+	oldest := now.Unix() - int64(len(w.buckets)) + 1
+	for _, b := range w.buckets {
+		if b.second < oldest || b.second > now.Unix() {
+			continue
+		}
+		s.Requests += b.requests
+		errors += b.errors
+		ghosts += b.ghosts
+		latencies = append(latencies, b.latencies...)
+	}
+
+	if s.Requests == 0 {
+		return s
+	}
+
+	s.ErrorRate = float64(errors) * 100 / float64(s.Requests)
+	s.GhostRate = float64(ghosts) * 100 / float64(s.Requests)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	s.P50LatencyMs = percentile(latencies, 0.50)
+	s.P99LatencyMs = percentile(latencies, 0.99)
+	return s
+}
+
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return float64(sorted[idx]) / float64(time.Millisecond)
+}
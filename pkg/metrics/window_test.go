@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow_Snapshot(t *testing.T) {
+	w := NewWindow(10 * time.Second)
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 100; i++ {
+		status := 200
+		if i%10 == 0 {
+			status = 503
+		}
+		w.Record(now, time.Duration(i)*time.Millisecond, status, i%20 == 0)
+	}
+
+	s := w.Snapshot(now)
+	if s.Requests != 100 {
+		t.Fatalf("Expected 100 requests, got %d", s.Requests)
+	}
+	if s.ErrorRate != 10 {
+		t.Errorf("Expected error rate 10, got %v", s.ErrorRate)
+	}
+	if s.GhostRate != 5 {
+		t.Errorf("Expected ghost rate 5, got %v", s.GhostRate)
+	}
+	if s.P99LatencyMs != 99 {
+		t.Errorf("Expected p99 99ms, got %v", s.P99LatencyMs)
+	}
+}
+
+func TestWindow_Expiry(t *testing.T) {
+	w := NewWindow(5 * time.Second)
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	w.Record(now, time.Millisecond, 500, false)
+	w.Record(now.Add(6*time.Second), time.Millisecond, 200, false)
+
+	s := w.Snapshot(now.Add(6 * time.Second))
+	if s.Requests != 1 || s.ErrorRate != 0 {
+		t.Errorf("Old bucket should have expired, got %+v", s)
+	}
+}
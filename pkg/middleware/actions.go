@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+)
+
+// ChaosAction produces a protocol-semantic fault. Actions that alter a real
+// backend response call next; the others answer on their own.
+type ChaosAction func(w http.ResponseWriter, r *http.Request, next http.Handler)
+
+// chaosActions implements every action in chaos.Actions.
+var chaosActions = map[string]ChaosAction{
+	chaos.ActionAuthExpiry:   AuthExpiry,
+	chaos.ActionThrottle:     Throttle,
+	chaos.ActionStaleETag:    StaleETag,
+	chaos.ActionRedirectLoop: RedirectLoop,
+	chaos.ActionSessionLoss:  SessionLoss,
+	chaos.ActionClockSkew:    ClockSkew,
+}
+
+// AuthExpiry rejects the request as if its access token had just expired,
+// to exercise token refresh.
+func AuthExpiry(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="sentinel", error="invalid_token", error_description="The access token expired"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error": "invalid_token"}`))
+}
+
+// Throttle answers 429 with a Retry-After that varies between 1 and 30
+// seconds, sent either as delay-seconds or as an HTTP date.
+func Throttle(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	retryAfter := time.Duration(rand.Intn(30)+1) * time.Second
+	if rand.Intn(2) == 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+	} else {
+		w.Header().Set("Retry-After", time.Now().Add(retryAfter).UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("X-RateLimit-Remaining", "0")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(`{"error": "Too Many Requests"}`))
+}
+
+// StaleETag answers 304 Not Modified with an ETag that matches nothing the
+// client has cached, whether or not the request was conditional.
+func StaleETag(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	w.Header().Set("ETag", fmt.Sprintf(`W/"stale-%08x"`, rand.Uint32()))
+	w.Header().Set("Cache-Control", "max-age=0")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// RedirectLoop redirects the request back to its own URL. 307 keeps the
+// method and body, so every kind of request loops.
+func RedirectLoop(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	w.Header().Set("Location", r.URL.RequestURI())
+	w.WriteHeader(http.StatusTemporaryRedirect)
+}
+
+// SessionLoss forwards the request without its cookies and expires every
+// cookie the client sent, as if the server had forgotten the session.
+func SessionLoss(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	for _, c := range r.Cookies() {
+		http.SetCookie(w, &http.Cookie{Name: c.Name, Value: "", Path: "/", MaxAge: -1})
+	}
+	r.Header.Del("Cookie")
+	next.ServeHTTP(w, r)
+}
+
+// ClockSkew forwards the request and skews the response's Date header by
+// 10 minutes to 24 hours in either direction.
+func ClockSkew(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	skew := time.Duration(rand.Int63n(int64(24*time.Hour-10*time.Minute))) + 10*time.Minute
+	if rand.Intn(2) == 0 {
+		skew = -skew
+	}
+
+	next.ServeHTTP(&headerHookWriter{ResponseWriter: w, hook: func(h http.Header) {
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		h.Set("Date", date.Add(skew).UTC().Format(http.TimeFormat))
+	}}, r)
+}
+
+// headerHookWriter calls hook on the response headers just before they are sent.
+type headerHookWriter struct {
+	http.ResponseWriter
+	hook        func(h http.Header)
+	wroteHeader bool
+}
+
+func (hw *headerHookWriter) WriteHeader(code int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		hw.hook(hw.Header())
+	}
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *headerHookWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+func (hw *headerHookWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+})
+
+func TestChaosActions_Complete(t *testing.T) {
+	for _, name := range chaos.Actions {
+		if _, ok := chaosActions[name]; !ok {
+			t.Errorf("Action %q has no implementation", name)
+		}
+	}
+	if len(chaosActions) != len(chaos.Actions) {
+		t.Errorf("Expected %d actions, got %d", len(chaos.Actions), len(chaosActions))
+	}
+}
+
+func TestAuthExpiry(t *testing.T) {
+	rec := httptest.NewRecorder()
+	AuthExpiry(rec, httptest.NewRequest("GET", "/", nil), okHandler)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rec.Code)
+	}
+	if h := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(h, "Bearer ") || !strings.Contains(h, `error="invalid_token"`) {
+		t.Errorf("Unexpected WWW-Authenticate: %q", h)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		Throttle(rec, httptest.NewRequest("GET", "/", nil), okHandler)
+
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected status 429, got %d", rec.Code)
+		}
+
+		retryAfter := rec.Header().Get("Retry-After")
+		seen[retryAfter] = true
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			if secs < 1 || secs > 30 {
+				t.Errorf("Retry-After %d out of range", secs)
+			}
+			continue
+		}
+		date, err := http.ParseTime(retryAfter)
+		if err != nil {
+			t.Fatalf("Retry-After %q is neither seconds nor an HTTP date", retryAfter)
+		}
+		if wait := time.Until(date); wait > 31*time.Second {
+			t.Errorf("Retry-After date %s too far in the future", retryAfter)
+		}
+	}
+	if len(seen) < 2 {
+		t.Error("Expected Retry-After to vary")
+	}
+}
+
+func TestStaleETag(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	rec := httptest.NewRecorder()
+	StaleETag(rec, req, okHandler)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", rec.Code)
+	}
+	if etag := rec.Header().Get("ETag"); etag == "" || etag == `"v1"` {
+		t.Errorf("Expected a stale ETag, got %q", etag)
+	}
+	if rec.Body.Len() != 0 {
+		t.Error("Expected an empty body")
+	}
+}
+
+func TestRedirectLoop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RedirectLoop(w, r, okHandler)
+	}))
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/orders?page=2")
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("Expected the client to give up on the redirect loop, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	RedirectLoop(rec, httptest.NewRequest("POST", "/orders?page=2", nil), okHandler)
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "/orders?page=2" {
+		t.Errorf("Unexpected redirect: %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestSessionLoss(t *testing.T) {
+	var backendCookies string
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendCookies = r.Header.Get("Cookie")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	req.AddCookie(&http.Cookie{Name: "csrf", Value: "xyz"})
+	rec := httptest.NewRecorder()
+	SessionLoss(rec, req, backend)
+
+	if backendCookies != "" {
+		t.Errorf("Expected cookies to be stripped, backend saw %q", backendCookies)
+	}
+
+	expired := map[string]bool{}
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge < 0 && c.Value == "" {
+			expired[c.Name] = true
+		}
+	}
+	if !expired["session"] || !expired["csrf"] {
+		t.Errorf("Expected both cookies to be expired, got %v", rec.Header().Values("Set-Cookie"))
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", now.Format(http.TimeFormat))
+		w.Write([]byte("OK"))
+	})
+
+	rec := httptest.NewRecorder()
+	ClockSkew(rec, httptest.NewRequest("GET", "/", nil), backend)
+
+	if rec.Body.String() != "OK" {
+		t.Errorf("Expected the backend response, got %q", rec.Body.String())
+	}
+	if values := rec.Header().Values("Date"); len(values) != 1 {
+		t.Fatalf("Expected exactly one Date header, got %v", values)
+	}
+	date, err := http.ParseTime(rec.Header().Get("Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	skew := date.Sub(now)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew < 10*time.Minute || skew > 24*time.Hour {
+		t.Errorf("Skew %s out of range", skew)
+	}
+}
+
+func TestChaos_Action(t *testing.T) {
+	c := NewChaosMiddleware(nil, "", "")
+	c.AddRuleSource(staticRules{{
+		Name:  "tokens",
+		Fault: chaos.Fault{FailureRate: 100, Action: chaos.ActionAuthExpiry},
+	}})
+
+	rec := httptest.NewRecorder()
+	c.Chaos(okHandler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the auth_expiry action to answer 401, got %d", rec.Code)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
 )
 
 // NewCanary returns a middleware that routes traffic to a canary URL based on weight.
@@ -34,6 +36,7 @@ func NewCanary(canaryURL string, weight int) Middleware {
 	canaryProxy.Director = func(req *http.Request) {
 		originalDirector(req)
 		req.Host = target.Host
+		TrafficMetaFrom(req.Context()).SetUpstream(redis.RouteCanary, target.String())
 	}
 
 	log.Printf("🐤 Canary Routing Enabled: targeting %s with %d%% weight", canaryURL, weight)
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// streamingTypes are response media types whose bodies are never captured.
+var streamingTypes = []string{
+	"text/event-stream",
+	"multipart/x-mixed-replace",
+	"application/x-ndjson",
+	"application/grpc",
+}
+
+func isStreaming(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range streamingTypes {
+		if mediaType == t || strings.HasPrefix(mediaType, t+"+") {
+			return true
+		}
+	}
+	return false
+}
+
+// captureWriter tees at most limit bytes of the response body. Streaming and
+// upgraded responses are passed through without capture. Flush, Hijack and
+// ReadFrom reach the underlying writer through http.ResponseController.
+type captureWriter struct {
+	http.ResponseWriter
+	limit       int
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	truncated   bool
+	streamed    bool // streaming content type, upgrade or hijack
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int) *captureWriter {
+	return &captureWriter{ResponseWriter: w, limit: limit, statusCode: http.StatusOK}
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	if !cw.wroteHeader && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		cw.wroteHeader = true
+		cw.statusCode = code
+		if code == http.StatusSwitchingProtocols || isStreaming(cw.Header().Get("Content-Type")) {
+			cw.streamed = true
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.tee(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+// tee captures b up to the limit. A limit of 0 captures nothing.
+func (cw *captureWriter) tee(b []byte) {
+	if cw.streamed || cw.truncated || cw.limit <= 0 {
+		return
+	}
+	if room := cw.limit - cw.body.Len(); len(b) > room {
+		cw.body.Write(b[:room])
+		cw.truncated = true
+		return
+	}
+	cw.body.Write(b)
+}
+
+func (cw *captureWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.streamed {
+		src = io.TeeReader(src, teeWriter{cw})
+	}
+	return io.Copy(cw.ResponseWriter, src)
+}
+
+func (cw *captureWriter) Flush() {
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *captureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	cw.streamed = true
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// teeWriter feeds a captureWriter's buffer without writing the response.
+type teeWriter struct{ cw *captureWriter }
+
+func (t teeWriter) Write(b []byte) (int, error) {
+	t.cw.tee(b)
+	return len(b), nil
+}
+
+// captureRequestBody reads at most limit bytes of the request body for the
+// traffic log and leaves the full body readable for the handler.
+func captureRequestBody(r *http.Request, limit int) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+
+	buf, _ := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+
+	if len(buf) > limit {
+		return buf[:limit], true
+	}
+	return buf, false
+}
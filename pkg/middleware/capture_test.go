@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureWriter_Truncates(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := newCaptureWriter(rec, 8)
+	cw.Write([]byte("hello "))
+	cw.Write([]byte("world"))
+
+	if rec.Body.String() != "hello world" {
+		t.Errorf("Expected the full body to reach the client, got %q", rec.Body.String())
+	}
+	if cw.body.String() != "hello wo" || !cw.truncated {
+		t.Errorf("Expected 8 captured bytes and the truncated flag, got %q (%v)", cw.body.String(), cw.truncated)
+	}
+}
+
+func TestCaptureWriter_ReadFrom(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := newCaptureWriter(rec, 4)
+
+	n, err := io.Copy(cw, strings.NewReader("streamed body"))
+	if err != nil || n != 13 || rec.Body.String() != "streamed body" {
+		t.Fatalf("Unexpected copy: %d, %v, %q", n, err, rec.Body.String())
+	}
+	if cw.body.String() != "stre" || !cw.truncated || cw.statusCode != http.StatusOK {
+		t.Errorf("Unexpected capture: %q (%v), status %d", cw.body.String(), cw.truncated, cw.statusCode)
+	}
+}
+
+func TestCaptureWriter_SkipsStreaming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := newCaptureWriter(rec, 1024)
+	cw.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	cw.Write([]byte("data: 1\n\n"))
+
+	if !cw.streamed || cw.body.Len() != 0 {
+		t.Errorf("Expected an event stream not to be captured, got %q", cw.body.String())
+	}
+}
+
+func TestCaptureWriter_Flush(t *testing.T) {
+	// Through the whole traffic chain, each event must reach the client
+	// before the handler returns.
+	release := make(chan struct{})
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		http.NewResponseController(w).Flush()
+		<-release
+	}), Logger, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(newCaptureWriter(w, 1024), r)
+		})
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer close(release)
+
+	line := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			line <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		s, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case got := <-line:
+		if got != "data: first\n" {
+			t.Errorf("Unexpected event: %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the flushed event before the handler returned")
+	}
+}
+
+func TestCaptureWriter_Hijack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := newCaptureWriter(&responseWriter{ResponseWriter: w}, 1024)
+		conn, brw, err := cw.Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		if !cw.streamed {
+			t.Error("Expected a hijacked connection not to be captured")
+		}
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\npong")
+		brw.Flush()
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(resp.Body.(io.ReadWriteCloser), buf); err != nil || string(buf) != "pong" {
+		t.Errorf("Expected the upgraded stream, got %q, %v", buf, err)
+	}
+}
+
+func TestCaptureRequestBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("0123456789"))
+	captured, truncated := captureRequestBody(req, 4)
+	if string(captured) != "0123" || !truncated {
+		t.Errorf("Expected 4 captured bytes and the truncated flag, got %q (%v)", captured, truncated)
+	}
+
+	rest, _ := io.ReadAll(req.Body)
+	if string(rest) != "0123456789" {
+		t.Errorf("Expected the handler to read the full body, got %q", rest)
+	}
+
+	if captured, truncated := captureRequestBody(httptest.NewRequest("GET", "/", nil), 4); captured != nil || truncated {
+		t.Errorf("Expected nothing captured without a body, got %q", captured)
+	}
+}
@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/cassette"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/redact"
+)
+
+// HeaderCassette marks responses answered from a cassette ("hit") and
+// playback misses ("miss").
+const HeaderCassette = "X-Chaos-Cassette"
+
+// maxRecentMisses bounds the misses listed in CassetteStats.
+const maxRecentMisses = 20
+
+// CassetteConfig selects the cassette mode and how requests are matched.
+type CassetteConfig struct {
+	Mode    string // cassette.ModeOff, ModeRecord or ModePlayback
+	Dir     string
+	Matcher cassette.Matcher
+	MaxBody int // exchanges with larger bodies are not recorded, 0 = 10MB
+
+	// Redactor selects the response headers left out of recorded
+	// cassettes, such as Set-Cookie; nil uses the default policy.
+	Redactor *redact.Redactor
+}
+
+// CassetteStats reports what the cassettes answered or recorded.
+type CassetteStats struct {
+	Mode         string   `json:"mode"`
+	Dir          string   `json:"dir"`
+	Interactions int      `json:"interactions"`
+	Hits         int64    `json:"hits"`
+	Misses       int64    `json:"misses"`
+	Recorded     int64    `json:"recorded"`
+	Skipped      int64    `json:"skipped"` // not recorded: too large, streamed, ghost, chaos or cassette full
+	RecentMisses []string `json:"recent_misses,omitempty"`
+}
+
+// Cassette records proxied exchanges to cassette files or answers requests
+// from them, so tests get a hermetic backend captured from a real one.
+type Cassette struct {
+	cfg   CassetteConfig
+	store *cassette.Store
+
+	hits     atomic.Int64
+	misses   atomic.Int64
+	recorded atomic.Int64
+	skipped  atomic.Int64
+
+	mu           sync.Mutex
+	recentMisses []string
+}
+
+// NewCassette opens the cassette directory. Playback fails if it cannot be
+// read; record creates it. With the mode off, Handler passes requests
+// through.
+func NewCassette(cfg CassetteConfig) (*Cassette, error) {
+	if cfg.MaxBody <= 0 {
+		cfg.MaxBody = 10 * 1024 * 1024
+	}
+	if cfg.Redactor == nil {
+		cfg.Redactor, _ = redact.New(redact.Config{})
+	}
+	c := &Cassette{cfg: cfg}
+
+	var err error
+	switch cfg.Mode {
+	case "", cassette.ModeOff:
+		return c, nil
+	case cassette.ModeRecord:
+		c.store, err = cassette.NewStore(cfg.Dir, cfg.Matcher)
+	case cassette.ModePlayback:
+		c.store, err = cassette.Load(cfg.Dir, cfg.Matcher)
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q (want off, record or playback)", cfg.Mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cassettes in %s: %w", cfg.Dir, err)
+	}
+	return c, nil
+}
+
+// Stats returns the cassette counters.
+func (c *Cassette) Stats() CassetteStats {
+	stats := CassetteStats{
+		Mode:     c.cfg.Mode,
+		Dir:      c.cfg.Dir,
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Recorded: c.recorded.Load(),
+		Skipped:  c.skipped.Load(),
+	}
+	if stats.Mode == "" {
+		stats.Mode = cassette.ModeOff
+	}
+	if c.store != nil {
+		stats.Interactions = c.store.Len()
+	}
+	c.mu.Lock()
+	stats.RecentMisses = append([]string(nil), c.recentMisses...)
+	c.mu.Unlock()
+	return stats
+}
+
+// Run writes recorded cassettes in the background until ctx is done. It
+// returns at once unless recording.
+func (c *Cassette) Run(ctx context.Context) {
+	if c.cfg.Mode == cassette.ModeRecord {
+		c.store.Run(ctx)
+	}
+}
+
+// Handler records the exchanges of next, or answers from the cassettes
+// without calling next.
+func (c *Cassette) Handler(next http.Handler) http.Handler {
+	switch c.cfg.Mode {
+	case cassette.ModeRecord:
+		log.Printf("📼 Cassette Recording: writing exchanges to %s", c.cfg.Dir)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { c.record(next, w, r) })
+	case cassette.ModePlayback:
+		log.Printf("📼 Cassette Playback: answering from %d exchanges in %s, misses fail", c.store.Len(), c.cfg.Dir)
+		return http.HandlerFunc(c.play)
+	}
+	return next
+}
+
+// request builds the cassette request for r: only the matched headers are
+// kept.
+func (c *Cassette) request(r *http.Request, body []byte) cassette.Request {
+	req := cassette.Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Body:   cassette.NewBody(body, r.Header.Get("Content-Type")),
+	}
+	for _, name := range c.cfg.Matcher.Headers {
+		if values := r.Header.Values(name); len(values) > 0 {
+			if req.Headers == nil {
+				req.Headers = make(map[string][]string)
+			}
+			req.Headers[name] = values
+		}
+	}
+	return req
+}
+
+// cassetteSkipHeaders are response headers that do not apply to a replayed
+// body.
+var cassetteSkipHeaders = []string{"Connection", "Keep-Alive", "Transfer-Encoding", "Trailer", "Content-Length"}
+
+func (c *Cassette) record(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	body, truncated := captureRequestBody(r, c.cfg.MaxBody)
+	if truncated {
+		c.skipped.Add(1)
+		next.ServeHTTP(w, r)
+		return
+	}
+	req := c.request(r, body)
+
+	cw := newCaptureWriter(w, c.cfg.MaxBody)
+	next.ServeHTTP(cw, r)
+	if cw.truncated || cw.streamed || !TrafficMetaFrom(r.Context()).untouched() {
+		c.skipped.Add(1)
+		return
+	}
+
+	header := w.Header().Clone()
+	respBody, coding, truncated := decodeBody(cw.body.Bytes(), header, c.cfg.MaxBody)
+	if truncated {
+		c.skipped.Add(1)
+		return
+	}
+	if coding != "" {
+		header.Del("Content-Encoding")
+	}
+	for _, h := range cassetteSkipHeaders {
+		header.Del(h)
+	}
+	header.Del(HeaderCassette)
+	// Cassettes are committed for CI; credentials such as Set-Cookie are
+	// left out rather than masked.
+	c.cfg.Redactor.For(r.URL.Path).StripHeaders(header)
+
+	key, err := c.store.Record(cassette.Interaction{
+		RecordedAt: time.Now().UTC(),
+		Request:    req,
+		Response: cassette.Response{
+			Status:  cw.statusCode,
+			Headers: header,
+			Body:    cassette.NewBody(respBody, header.Get("Content-Type")),
+		},
+	})
+	if errors.Is(err, cassette.ErrFull) {
+		c.skipped.Add(1)
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to record cassette %s for %s %s: %v", key, r.Method, r.URL.Path, err)
+		return
+	}
+	c.recorded.Add(1)
+}
+
+func (c *Cassette) play(w http.ResponseWriter, r *http.Request) {
+	body, _ := captureRequestBody(r, c.cfg.MaxBody)
+	in, key, ok := c.store.Find(c.request(r, body))
+	var respBody []byte
+	if ok {
+		var err error
+		if respBody, err = in.Response.Body.Bytes(); err != nil {
+			log.Printf("💀 Cassette %s for %s %s is corrupt: %v", key, r.Method, r.URL.Path, err)
+			ok = false
+		}
+	}
+	if !ok {
+		c.miss(w, r, key)
+		return
+	}
+
+	c.hits.Add(1)
+	TrafficMetaFrom(r.Context()).SetUpstream(redis.RoutePrimary, "cassette:"+c.cfg.Dir)
+	for name, values := range in.Response.Headers {
+		w.Header()[http.CanonicalHeaderKey(name)] = values
+	}
+	w.Header().Set(HeaderCassette, "hit")
+	w.Header().Set("Content-Length", strconv.Itoa(len(respBody)))
+	status := in.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(respBody)
+}
+
+// miss fails a request no cassette matches, loudly: it is logged, counted
+// and answered with 502 and the key, so a test sees what was not recorded.
+func (c *Cassette) miss(w http.ResponseWriter, r *http.Request, key string) {
+	n := c.misses.Add(1)
+	request := r.Method + " " + r.URL.RequestURI()
+	log.Printf("📼 ❌ Cassette miss #%d: %s (key %s)", n, request, key)
+
+	c.mu.Lock()
+	c.recentMisses = append(c.recentMisses, request+" ("+key+")")
+	if len(c.recentMisses) > maxRecentMisses {
+		c.recentMisses = c.recentMisses[len(c.recentMisses)-maxRecentMisses:]
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(HeaderCassette, "miss")
+	w.WriteHeader(http.StatusBadGateway)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":   "No cassette matches this request",
+		"request": request,
+		"key":     key,
+		"matcher": c.cfg.Matcher,
+	})
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/elliot/chaosProxy/pkg/cassette"
+)
+
+func TestCassette_RecordAndPlayback(t *testing.T) {
+	dir := t.TempDir()
+	matcher, _ := cassette.ParseMatcher(cassette.DefaultMatch, nil)
+
+	rec, err := NewCassette(CassetteConfig{Mode: cassette.ModeRecord, Dir: dir, Matcher: matcher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	written := make(chan struct{})
+	go func() {
+		rec.Run(ctx)
+		close(written)
+	}()
+	calls := 0
+	upstream := rec.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(`{"id": 42, "call": ` + strconv.Itoa(calls) + `}`))
+		zw.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Set-Cookie", "session=s3cr3t")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(buf.Bytes())
+	}))
+	for i := 0; i < 2; i++ {
+		upstream.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders?b=2&a=1", strings.NewReader(`{"sku": "a"}`)))
+	}
+	if stats := rec.Stats(); stats.Recorded != 2 || stats.Interactions != 2 {
+		t.Fatalf("Unexpected record stats: %+v", stats)
+	}
+	cancel()
+	<-written
+
+	play, err := NewCassette(CassetteConfig{Mode: cassette.ModePlayback, Dir: dir, Matcher: matcher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := play.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected playback never to reach the upstream")
+	}))
+
+	for _, want := range []string{`{"id": 42, "call": 1}`, `{"id": 42, "call": 2}`} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders?a=1&b=2", strings.NewReader(`{"sku":"a"}`)))
+		if w.Code != http.StatusCreated || w.Body.String() != want || w.Header().Get(HeaderCassette) != "hit" {
+			t.Errorf("Expected %s from the cassette, got %d %q %v", want, w.Code, w.Body.String(), w.Header())
+		}
+		if w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Expected the body to be stored decoded, got %v", w.Header())
+		}
+		if w.Header().Get("Set-Cookie") != "" || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("Expected credentials to be left out of the cassette, got %v", w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders?a=1&b=2", strings.NewReader(`{"sku":"b"}`)))
+	var miss map[string]any
+	json.Unmarshal(w.Body.Bytes(), &miss)
+	if w.Code != http.StatusBadGateway || w.Header().Get(HeaderCassette) != "miss" || miss["key"] == nil {
+		t.Errorf("Expected a loud miss, got %d %s", w.Code, w.Body.String())
+	}
+	if stats := play.Stats(); stats.Hits != 2 || stats.Misses != 1 || len(stats.RecentMisses) != 1 {
+		t.Errorf("Unexpected playback stats: %+v", stats)
+	}
+}
+
+func TestCassette_SkipsTouchedExchanges(t *testing.T) {
+	rec, _ := NewCassette(CassetteConfig{Mode: cassette.ModeRecord, Dir: t.TempDir(), Matcher: cassette.Matcher{Path: true}})
+	handler := rec.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		TrafficMetaFrom(r.Context()).SetGhost()
+		w.Write([]byte("learned"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/ghost", nil)
+	req = req.WithContext(WithTrafficMeta(req.Context(), &TrafficMeta{}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if stats := rec.Stats(); stats.Recorded != 0 || stats.Skipped != 1 {
+		t.Errorf("Expected Ghost Mode answers not to be recorded, got %+v", stats)
+	}
+
+	if _, err := NewCassette(CassetteConfig{Mode: "rewind"}); err == nil {
+		t.Error("Expected an unknown mode to fail")
+	}
+	if _, err := NewCassette(CassetteConfig{Mode: cassette.ModePlayback, Dir: t.TempDir() + "/missing"}); err == nil {
+		t.Error("Expected playback from a missing directory to fail")
+	}
+}
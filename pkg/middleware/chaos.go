@@ -2,92 +2,347 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"log"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/elliot/chaosProxy/pkg/chaos"
 	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
 	"github.com/elliot/chaosProxy/pkg/latency"
 )
 
+// RuleSource supplies the chaos rules that are active at a point in time,
+// e.g. running experiments.
+type RuleSource interface {
+	ActiveRules(now time.Time) []chaos.Rule
+}
+
+// SettingsSnapshot is an immutable copy of the global chaos settings as
+// last applied by this Sentinel.
+type SettingsSnapshot struct {
+	Settings  redis.ChaosSettings `json:"settings"`
+	Version   int64               `json:"version"`  // as stored; direct edits in Redis may not bump it
+	Revision  int64               `json:"revision"` // bumped by this Sentinel on every applied change
+	SyncedAt  time.Time           `json:"synced_at"`
+	Source    string              `json:"source"` // initial, pubsub, keyspace or resync
+	LastError string              `json:"last_error,omitempty"`
+}
+
+// settingsResyncInterval is the safety net for missed notifications.
+const settingsResyncInterval = 30 * time.Second
+
 type ChaosMiddleware struct {
-	redisClient    *redis.Client
-	settings       *redis.ChaosSettings
-	mu             sync.RWMutex
-	lastFetch      time.Time
-	simulateRegion string
+	redisClient     *redis.Client
+	snapshot        atomic.Pointer[SettingsSnapshot]
+	syncMu          sync.Mutex // serialises applySettings, never taken on the hot path
+	simulateRegion  string
+	directiveSecret string
+	sources         []RuleSource
+	limits          chaos.Limits
+	patterns        chaos.PatternStore
+	copySlots       chan struct{} // duplicated and replayed requests in flight or waiting
+	droppedCopies   atomic.Int64
 }
 
-func NewChaosMiddleware(redisClient *redis.Client, simulateRegion string) *ChaosMiddleware {
-	return &ChaosMiddleware{
-		redisClient:    redisClient,
-		settings:       &redis.ChaosSettings{},
-		simulateRegion: simulateRegion,
+// NewChaosMiddleware creates the chaos middleware. Per-request directives
+// (X-Chaos-Inject / X-Chaos-Region) are only honoured when directiveSecret
+// is set and the request presents it in X-Chaos-Secret.
+func NewChaosMiddleware(redisClient *redis.Client, simulateRegion, directiveSecret string) *ChaosMiddleware {
+	c := &ChaosMiddleware{
+		redisClient:     redisClient,
+		simulateRegion:  simulateRegion,
+		directiveSecret: directiveSecret,
+		limits:          chaos.DefaultLimits(),
+		patterns:        chaos.NewLocalPatternStore(),
+		copySlots:       make(chan struct{}, maxPendingCopies),
 	}
+	c.snapshot.Store(&SettingsSnapshot{Source: "default"})
+	return c
 }
 
-func (c *ChaosMiddleware) refreshSettings() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// AddRuleSource registers an additional source of chaos rules.
+// It must be called before the middleware starts serving requests.
+func (c *ChaosMiddleware) AddRuleSource(src RuleSource) {
+	c.sources = append(c.sources, src)
+}
 
-	// Cache for 1 second to avoid hitting Redis on every request
-	if time.Since(c.lastFetch) < 1*time.Second {
-		return
+// SetLimits restricts the blast radius of every chaos source.
+// It must be called before the middleware starts serving requests.
+func (c *ChaosMiddleware) SetLimits(limits chaos.Limits) {
+	c.limits = limits
+}
+
+// SetPatternStore sets where fault pattern counters are kept, e.g. Redis
+// to share them across Sentinels. It must be called before serving requests.
+func (c *ChaosMiddleware) SetPatternStore(store chaos.PatternStore) {
+	c.patterns = store
+}
+
+// Snapshot returns the currently applied settings.
+func (c *ChaosMiddleware) Snapshot() *SettingsSnapshot {
+	return c.snapshot.Load()
+}
+
+// DroppedCopies returns the number of duplicated or replayed requests not
+// sent because maxPendingCopies were already pending.
+func (c *ChaosMiddleware) DroppedCopies() int64 {
+	return c.droppedCopies.Load()
+}
+
+// Watch keeps the settings snapshot in sync with Redis until ctx is done.
+// Changes are pushed through pub/sub and keyspace notifications; a periodic
+// resync covers missed messages and Redis reconnects.
+func (c *ChaosMiddleware) Watch(ctx context.Context) {
+	if err := c.redisClient.EnableKeyspaceNotifications(ctx); err != nil {
+		log.Printf("⚠️ Could not enable keyspace notifications (%v). Relying on %s and periodic resync.", err, redis.ChaosSettingsChannel)
 	}
 
-	settings, err := c.redisClient.GetChaosSettings(context.Background())
+	c.sync(ctx, "initial")
+
+	go func() {
+		ticker := time.NewTicker(settingsResyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.sync(ctx, "resync")
+			}
+		}
+	}()
+
+	c.redisClient.WatchChaosSettings(ctx, func(source string) {
+		c.sync(ctx, source)
+	})
+}
+
+// sync fetches the settings from Redis and applies them. On failure the
+// previous settings stay in effect and the error is recorded on the snapshot.
+func (c *ChaosMiddleware) sync(ctx context.Context, source string) {
+	settings, err := c.redisClient.GetChaosSettings(ctx)
 	if err != nil {
-		// Log error but continue with old settings
-		// log.Printf("Failed to fetch chaos settings: %v", err)
+		c.syncMu.Lock()
+		stale := *c.snapshot.Load()
+		stale.LastError = err.Error()
+		c.snapshot.Store(&stale)
+		c.syncMu.Unlock()
+		log.Printf("⚠️ Failed to sync chaos settings, keeping version %d: %v", stale.Version, err)
 		return
 	}
+	c.applySettings(*settings, source, time.Now())
+}
+
+// applySettings atomically swaps in a new snapshot.
+func (c *ChaosMiddleware) applySettings(settings redis.ChaosSettings, source string, now time.Time) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	prev := c.snapshot.Load()
+	next := &SettingsSnapshot{
+		Settings: settings,
+		Version:  settings.Version,
+		Revision: prev.Revision,
+		SyncedAt: now,
+		Source:   source,
+	}
+	if prev.Settings == settings && !prev.SyncedAt.IsZero() {
+		// Nothing changed; only refresh the sync time and clear any error.
+		next.Source = prev.Source
+	} else {
+		next.Revision++
+		log.Printf("🔧 Applied chaos settings version %d, revision %d (%s)", settings.Version, next.Revision, source)
+	}
+	c.snapshot.Store(next)
+}
 
-	c.settings = settings
-	c.lastFetch = time.Now()
+// directive returns the per-request directive if directives are enabled and
+// the request is authorised to use them. Directive headers are always
+// stripped when the mode is enabled.
+func (c *ChaosMiddleware) directive(r *http.Request) (*Directive, error) {
+	if c.directiveSecret == "" {
+		return nil, nil
+	}
+	defer stripDirectiveHeaders(r.Header)
+
+	secret := r.Header.Get(ChaosSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(c.directiveSecret)) != 1 {
+		return nil, nil
+	}
+	return ParseDirective(r.Header)
 }
 
 func (c *ChaosMiddleware) Chaos(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Update settings async or sync? Sync is safer for immediate effect but adds latency.
-		// Given we cache for 1s, sync is fine.
-		c.refreshSettings()
+		// Settings are kept up to date by Watch; reading them is lock-free.
+		settings := c.snapshot.Load().Settings
+
+		// 0. Blast radius: kill switch, production policy and exclusions
+		if settings.KillSwitch || c.limits.Disabled || c.limits.Excludes(r, getRealIP(r)) {
+			if c.directiveSecret != "" {
+				stripDirectiveHeaders(r.Header)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// 1. Per-request directives override global chaos entirely
+		d, err := c.directive(r)
+		if err != nil {
+			http.Error(w, "Invalid chaos directive: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if d != nil {
+			c.applyDirective(w, r, next, d)
+			return
+		}
 
-		c.mu.RLock()
-		settings := *c.settings // Copy
-		c.mu.RUnlock()
+		meta := TrafficMetaFrom(r.Context())
 
-		// 1. Latency Injection
+		// 2. Latency Injection
 		// a) Region Simulation (Static Base Latency)
-		if regionLatency, ok := latency.GetLatency(c.simulateRegion); ok {
-			// Calculate random latency within region range
-			addedLatency := time.Duration(rand.Int63n(int64(regionLatency.Max-regionLatency.Min))) + regionLatency.Min
-			time.Sleep(addedLatency)
+		delay := regionDelay(c.simulateRegion)
+		if delay > 0 {
+			meta.AddChaos("region", "", c.simulateRegion+" "+delay.String())
 		}
 
-		// b) Dynamic Chaos Latency
-		if settings.LatencyEnabled {
-			min := settings.LatencyMin
-			max := settings.LatencyMax
-			if max > min {
-				// Sleep random duration
-				delay := time.Duration(rand.Intn(max-min)+min) * time.Millisecond
-				time.Sleep(delay)
+		// b) Dynamic Chaos Latency (global settings + active rules)
+		rules := c.matchingRules(r, settings)
+		for _, rule := range rules {
+			if d := faultDelay(rule.Fault); d > 0 {
+				meta.AddChaos("latency", rule.Name, d.String())
+				delay += d
 			}
 		}
+		sleep(r.Context(), c.limits.ClampDelay(delay))
 
-		// 2. Failure Injection
-		if settings.FailureEnabled {
+		// 3. Failure Injection
+		for _, rule := range rules {
 			// Random number between 0-99
-			if rand.Intn(100) < settings.FailureRate {
-				log.Printf("💀 CHAOS: Injecting failure for %s", r.URL.Path)
-				w.WriteHeader(http.StatusInternalServerError)
+			if rand.Intn(100) < rule.Fault.FailureRate {
+				if action, ok := chaosActions[rule.Fault.Action]; ok {
+					log.Printf("🎭 CHAOS: Action %s for %s (%s)", rule.Fault.Action, r.URL.Path, rule.Name)
+					meta.AddChaos("action", rule.Name, rule.Fault.Action)
+					action(w, r, next)
+					return
+				}
+
+				log.Printf("💀 CHAOS: Injecting failure for %s (%s)", r.URL.Path, rule.Name)
+				status := rule.Fault.Status
+				if status == 0 {
+					status = http.StatusInternalServerError
+				}
+				meta.AddChaos("failure", rule.Name, strconv.Itoa(status))
+				w.WriteHeader(status)
 				w.Write([]byte(`{"error": "Chaos Monkey Struck!"}`))
 				return
 			}
 		}
 
+		// 4. Request Faults (mutations, duplicates, replays)
+		c.applyRequestFaults(r, next, rules)
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+// matchingRules returns the global settings as a rule plus every active rule
+// matching r, with fault patterns applied and faults clamped to the
+// configured limits.
+func (c *ChaosMiddleware) matchingRules(r *http.Request, settings redis.ChaosSettings) []chaos.Rule {
+	var rules []chaos.Rule
+
+	global := chaos.Rule{Name: "global"}
+	if settings.LatencyEnabled && settings.LatencyMax > settings.LatencyMin {
+		global.Fault.LatencyMin = settings.LatencyMin
+		global.Fault.LatencyMax = settings.LatencyMax
+	}
+	if settings.FailureEnabled {
+		global.Fault.FailureRate = settings.FailureRate
+	}
+	if settings.LatencyEnabled || settings.FailureEnabled {
+		rules = append(rules, global)
+	}
+
+	now := time.Now()
+	for _, src := range c.sources {
+		for _, rule := range src.ActiveRules(now) {
+			if !rule.Match.Matches(r) {
+				continue
+			}
+			if p := rule.Fault.Pattern; p != nil {
+				fault, ok, err := p.Apply(r.Context(), c.patterns, rule, getRealIP(r), now)
+				if err != nil {
+					log.Printf("⚠️ CHAOS: Pattern %s for rule %s failed: %v", p.Kind, rule.Name, err)
+				}
+				if !ok {
+					continue
+				}
+				rule.Fault = fault
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	for i := range rules {
+		rules[i].Fault = c.limits.Clamp(rules[i].Fault)
+	}
+	return rules
+}
+
+// faultDelay picks a random latency within the fault's range.
+func faultDelay(f chaos.Fault) time.Duration {
+	if f.LatencyMax <= f.LatencyMin {
+		return time.Duration(f.LatencyMin) * time.Millisecond
+	}
+	return time.Duration(rand.Intn(f.LatencyMax-f.LatencyMin)+f.LatencyMin) * time.Millisecond
+}
+
+// applyDirective applies a per-request directive and echoes it back in X-Chaos-Applied.
+func (c *ChaosMiddleware) applyDirective(w http.ResponseWriter, r *http.Request, next http.Handler, d *Directive) {
+	w.Header().Set(ChaosAppliedHeader, d.String())
+	TrafficMetaFrom(r.Context()).AddChaos("directive", "", d.String())
+
+	region := c.simulateRegion
+	if d.Region != "" {
+		region = d.Region
+	}
+	sleep(r.Context(), c.limits.ClampDelay(regionDelay(region)+d.Delay))
+
+	if d.Status != 0 {
+		log.Printf("🎯 CHAOS: Directive %q for %s", d.String(), r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(d.Status)
+		w.Write([]byte(`{"error": "Chaos directive injected"}`))
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// regionDelay picks a random latency within the simulated region's range.
+func regionDelay(region string) time.Duration {
+	regionLatency, ok := latency.GetLatency(region)
+	if !ok || regionLatency.Max <= regionLatency.Min {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(regionLatency.Max-regionLatency.Min))) + regionLatency.Min
+}
+
+// sleep waits for d or until the request is cancelled.
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
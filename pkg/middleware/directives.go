@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/latency"
+)
+
+// Headers used for per-request chaos directives.
+const (
+	ChaosSecretHeader  = "X-Chaos-Secret"
+	ChaosInjectHeader  = "X-Chaos-Inject"
+	ChaosRegionHeader  = "X-Chaos-Region"
+	ChaosAppliedHeader = "X-Chaos-Applied"
+)
+
+// Directive describes the chaos a single request asked for,
+// e.g. "X-Chaos-Inject: delay=300ms;status=503".
+type Directive struct {
+	Delay  time.Duration
+	Status int
+	Region string
+}
+
+// ParseDirective reads the chaos directive headers from h.
+// It returns nil if the request carries no directives.
+func ParseDirective(h http.Header) (*Directive, error) {
+	inject := strings.TrimSpace(h.Get(ChaosInjectHeader))
+	region := strings.TrimSpace(h.Get(ChaosRegionHeader))
+	if inject == "" && region == "" {
+		return nil, nil
+	}
+
+	d := &Directive{Region: region}
+	for _, part := range strings.Split(inject, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed directive %q", part)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "delay":
+			delay, err := parseDelay(value)
+			if err != nil {
+				return nil, err
+			}
+			d.Delay = delay
+		case "status":
+			status, err := strconv.Atoi(value)
+			if err != nil || status < 100 || status > 599 {
+				return nil, fmt.Errorf("invalid status %q", value)
+			}
+			d.Status = status
+		case "region":
+			d.Region = value
+		default:
+			return nil, fmt.Errorf("unknown directive %q", key)
+		}
+	}
+
+	if d.Region != "" {
+		if _, ok := latency.GetLatency(d.Region); !ok {
+			return nil, fmt.Errorf("unknown region %q", d.Region)
+		}
+	}
+
+	return d, nil
+}
+
+// parseDelay accepts Go durations ("300ms", "1.5s") or bare milliseconds ("300").
+func parseDelay(value string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		return 0, fmt.Errorf("invalid delay %q", value)
+	}
+	return delay, nil
+}
+
+// String renders the directive in the same format as X-Chaos-Inject.
+func (d *Directive) String() string {
+	var parts []string
+	if d.Delay > 0 {
+		parts = append(parts, "delay="+d.Delay.String())
+	}
+	if d.Status != 0 {
+		parts = append(parts, "status="+strconv.Itoa(d.Status))
+	}
+	if d.Region != "" {
+		parts = append(parts, "region="+d.Region)
+	}
+	return strings.Join(parts, ";")
+}
+
+// stripDirectiveHeaders removes directive headers so they never reach the backend.
+func stripDirectiveHeaders(h http.Header) {
+	h.Del(ChaosSecretHeader)
+	h.Del(ChaosInjectHeader)
+	h.Del(ChaosRegionHeader)
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+const trafficMetaKey contextKey = "trafficMeta"
+
+// TrafficMeta collects what happened to a request on its way through
+// Sentinel, for the traffic log. All methods are safe on a nil receiver.
+type TrafficMeta struct {
+	mu       sync.Mutex
+	route    string
+	upstream string
+	ghost    bool
+	chaos    []redis.AppliedChaos
+}
+
+// WithTrafficMeta returns a context carrying m.
+func WithTrafficMeta(ctx context.Context, m *TrafficMeta) context.Context {
+	return context.WithValue(ctx, trafficMetaKey, m)
+}
+
+// TrafficMetaFrom returns the metadata carried by ctx, or nil.
+func TrafficMetaFrom(ctx context.Context) *TrafficMeta {
+	m, _ := ctx.Value(trafficMetaKey).(*TrafficMeta)
+	return m
+}
+
+// SetUpstream records which upstream served the request.
+func (m *TrafficMeta) SetUpstream(route, upstream string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.route, m.upstream = route, upstream
+}
+
+// SetGhost records that the response was served by Ghost Mode.
+func (m *TrafficMeta) SetGhost() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ghost = true
+}
+
+// AddChaos records chaos applied to the request.
+func (m *TrafficMeta) AddChaos(kind, rule, detail string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chaos = append(m.chaos, redis.AppliedChaos{Kind: kind, Rule: rule, Detail: detail})
+}
+
+// untouched reports whether the primary upstream answered the request
+// without Ghost Mode or chaos.
+func (m *TrafficMeta) untouched() bool {
+	if m == nil {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return (m.route == "" || m.route == redis.RoutePrimary) && !m.ghost && len(m.chaos) == 0
+}
+
+// fill copies the metadata into a log entry.
+func (m *TrafficMeta) fill(entry *redis.TrafficLog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.Route = m.route
+	entry.Upstream = m.upstream
+	entry.Ghost = m.ghost
+	entry.Chaos = append([]redis.AppliedChaos(nil), m.chaos...)
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+// SteadyState records the outcome of every request into window so
+// steady-state guards can evaluate live traffic.
+func SteadyState(window *metrics.Window) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			next.ServeHTTP(rw, r)
+
+			ghost := rw.Header().Get("X-Chaos-Ghost") == "true"
+			window.Record(time.Now(), time.Since(start), rw.statusCode, ghost)
+		})
+	}
+}
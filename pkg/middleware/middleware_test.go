@@ -1,10 +1,19 @@
 package middleware
 
 import (
+	"encoding/base64"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/codec"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
 )
 
 func TestChain(t *testing.T) {
@@ -155,83 +164,409 @@ func TestRateLimit_Middleware(t *testing.T) {
 	}
 }
 
-func TestSanitizeBody(t *testing.T) {
+func TestParseDirective(t *testing.T) {
 	tests := []struct {
 		name     string
-		input    string
+		inject   string
+		region   string
 		expected string
+		wantErr  bool
 	}{
-		{
-			name:     "Password field",
-			input:    `{"username": "john", "password": "secret123"}`,
-			expected: `{"username": "john", "[REDACTED]"}`,
-		},
-		{
-			name:     "Token field",
-			input:    `{"token": "abc123xyz"}`,
-			expected: `{"[REDACTED]"}`,
-		},
-		{
-			name:     "No sensitive data",
-			input:    `{"name": "John", "age": 30}`,
-			expected: `{"name": "John", "age": 30}`,
-		},
-		{
-			name:     "API key field",
-			input:    `{"api_key": "sk-12345"}`,
-			expected: `{"[REDACTED]"}`,
-		},
+		{name: "No directives", expected: ""},
+		{name: "Delay and status", inject: "delay=300ms;status=503", expected: "delay=300ms;status=503"},
+		{name: "Bare milliseconds", inject: "delay=250", expected: "delay=250ms"},
+		{name: "Region header", region: "ap-southeast-2", expected: "region=ap-southeast-2"},
+		{name: "Unknown key", inject: "explode=yes", wantErr: true},
+		{name: "Invalid status", inject: "status=999", wantErr: true},
+		{name: "Unknown region", region: "mars-north-1", wantErr: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := sanitizeBody(tt.input)
-			if result != tt.expected {
-				t.Errorf("Expected '%s', got '%s'", tt.expected, result)
+			h := http.Header{}
+			if tt.inject != "" {
+				h.Set(ChaosInjectHeader, tt.inject)
+			}
+			if tt.region != "" {
+				h.Set(ChaosRegionHeader, tt.region)
+			}
+
+			d, err := ParseDirective(h)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := ""
+			if d != nil {
+				got = d.String()
+			}
+			if got != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, got)
 			}
 		})
 	}
 }
 
-func TestHasSensitiveHeader(t *testing.T) {
+func TestChaos_Directive(t *testing.T) {
+	var backendHeaders http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHeaders = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	chaos := NewChaosMiddleware(nil, "", "s3cret").Chaos(handler)
+
+	t.Run("Status injected", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		req.Header.Set(ChaosSecretHeader, "s3cret")
+		req.Header.Set(ChaosInjectHeader, "delay=1ms;status=503")
+		rec := httptest.NewRecorder()
+
+		chaos.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", rec.Code)
+		}
+		if got := rec.Header().Get(ChaosAppliedHeader); got != "delay=1ms;status=503" {
+			t.Errorf("Unexpected %s header: '%s'", ChaosAppliedHeader, got)
+		}
+	})
+
+	t.Run("Headers stripped before proxying", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		req.Header.Set(ChaosSecretHeader, "s3cret")
+		req.Header.Set(ChaosInjectHeader, "delay=1ms")
+		rec := httptest.NewRecorder()
+
+		chaos.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", rec.Code)
+		}
+		for _, h := range []string{ChaosSecretHeader, ChaosInjectHeader, ChaosRegionHeader} {
+			if backendHeaders.Get(h) != "" {
+				t.Errorf("%s should have been stripped", h)
+			}
+		}
+	})
+
+	t.Run("Invalid directive rejected", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		req.Header.Set(ChaosSecretHeader, "s3cret")
+		req.Header.Set(ChaosInjectHeader, "status=abc")
+		rec := httptest.NewRecorder()
+
+		chaos.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+type staticRules []chaos.Rule
+
+func (s staticRules) ActiveRules(now time.Time) []chaos.Rule {
+	return s
+}
+
+func TestChaos_AppliedSettings(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	c := NewChaosMiddleware(nil, "", "")
+	chaosHandler := c.Chaos(handler)
+
+	c.applySettings(redis.ChaosSettings{FailureEnabled: true, FailureRate: 100, Version: 7}, "pubsub", time.Now())
+
+	if snap := c.Snapshot(); snap.Version != 7 || snap.Revision != 1 || snap.Source != "pubsub" {
+		t.Errorf("Unexpected snapshot: %+v", snap)
+	}
+	c.applySettings(redis.ChaosSettings{FailureEnabled: true, FailureRate: 100, Version: 7}, "resync", time.Now())
+	if snap := c.Snapshot(); snap.Revision != 1 || snap.Source != "pubsub" {
+		t.Errorf("Expected an unchanged resync to keep the revision, got %+v", snap)
+	}
+
+	rec := httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 with 100%% failure rate, got %d", rec.Code)
+	}
+
+	c.applySettings(redis.ChaosSettings{Version: 8}, "keyspace", time.Now())
+
+	rec = httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 once chaos is disabled, got %d", rec.Code)
+	}
+
+	// A direct HSET in Redis changes the settings without bumping version.
+	c.applySettings(redis.ChaosSettings{LatencyEnabled: true, Version: 8}, "keyspace", time.Now())
+	if snap := c.Snapshot(); snap.Version != 8 || snap.Revision != 3 || !snap.Settings.LatencyEnabled {
+		t.Errorf("Expected the out-of-band change to bump the revision, got %+v", snap)
+	}
+}
+
+func TestChaos_RuleSource(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	c := NewChaosMiddleware(nil, "", "")
+	c.AddRuleSource(staticRules{{
+		Name:  "orders",
+		Match: chaos.Matcher{PathPrefix: "/orders"},
+		Fault: chaos.Fault{FailureRate: 100, Status: http.StatusServiceUnavailable},
+	}})
+	chaosHandler := c.Chaos(handler)
+
+	rec := httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/orders/1", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 for matching rule, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/users/1", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for non-matching path, got %d", rec.Code)
+	}
+}
+
+func TestChaos_KillSwitch(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	c := NewChaosMiddleware(nil, "", "s3cret")
+	c.AddRuleSource(staticRules{{Name: "all", Fault: chaos.Fault{FailureRate: 100}}})
+	chaosHandler := c.Chaos(handler)
+
+	c.applySettings(redis.ChaosSettings{FailureEnabled: true, FailureRate: 100, KillSwitch: true}, "pubsub", time.Now())
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(ChaosSecretHeader, "s3cret")
+	req.Header.Set(ChaosInjectHeader, "status=503")
+	rec := httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with the kill switch engaged, got %d", rec.Code)
+	}
+	if req.Header.Get(ChaosInjectHeader) != "" {
+		t.Error("Expected directive headers to be stripped")
+	}
+}
+
+func TestChaos_Limits(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	networks, err := chaos.ParseNetworks([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChaosMiddleware(nil, "", "")
+	c.AddRuleSource(staticRules{{Name: "all", Fault: chaos.Fault{FailureRate: 100}}})
+	c.SetLimits(chaos.Limits{
+		MaxFailureRate:  100,
+		ExcludedRoutes:  []string{"/healthz"},
+		ExcludedClients: networks,
+		ExcludedGroups:  []string{"internal"},
+		GroupHeader:     "X-Client-Group",
+	})
+	chaosHandler := c.Chaos(handler)
+
 	tests := []struct {
-		name     string
-		headers  map[string]string
-		expected bool
+		name   string
+		req    func() *http.Request
+		status int
 	}{
-		{
-			name:     "Authorization header",
-			headers:  map[string]string{"Authorization": "Bearer token123"},
-			expected: true,
-		},
-		{
-			name:     "Cookie header",
-			headers:  map[string]string{"Cookie": "session=abc"},
-			expected: true,
-		},
-		{
-			name:     "Regular header",
-			headers:  map[string]string{"Content-Type": "application/json"},
-			expected: false,
-		},
-		{
-			name:     "X-API-Key header",
-			headers:  map[string]string{"X-API-Key": "key123"},
-			expected: true,
-		},
+		{"regular request", func() *http.Request { return httptest.NewRequest("GET", "/orders", nil) }, http.StatusInternalServerError},
+		{"excluded route", func() *http.Request { return httptest.NewRequest("GET", "/healthz", nil) }, http.StatusOK},
+		{"excluded client", func() *http.Request {
+			r := httptest.NewRequest("GET", "/orders", nil)
+			r.RemoteAddr = "10.1.2.3:4567"
+			return r
+		}, http.StatusOK},
+		{"excluded group", func() *http.Request {
+			r := httptest.NewRequest("GET", "/orders", nil)
+			r.Header.Set("X-Client-Group", "Internal")
+			return r
+		}, http.StatusOK},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest("GET", "/test", nil)
-			for k, v := range tt.headers {
-				req.Header.Set(k, v)
-			}
+		rec := httptest.NewRecorder()
+		chaosHandler.ServeHTTP(rec, tt.req())
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+	}
+
+	c.SetLimits(chaos.Limits{MaxFailureRate: 0})
+	rec := httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/orders", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected failure rate to be clamped to 0, got status %d", rec.Code)
+	}
+
+	c.SetLimits(chaos.Limits{Disabled: true, MaxFailureRate: 100})
+	rec = httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/orders", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected chaos to be disabled, got status %d", rec.Code)
+	}
+}
+
+func TestChaos_RequestFaults(t *testing.T) {
+	bodies := make(chan string, 10)
+	originals := make(chan bool, 10)
+	meta := &TrafficMeta{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		originals <- TrafficMetaFrom(r.Context()) == meta
+		bodies <- r.Header.Get("X-Trace") + " " + string(data)
+		w.WriteHeader(http.StatusOK)
+	})
 
-			result := hasSensitiveHeader(req)
-			if result != tt.expected {
-				t.Errorf("Expected %v, got %v", tt.expected, result)
+	c := NewChaosMiddleware(nil, "", "")
+	c.AddRuleSource(staticRules{{
+		Name:  "orders",
+		Match: chaos.Matcher{Methods: []string{"POST"}},
+		Fault: chaos.Fault{Request: &chaos.RequestFault{
+			DropFields:   []string{"note"},
+			StripHeaders: []string{"X-Trace"},
+			Duplicates:   2,
+		}},
+	}})
+	chaosHandler := c.Chaos(handler)
+
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id":1,"note":"x"}`))
+	req = req.WithContext(WithTrafficMeta(req.Context(), meta))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Trace", "abc")
+	rec := httptest.NewRecorder()
+	chaosHandler.ServeHTTP(rec, req)
+
+	withMeta := 0
+	for i := 0; i < 3; i++ {
+		select {
+		case got := <-bodies:
+			if got != ` {"id":1}` {
+				t.Errorf("Unexpected request at backend: %q", got)
 			}
-		})
+			if <-originals {
+				withMeta++
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 3 requests at the backend, got %d", i)
+		}
+	}
+	if withMeta != 1 {
+		t.Errorf("Expected only the original request to carry its traffic metadata, got %d", withMeta)
+	}
+}
+
+func TestChaos_RequestFaultsDropCopies(t *testing.T) {
+	var requests atomic.Int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	})
+
+	c := NewChaosMiddleware(nil, "", "")
+	c.AddRuleSource(staticRules{{
+		Name:  "orders",
+		Fault: chaos.Fault{Request: &chaos.RequestFault{Duplicates: 3}},
+	}})
+	// Leave room for a single copy.
+	for i := 0; i < maxPendingCopies-1; i++ {
+		c.copySlots <- struct{}{}
+	}
+	c.Chaos(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders", nil))
+
+	for i := 0; i < 100 && requests.Load() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if requests.Load() != 2 || c.DroppedCopies() != 2 {
+		t.Errorf("Expected the original and one copy, with 2 copies dropped, got %d requests and %d dropped", requests.Load(), c.DroppedCopies())
+	}
+}
+
+func TestTrafficCapture_Headers(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("Authorization", "Bearer secret")
+	h.Set("X-Tenant", "acme")
+	h.Set("X-Internal", "x")
+
+	got := TrafficCapture{Headers: []string{"content-type", "Authorization", "X-Tenant", "Accept"}}.headers(h)
+	want := map[string][]string{
+		"Content-Type":  {"application/json"},
+		"Authorization": {"Bearer secret"},
+		"X-Tenant":      {"acme"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected capture: %v", got)
+	}
+
+	if all := (TrafficCapture{Headers: []string{"*"}}).headers(h); len(all) != 4 {
+		t.Errorf("Expected all headers, got %v", all)
+	}
+	if none := (TrafficCapture{}).headers(h); none != nil {
+		t.Errorf("Expected no headers, got %v", none)
+	}
+}
+
+func TestCaptureBody(t *testing.T) {
+	gz, _ := codec.Encode([]byte(`{"ok": true}`), codec.Gzip)
+	h := http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}}
+
+	body, enc, truncated := decodeBody(gz, h, MaxBodySize)
+	text, b64 := bodyText(body, h.Get("Content-Type"))
+	if text != `{"ok": true}` || b64 || enc != "gzip" || truncated {
+		t.Errorf("Expected the decoded JSON body, got %q (base64 %v, encoding %q, truncated %v)", text, b64, enc, truncated)
+	}
+
+	body, _, truncated = decodeBody(gz, h, 4)
+	if string(body) != `{"ok` || !truncated {
+		t.Errorf("Expected a body decoding past the limit to be cut and flagged, got %q (truncated %v)", body, truncated)
+	}
+
+	h.Set("Content-Encoding", "br")
+	body, enc, _ = decodeBody(gz, h, MaxBodySize)
+	text, b64 = bodyText(body, "application/octet-stream")
+	if enc != "" || !b64 || text != base64.StdEncoding.EncodeToString(gz) {
+		t.Errorf("Expected an undecodable body to be stored base64-encoded as received, got %q (encoding %q)", text, enc)
+	}
+}
+
+func TestTrafficMeta_Chaos(t *testing.T) {
+	var nilMeta *TrafficMeta
+	nilMeta.AddChaos("latency", "global", "1ms") // must not panic
+
+	c := NewChaosMiddleware(nil, "", "")
+	c.AddRuleSource(staticRules{{Name: "orders", Fault: chaos.Fault{FailureRate: 100, Status: http.StatusServiceUnavailable}}})
+
+	meta := &TrafficMeta{}
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req = req.WithContext(WithTrafficMeta(req.Context(), meta))
+	c.Chaos(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+	meta.SetUpstream(redis.RouteCanary, "http://beta")
+
+	var entry redis.TrafficLog
+	meta.fill(&entry)
+	want := []redis.AppliedChaos{{Kind: "failure", Rule: "orders", Detail: "503"}}
+	if !reflect.DeepEqual(entry.Chaos, want) || entry.Route != redis.RouteCanary || entry.Upstream != "http://beta" {
+		t.Errorf("Unexpected metadata: %+v", entry)
 	}
 }
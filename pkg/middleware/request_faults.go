@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+)
+
+const (
+	// maxMutableBody is the largest request body request faults will buffer.
+	maxMutableBody = 1 << 20
+	// copyTimeout bounds duplicated and replayed requests.
+	copyTimeout = 30 * time.Second
+	// maxPendingCopies bounds the duplicated and replayed requests waiting
+	// or in flight; further copies are dropped.
+	maxPendingCopies = 100
+)
+
+// applyRequestFaults mutates r according to the request faults of the
+// matched rules, and sends duplicate or delayed copies through next.
+func (c *ChaosMiddleware) applyRequestFaults(r *http.Request, next http.Handler, rules []chaos.Rule) {
+	meta := TrafficMetaFrom(r.Context())
+	var faults []*chaos.RequestFault
+	for _, rule := range rules {
+		if f := rule.Fault.Request; f != nil && rand.Intn(100) < f.Percent() {
+			faults = append(faults, f)
+			meta.AddChaos("request", rule.Name, "")
+		}
+	}
+	if len(faults) == 0 {
+		return
+	}
+
+	body, ok := bufferBody(r)
+	isJSON := strings.Contains(r.Header.Get("Content-Type"), "json")
+
+	duplicates := 0
+	var replays []time.Duration
+	for _, f := range faults {
+		f.MutateHeaders(r.Header)
+
+		if f.MutatesBody() && ok && isJSON && len(body) > 0 {
+			mutated, err := f.MutateJSON(body)
+			if err != nil {
+				log.Printf("⚠️ CHAOS: Cannot mutate request body for %s: %v", r.URL.Path, err)
+			} else {
+				body = mutated
+			}
+		}
+
+		duplicates += f.Duplicates
+		if f.ReplayAfter > 0 {
+			replays = append(replays, time.Duration(f.ReplayAfter))
+		}
+	}
+
+	if !ok {
+		if duplicates > 0 || len(replays) > 0 {
+			log.Printf("⚠️ CHAOS: Request body for %s too large to duplicate", r.URL.Path)
+		}
+		return
+	}
+	setBody(r, body)
+
+	log.Printf("🧬 CHAOS: Request faults for %s %s (%d duplicates, %d replays)", r.Method, r.URL.Path, duplicates, len(replays))
+	// Copies are cloned now, before the original continues down the chain.
+	dropped := 0
+	for i := 0; i < duplicates; i++ {
+		if !c.acquireCopy() {
+			dropped++
+			continue
+		}
+		cp := r.Clone(copyContext(r.Context()))
+		go c.sendCopy(next, cp, body)
+	}
+	for _, delay := range replays {
+		if !c.acquireCopy() {
+			dropped++
+			continue
+		}
+		cp := r.Clone(copyContext(r.Context()))
+		time.AfterFunc(delay, func() { c.sendCopy(next, cp, body) })
+	}
+	if dropped > 0 {
+		total := c.droppedCopies.Add(int64(dropped))
+		log.Printf("⚠️ CHAOS: Dropped %d copies of %s %s, %d copies already pending (%d dropped in total)", dropped, r.Method, r.URL.Path, maxPendingCopies, total)
+	}
+}
+
+// acquireCopy takes a copy slot without waiting. sendCopy releases it.
+func (c *ChaosMiddleware) acquireCopy() bool {
+	select {
+	case c.copySlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// copyContext detaches a copy from the original request: it outlives the
+// original, and does not record its route, upstream or ghost answer in the
+// original's traffic metadata.
+func copyContext(ctx context.Context) context.Context {
+	return WithTrafficMeta(context.WithoutCancel(ctx), nil)
+}
+
+// bufferBody reads the request body so it can be mutated and re-sent.
+// It returns false, leaving the body readable, if it exceeds maxMutableBody.
+func bufferBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxMutableBody+1))
+	if err != nil || len(buf) > maxMutableBody {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, false
+	}
+	r.Body.Close()
+	return buf, true
+}
+
+func setBody(r *http.Request, body []byte) {
+	r.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		// A non-nil empty body would be sent with chunked encoding.
+		r.Body, r.GetBody = http.NoBody, nil
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// sendCopy sends a cloned request through next, discards the response and
+// releases its copy slot.
+func (c *ChaosMiddleware) sendCopy(next http.Handler, cp *http.Request, body []byte) {
+	defer func() { <-c.copySlots }()
+	ctx, cancel := context.WithTimeout(cp.Context(), copyTimeout)
+	defer cancel()
+
+	cp = cp.WithContext(ctx)
+	setBody(cp, body)
+	next.ServeHTTP(&discardResponseWriter{header: make(http.Header)}, cp)
+}
+
+// discardResponseWriter swallows the response to a duplicated request.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header         { return d.header }
+func (d *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardResponseWriter) WriteHeader(int)             {}
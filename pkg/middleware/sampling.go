@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sampling modes.
+const (
+	SampleHead = "head" // decided before the request; unsampled requests skip body capture
+	SampleTail = "tail" // decided after the response; every body is buffered
+)
+
+// Sample reasons recorded in the traffic log.
+const (
+	ReasonSampled = "sampled"
+	ReasonError   = "error"
+	ReasonSlow    = "slow"
+)
+
+// SamplingRule sets the sampling rate of paths starting with PathPrefix.
+type SamplingRule struct {
+	PathPrefix string
+	Rate       float64 // 0 to 1
+	Mode       string
+}
+
+// Sampling decides which requests are published to the traffic log. The
+// decision is keyed on the request ID, so every Sentinel agrees on it.
+// Errors and slow requests can be kept regardless of the rate.
+type Sampling struct {
+	Rate          float64        // default rate, 0 to 1
+	Mode          string         // default mode
+	Routes        []SamplingRule // longest prefix wins
+	KeepErrors    bool           // always keep 5xx responses
+	SlowThreshold time.Duration  // always keep slower requests, 0 = off
+}
+
+// DefaultSampling keeps every request.
+func DefaultSampling() Sampling {
+	return Sampling{Rate: 1, Mode: SampleTail, KeepErrors: true}
+}
+
+// rule returns the sampling rule for path.
+func (s Sampling) rule(path string) SamplingRule {
+	best := SamplingRule{Rate: s.Rate}
+	for _, r := range s.Routes {
+		if strings.HasPrefix(path, r.PathPrefix) && len(r.PathPrefix) > len(best.PathPrefix) {
+			best = r
+		}
+	}
+	if best.Mode == "" {
+		best.Mode = s.Mode
+	}
+	if best.Mode == "" {
+		best.Mode = SampleTail
+	}
+	return best
+}
+
+// keep decides after the response whether a request is published, and why.
+func (s Sampling) keep(sampled bool, status int, duration time.Duration) (bool, string) {
+	switch {
+	case sampled:
+		return true, ReasonSampled
+	case s.KeepErrors && status >= http.StatusInternalServerError:
+		return true, ReasonError
+	case s.SlowThreshold > 0 && duration >= s.SlowThreshold:
+		return true, ReasonSlow
+	}
+	return false, ""
+}
+
+// sampled reports whether a request falls within rate. Requests without an
+// ID are sampled at random.
+func sampled(requestID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	if requestID == "" {
+		return rand.Float64() < rate
+	}
+	h := fnv.New64a()
+	h.Write([]byte(requestID))
+	return float64(h.Sum64()%10000) < rate*10000
+}
+
+// ParseSamplingRoutes parses "prefix=rate" or "prefix=rate:mode" entries,
+// e.g. "/api/search=0.1:head".
+func ParseSamplingRoutes(entries []string) ([]SamplingRule, error) {
+	var rules []SamplingRule
+	for _, entry := range entries {
+		prefix, spec, ok := strings.Cut(entry, "=")
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("invalid sampling route %q", entry)
+		}
+		rateSpec, mode, _ := strings.Cut(spec, ":")
+		rate, err := strconv.ParseFloat(rateSpec, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sampling rate in %q", entry)
+		}
+		if mode != "" && mode != SampleHead && mode != SampleTail {
+			return nil, fmt.Errorf("invalid sampling mode in %q", entry)
+		}
+		rules = append(rules, SamplingRule{PathPrefix: prefix, Rate: rate, Mode: mode})
+	}
+	return rules, nil
+}
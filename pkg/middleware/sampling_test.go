@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+func TestSampled_Deterministic(t *testing.T) {
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("req-%d", i)
+		first := sampled(id, 0.2)
+		if sampled(id, 0.2) != first {
+			t.Fatalf("Expected the same decision for %s", id)
+		}
+		if first {
+			kept++
+		}
+	}
+	if kept < 1800 || kept > 2200 {
+		t.Errorf("Expected about 20%% of requests sampled, got %d", kept)
+	}
+	if !sampled("any", 1) || sampled("any", 0) {
+		t.Error("Expected rates 1 and 0 to keep all and none")
+	}
+}
+
+func TestSampling_Rule(t *testing.T) {
+	s := Sampling{
+		Rate: 0.5,
+		Mode: SampleHead,
+		Routes: []SamplingRule{
+			{PathPrefix: "/api", Rate: 0.1},
+			{PathPrefix: "/api/orders", Rate: 1, Mode: SampleTail},
+		},
+	}
+
+	tests := []struct {
+		path string
+		rate float64
+		mode string
+	}{
+		{"/health", 0.5, SampleHead},
+		{"/api/users", 0.1, SampleHead},
+		{"/api/orders/42", 1, SampleTail},
+	}
+	for _, tt := range tests {
+		if r := s.rule(tt.path); r.Rate != tt.rate || r.Mode != tt.mode {
+			t.Errorf("rule(%q) = %v/%s, want %v/%s", tt.path, r.Rate, r.Mode, tt.rate, tt.mode)
+		}
+	}
+}
+
+func TestSampling_Keep(t *testing.T) {
+	s := Sampling{KeepErrors: true, SlowThreshold: time.Second}
+
+	tests := []struct {
+		sampled  bool
+		status   int
+		duration time.Duration
+		keep     bool
+		reason   string
+	}{
+		{true, 200, 0, true, ReasonSampled},
+		{false, 200, 0, false, ""},
+		{false, 503, 0, true, ReasonError},
+		{false, 404, 0, false, ""},
+		{false, 200, 2 * time.Second, true, ReasonSlow},
+	}
+	for _, tt := range tests {
+		keep, reason := s.keep(tt.sampled, tt.status, tt.duration)
+		if keep != tt.keep || reason != tt.reason {
+			t.Errorf("keep(%v, %d, %s) = %v/%q, want %v/%q", tt.sampled, tt.status, tt.duration, keep, reason, tt.keep, tt.reason)
+		}
+	}
+}
+
+func TestParseSamplingRoutes(t *testing.T) {
+	rules, err := ParseSamplingRoutes([]string{"/api/search=0.1:head", "/api/orders=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Rate != 0.1 || rules[0].Mode != SampleHead || rules[1].Mode != "" {
+		t.Errorf("Unexpected rules: %+v", rules)
+	}
+
+	for _, entry := range []string{"/api", "=0.5", "/api=1.5", "/api=x", "/api=0.5:sometimes"} {
+		if _, err := ParseSamplingRoutes([]string{entry}); err == nil {
+			t.Errorf("Expected %q to fail", entry)
+		}
+	}
+}
+
+// testPublisher returns a publisher whose entries are sent to the returned
+// channel instead of Redis.
+func testPublisher(capture TrafficCapture) (*TrafficPublisher, chan redis.TrafficLog) {
+	p := NewTrafficPublisher(nil, capture, nil)
+	entries := make(chan redis.TrafficLog, 10)
+	p.send = func(ctx context.Context, entry redis.TrafficLog) error {
+		entries <- entry
+		return nil
+	}
+	return p, entries
+}
+
+func TestTrafficPublisher_HeadSkipsBodies(t *testing.T) {
+	p, entries := testPublisher(TrafficCapture{
+		Sampling: Sampling{Rate: 0, Mode: SampleHead, KeepErrors: true},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	handler := p.TrafficLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("Expected the handler to read the body, got %q", body)
+		}
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+	select {
+	case entry := <-entries:
+		if !entry.BodiesOmitted || entry.RequestBody != "" || entry.ResponseBody != "" {
+			t.Errorf("Expected bodies to be omitted, got %+v", entry)
+		}
+		if entry.SampleReason != ReasonError || entry.Status != http.StatusBadGateway {
+			t.Errorf("Expected the error to be kept, got %q (%d)", entry.SampleReason, entry.Status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the error to be published")
+	}
+
+	handler = p.TrafficLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if stats := p.Stats(); stats.SampledOut != 1 {
+		t.Errorf("Expected 1 request sampled out, got %+v", stats)
+	}
+}
+
+func TestTrafficPublisher_DropsWhenFull(t *testing.T) {
+	// Without Run, nothing drains the queue.
+	p, _ := testPublisher(TrafficCapture{Sampling: DefaultSampling(), QueueSize: 2})
+	handler := p.TrafficLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 5; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if stats := p.Stats(); stats.Queued != 2 || stats.Dropped != 3 {
+		t.Errorf("Expected 2 queued and 3 dropped, got %+v", stats)
+	}
+}
+
+func TestTrafficPublisher_ImportRedacts(t *testing.T) {
+	p, entries := testPublisher(TrafficCapture{})
+	imported := []redis.TrafficLog{{
+		Method:          "POST",
+		Path:            "/login",
+		Query:           "token=abc&page=1",
+		RequestHeaders:  map[string][]string{"Authorization": {"Bearer xyz"}, "Content-Type": {"application/json"}},
+		RequestBody:     `{"user":"a","password":"hunter2"}`,
+		ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}},
+		ResponseBody:    `{"ok":true}`,
+	}}
+
+	if err := p.Import(context.Background(), imported); err != nil {
+		t.Fatal(err)
+	}
+	got := <-entries
+	if got.Query != "token=%5BREDACTED%5D&page=1" {
+		t.Errorf("Expected the token to be masked, got %q", got.Query)
+	}
+	if got.RequestHeaders["Authorization"][0] != "[REDACTED]" || strings.Contains(got.RequestBody, "hunter2") {
+		t.Errorf("Expected credentials to be masked, got %v %s", got.RequestHeaders, got.RequestBody)
+	}
+	if imported[0].RequestBody != got.RequestBody {
+		t.Error("Expected entries to be redacted in place")
+	}
+}
+
+type sinkFunc func(ctx context.Context, entry redis.TrafficLog) error
+
+func (f sinkFunc) WriteTraffic(ctx context.Context, entry redis.TrafficLog) error {
+	return f(ctx, entry)
+}
+
+func TestTrafficPublisher_WithoutRedis(t *testing.T) {
+	p := NewTrafficPublisher(nil, TrafficCapture{}, nil)
+	var written []redis.TrafficLog
+	p.AddSink(sinkFunc(func(ctx context.Context, entry redis.TrafficLog) error {
+		written = append(written, entry)
+		return nil
+	}))
+
+	if err := p.Log(context.Background(), redis.TrafficLog{Method: "GET", Path: "/orders"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || written[0].Path != "/orders" {
+		t.Errorf("Expected the entry to reach the sink, got %+v", written)
+	}
+}
@@ -0,0 +1,322 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/diff"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// HeaderShadow marks mirrored requests, so the shadow upstream can tell them
+// from real traffic.
+const HeaderShadow = "X-Chaos-Shadow"
+
+// ShadowConfig selects the requests mirrored to a shadow upstream.
+type ShadowConfig struct {
+	URL         string
+	Percent     float64       // share of requests mirrored, 0-100
+	Timeout     time.Duration // per mirrored request, 0 = 5s
+	MaxInFlight int           // mirrored requests at once, 0 = 50; more are dropped
+	MaxBody     int           // larger request bodies are not mirrored, 0 = MaxBodySize
+	Diff        *diff.Config  // if set, shadow responses are compared with the primary
+}
+
+// ShadowStats reports what the shadow upstream was sent.
+type ShadowStats struct {
+	URL              string  `json:"url"`
+	Percent          float64 `json:"percent"`
+	InFlight         int     `json:"in_flight"`
+	Mirrored         int64   `json:"mirrored"`
+	Dropped          int64   `json:"dropped"` // too many in flight or body too large
+	Failed           int64   `json:"failed"`  // no response, e.g. timed out
+	StatusMismatches int64   `json:"status_mismatches"`
+}
+
+// Shadower mirrors a share of proxied requests to a shadow upstream and
+// discards its responses. Mirroring never delays or alters the response the
+// client gets; shadow exchanges are published to the traffic log with the
+// shadow route.
+type Shadower struct {
+	cfg     ShadowConfig
+	target  *url.URL
+	client  *http.Client
+	traffic *TrafficPublisher
+	differ  *diff.Differ // nil unless cfg.Diff is set
+	slots   chan struct{}
+
+	mirrored   atomic.Int64
+	dropped    atomic.Int64
+	failed     atomic.Int64
+	mismatches atomic.Int64
+
+	mu     sync.Mutex
+	report *diff.Report
+}
+
+// NewShadower creates a Shadower. Without a URL, Mirror passes requests
+// through. Shadow exchanges are logged through traffic, if not nil.
+func NewShadower(cfg ShadowConfig, traffic *TrafficPublisher) (*Shadower, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 50
+	}
+	if cfg.MaxBody <= 0 {
+		cfg.MaxBody = MaxBodySize
+	}
+	s := &Shadower{cfg: cfg, traffic: traffic, slots: make(chan struct{}, cfg.MaxInFlight)}
+	if cfg.URL == "" {
+		return s, nil
+	}
+
+	target, err := url.Parse(cfg.URL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid shadow URL %q", cfg.URL)
+	}
+	if cfg.Percent < 0 || cfg.Percent > 100 {
+		return nil, fmt.Errorf("shadow percent must be between 0 and 100, got %v", cfg.Percent)
+	}
+	if cfg.Diff != nil {
+		if s.differ, err = diff.New(*cfg.Diff); err != nil {
+			return nil, err
+		}
+		s.report = diff.NewReport()
+	}
+	s.target = target
+	s.client = &http.Client{
+		Timeout:       cfg.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return s, nil
+}
+
+// Stats returns the mirroring counters.
+func (s *Shadower) Stats() ShadowStats {
+	return ShadowStats{
+		URL:              s.cfg.URL,
+		Percent:          s.cfg.Percent,
+		InFlight:         len(s.slots),
+		Mirrored:         s.mirrored.Load(),
+		Dropped:          s.dropped.Load(),
+		Failed:           s.failed.Load(),
+		StatusMismatches: s.mismatches.Load(),
+	}
+}
+
+// Report returns the live diff of shadow and primary responses, or nil if
+// diffing is off.
+func (s *Shadower) Report() *diff.Report {
+	if s.report == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Finish()
+	report := *s.report
+	report.Kinds = make(map[string]int, len(s.report.Kinds))
+	for k, v := range s.report.Kinds {
+		report.Kinds[k] = v
+	}
+	return &report
+}
+
+// primaryResult is the response the client got, for the live diff.
+type primaryResult struct {
+	status   int
+	body     []byte
+	altered  bool // Ghost Mode or chaos answered or changed the request
+	complete bool // body captured whole
+}
+
+// Mirror sends the selected requests to the shadow upstream as well.
+func (s *Shadower) Mirror(next http.Handler) http.Handler {
+	if s.target == nil {
+		return next
+	}
+	log.Printf("🪞 Shadow Mirroring Enabled: copying %v%% of requests to %s", s.cfg.Percent, s.cfg.URL)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID, _ := r.Context().Value(RequestIDKey).(string)
+		// Upgrades and event streams are long-lived; mirroring them would
+		// hold a slot for as long as the client stays connected.
+		if !sampled(reqID, s.cfg.Percent/100) || r.Header.Get("Upgrade") != "" ||
+			strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, truncated := captureRequestBody(r, s.cfg.MaxBody)
+		if truncated {
+			s.dropped.Add(1)
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			if n := s.dropped.Add(1); n == 1 || n%1000 == 0 {
+				log.Printf("⚠️ Shadow upstream saturated, %d requests not mirrored so far", n)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.mirrored.Add(1)
+		var primary chan primaryResult
+		if s.differ != nil {
+			primary = make(chan primaryResult, 1)
+		}
+		go s.shadow(r.Clone(context.Background()), reqID, body, primary)
+
+		if primary == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The shadow waits for the primary response, even after a panic.
+		var result primaryResult
+		defer func() { primary <- result }()
+		cw := newCaptureWriter(w, s.cfg.MaxBody)
+		next.ServeHTTP(cw, r)
+		respBody, _, truncated := decodeBody(cw.body.Bytes(), w.Header(), s.cfg.MaxBody)
+		result = primaryResult{
+			status:   cw.statusCode,
+			body:     respBody,
+			altered:  !TrafficMetaFrom(r.Context()).untouched(),
+			complete: !cw.truncated && !truncated && !cw.streamed,
+		}
+	})
+}
+
+// shadow sends one mirrored request and logs the exchange. It holds a slot
+// until done.
+func (s *Shadower) shadow(r *http.Request, reqID string, body []byte, primary <-chan primaryResult) {
+	defer func() { <-s.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+	defer cancel()
+
+	u := *s.target
+	u.Path = strings.TrimRight(u.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequestWithContext(ctx, r.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range []string{"Connection", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade", "Accept-Encoding"} {
+		req.Header.Del(h)
+	}
+	// Mirror wraps Chaos, so the directives are still on the request here.
+	stripDirectiveHeaders(req.Header)
+	req.Header.Set(HeaderShadow, "true")
+	if reqID != "" {
+		req.Header.Set("X-Request-ID", reqID)
+	}
+
+	start := time.Now()
+	entry := redis.TrafficLog{
+		Version:   redis.TrafficLogVersion,
+		Timestamp: start,
+		RequestID: reqID,
+		ClientIP:  getRealIP(r),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.RawQuery,
+		Route:     redis.RouteShadow,
+		Upstream:  s.target.String(),
+	}
+	entry.RequestBody, entry.RequestBase64 = bodyText(body, r.Header.Get("Content-Type"))
+
+	var respBody []byte
+	resp, err := s.client.Do(req)
+	if err == nil {
+		respBody, err = io.ReadAll(io.LimitReader(resp.Body, int64(s.cfg.MaxBody)+1))
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		entry.Status = resp.StatusCode
+		if len(respBody) > s.cfg.MaxBody {
+			respBody, entry.ResponseTruncated = respBody[:s.cfg.MaxBody], true
+		}
+		entry.ResponseBody, entry.ResponseBase64 = bodyText(respBody, resp.Header.Get("Content-Type"))
+	}
+	duration := time.Since(start)
+	entry.DurationMs = float64(duration.Microseconds()) / 1000
+	entry.Duration = duration.String()
+	if err != nil {
+		s.failed.Add(1)
+		entry.Error = err.Error()
+	}
+
+	if primary != nil {
+		// A long-polling primary is not waited for past the shadow timeout,
+		// so it cannot hold the slot; the exchange is logged without a diff.
+		wait := time.NewTimer(s.cfg.Timeout)
+		select {
+		case p := <-primary:
+			entry.PrimaryStatus = p.status
+			if err == nil {
+				s.compare(&entry, p, respBody)
+			}
+		case <-wait.C:
+		}
+		wait.Stop()
+	}
+
+	if s.traffic != nil {
+		entry.RequestHeaders = s.traffic.capture.headers(r.Header)
+		if resp != nil {
+			entry.ResponseHeaders = s.traffic.capture.headers(resp.Header)
+		}
+		if err := s.traffic.Log(context.Background(), entry); err != nil {
+			log.Printf("Failed to publish shadow traffic log: %v", err)
+		}
+	}
+}
+
+// compare diffs the shadow response with an untouched primary one when both
+// are complete and the status matches. A primary status set by chaos or
+// Ghost Mode is not counted as a mismatch.
+func (s *Shadower) compare(entry *redis.TrafficLog, p primaryResult, body []byte) {
+	if p.status == 0 || p.altered {
+		return // the primary handler panicked or Sentinel answered
+	}
+	if entry.Status != p.status {
+		s.mismatches.Add(1)
+		return
+	}
+	if !p.complete || entry.ResponseTruncated {
+		return
+	}
+	var changes []diff.Change
+	if entry.ResponseBase64 {
+		changes = diff.CompareBinary(p.body, body)
+	} else {
+		changes = s.differ.Compare(entry.Path, p.body, body)
+	}
+	if s.traffic != nil {
+		// Mask the values like the bodies they were taken from, for both
+		// the traffic log and the report examples.
+		changes = redactChanges(s.traffic.redactor.For(entry.Path), changes)
+	}
+	entry.Changes = make([]redis.BodyChange, len(changes))
+	for i, c := range changes {
+		entry.Changes[i] = redis.BodyChange{Path: c.Path, Kind: c.Kind, Old: c.Old, New: c.New}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Add(entry.Method, entry.Path, changes)
+}
@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/diff"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/redact"
+)
+
+func nextEntry(t *testing.T, entries chan redis.TrafficLog) redis.TrafficLog {
+	t.Helper()
+	select {
+	case e := <-entries:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the shadow traffic log")
+		return redis.TrafficLog{}
+	}
+}
+
+func TestShadower_Mirror(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	shadowUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- string(body)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("shadow"))
+	}))
+	defer shadowUpstream.Close()
+
+	traffic, entries := testPublisher(TrafficCapture{Headers: []string{"Content-Type"}})
+	s, err := NewShadower(ShadowConfig{URL: shadowUpstream.URL + "/v2", Percent: 100}, traffic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("primary:" + string(body)))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?x=1", strings.NewReader("payload"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(ChaosSecretHeader, "directive-secret")
+	req.Header.Set(ChaosInjectHeader, "status=503")
+	req.Header.Set(ChaosRegionHeader, "eu-west")
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDKey, "req-1"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "primary:payload" {
+		t.Errorf("Expected the client to get the primary response, got %d %q", rec.Code, rec.Body.String())
+	}
+	r := <-received
+	if r.URL.Path != "/v2/orders" || r.URL.RawQuery != "x=1" || r.Header.Get(HeaderShadow) != "true" || r.Header.Get("X-Request-ID") != "req-1" {
+		t.Errorf("Unexpected shadow request: %s %v", r.URL, r.Header)
+	}
+	for _, h := range []string{ChaosSecretHeader, ChaosInjectHeader, ChaosRegionHeader} {
+		if r.Header.Get(h) != "" {
+			t.Errorf("Expected %s not to reach the shadow upstream", h)
+		}
+	}
+	if body := <-bodies; body != "payload" {
+		t.Errorf("Expected the body to be mirrored, got %q", body)
+	}
+
+	e := nextEntry(t, entries)
+	if e.Route != redis.RouteShadow || e.Status != http.StatusTeapot || e.ResponseBody != "shadow" || e.RequestID != "req-1" {
+		t.Errorf("Unexpected shadow log: %+v", e)
+	}
+	if _, ok := e.RequestHeaders["Authorization"]; ok {
+		t.Errorf("Expected only captured headers to be logged, got %v", e.RequestHeaders)
+	}
+	if stats := s.Stats(); stats.Mirrored != 1 || stats.Failed != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if s.Report() != nil {
+		t.Error("Expected no report without diffing")
+	}
+}
+
+func TestShadower_Disabled(t *testing.T) {
+	s, err := NewShadower(ShadowConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if h := s.Mirror(next); h == nil {
+		t.Fatal("Expected a handler")
+	}
+	for _, cfg := range []ShadowConfig{{URL: "shadow:8080"}, {URL: "http://shadow", Percent: 120}} {
+		if _, err := NewShadower(cfg, nil); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestShadower_CapAndTimeout(t *testing.T) {
+	release := make(chan struct{})
+	shadowUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer shadowUpstream.Close()
+	defer close(release)
+
+	traffic, entries := testPublisher(TrafficCapture{})
+	s, _ := NewShadower(ShadowConfig{URL: shadowUpstream.URL, Percent: 100, MaxInFlight: 1, Timeout: 50 * time.Millisecond}, traffic)
+	handler := s.Mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("Expected mirroring not to delay the client, took %v", elapsed)
+	}
+
+	e := nextEntry(t, entries)
+	if e.Error == "" || e.Status != 0 {
+		t.Errorf("Expected a timed out shadow entry, got %+v", e)
+	}
+	if stats := s.Stats(); stats.Mirrored != 1 || stats.Dropped != 2 || stats.Failed != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestShadower_SlowPrimary(t *testing.T) {
+	shadowUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer shadowUpstream.Close()
+
+	traffic, entries := testPublisher(TrafficCapture{})
+	s, _ := NewShadower(ShadowConfig{URL: shadowUpstream.URL, Percent: 100, Timeout: 50 * time.Millisecond, Diff: &diff.Config{}}, traffic)
+	release := make(chan struct{})
+	handler := s.Mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/poll", nil))
+		close(done)
+	}()
+	if e := nextEntry(t, entries); e.PrimaryStatus != 0 || e.Status != http.StatusOK {
+		t.Errorf("Expected the shadow to stop waiting for a long-polling primary, got %+v", e)
+	}
+	for i := 0; i < 100 && s.Stats().InFlight > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := s.Stats(); stats.InFlight != 0 {
+		t.Errorf("Expected the slot to be released, got %+v", stats)
+	}
+	close(release)
+	<-done
+
+	stream := httptest.NewRequest(http.MethodGet, "/events", nil)
+	stream.Header.Set("Accept", "text/event-stream")
+	handler.ServeHTTP(httptest.NewRecorder(), stream)
+	if stats := s.Stats(); stats.Mirrored != 1 {
+		t.Errorf("Expected event streams not to be mirrored, got %+v", stats)
+	}
+}
+
+func TestShadower_Diff(t *testing.T) {
+	shadowUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte(`{"id": 2, "price": 11, "currency": "EUR", "token": "shadow-secret"}`))
+	}))
+	defer shadowUpstream.Close()
+
+	traffic, entries := testPublisher(TrafficCapture{})
+	s, _ := NewShadower(ShadowConfig{URL: shadowUpstream.URL, Percent: 100, Diff: &diff.Config{Ignore: []string{"$.id"}}}, traffic)
+	handler := s.Mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "price": 10, "token": "primary-secret"}`))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+	e := nextEntry(t, entries)
+	if e.PrimaryStatus != http.StatusOK || len(e.Changes) != 3 {
+		t.Errorf("Expected the price, currency and token to differ, got %+v", e.Changes)
+	}
+	for _, c := range e.Changes {
+		if c.Path == "$.token" && (c.Old != redact.Mask || c.New != redact.Mask) {
+			t.Errorf("Expected the token values to be masked, got %+v", c)
+		}
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if e := nextEntry(t, entries); e.Status != http.StatusNotFound || e.PrimaryStatus != http.StatusOK || len(e.Changes) != 0 {
+		t.Errorf("Expected a status mismatch without changes, got %+v", e)
+	}
+
+	report := s.Report()
+	if report.Compared != 1 || report.Different != 1 || report.Routes[0].Path != "/items/{id}" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	for _, c := range report.Routes[0].Changes {
+		if c.Path == "$.token" && c.Example.Old != redact.Mask {
+			t.Errorf("Expected the report example to be masked, got %+v", c.Example)
+		}
+	}
+	if stats := s.Stats(); stats.StatusMismatches != 1 {
+		t.Errorf("Expected one status mismatch, got %+v", stats)
+	}
+
+	// A status injected by chaos on the primary is not a regression.
+	injected := s.Mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		TrafficMetaFrom(r.Context()).AddChaos("failure", "flaky", "500")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/items/2", nil)
+	req = req.WithContext(WithTrafficMeta(req.Context(), &TrafficMeta{}))
+	injected.ServeHTTP(httptest.NewRecorder(), req)
+	if e := nextEntry(t, entries); e.PrimaryStatus != http.StatusInternalServerError || len(e.Changes) != 0 {
+		t.Errorf("Expected the chaos-injected primary not to be compared, got %+v", e)
+	}
+	if stats := s.Stats(); stats.StatusMismatches != 1 {
+		t.Errorf("Expected injected statuses not to count as mismatches, got %+v", stats)
+	}
+}
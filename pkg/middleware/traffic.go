@@ -1,149 +1,385 @@
 package middleware
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"io"
+	"encoding/base64"
 	"log"
 	"net/http"
-	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/elliot/chaosProxy/pkg/codec"
+	"github.com/elliot/chaosProxy/pkg/diff"
 	"github.com/elliot/chaosProxy/pkg/graphql"
 	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+	"github.com/elliot/chaosProxy/pkg/redact"
 )
 
 const (
 	MaxBodySize = 1024 * 1024 // 1MB limit
 )
 
-// Sensitive headers that should not be logged
-var sensitiveHeaders = map[string]bool{
-	"authorization":  true,
-	"cookie":         true,
-	"x-api-key":      true,
-	"x-auth-token":   true,
-	"x-access-token": true,
-	"set-cookie":     true,
+// TrafficCapture selects what the traffic log stores and how it is
+// published. Header values are masked by the redaction policy; bodies beyond
+// MaxBody bytes are truncated.
+type TrafficCapture struct {
+	Headers   []string // header names, or "*" for all
+	MaxBody   int      // bytes per body, 0 = MaxBodySize
+	Sampling  Sampling // zero value = DefaultSampling
+	Workers   int      // publishing workers, 0 = 4
+	QueueSize int      // entries waiting for a worker, 0 = 1000
+	Storage   redis.TrafficStorage
 }
 
-// Patterns to mask in request/response bodies
-var sensitivePatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)"password"\s*:\s*"[^"]*"`),
-	regexp.MustCompile(`(?i)"token"\s*:\s*"[^"]*"`),
-	regexp.MustCompile(`(?i)"secret"\s*:\s*"[^"]*"`),
-	regexp.MustCompile(`(?i)"api_key"\s*:\s*"[^"]*"`),
-	regexp.MustCompile(`(?i)"credit_card"\s*:\s*"[^"]*"`),
+// headers returns the selected headers of h.
+func (tc TrafficCapture) headers(h http.Header) map[string][]string {
+	if len(tc.Headers) == 0 {
+		return nil
+	}
+
+	selected := make(map[string][]string)
+	for _, name := range tc.Headers {
+		if name == "*" {
+			for k, v := range h {
+				selected[k] = v
+			}
+			continue
+		}
+		if v := h.Values(name); len(v) > 0 {
+			selected[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	return selected
+}
+
+// decodeBody undoes the Content-Encoding of a captured body, keeping at most
+// limit decoded bytes. It returns the coding it removed and whether the
+// decoded body was cut at limit, or the body as received if it cannot be
+// decoded.
+func decodeBody(body []byte, h http.Header, limit int) ([]byte, string, bool) {
+	enc := h.Get("Content-Encoding")
+	if enc == "" || len(body) == 0 {
+		return body, "", false
+	}
+	decoded, err := codec.Decode(body, enc, int64(limit)+1)
+	if err != nil {
+		log.Printf("[Traffic] Cannot decode %s body: %v", enc, err)
+		return body, "", false
+	}
+	if len(decoded) > limit {
+		return decoded[:limit], enc, true
+	}
+	return decoded, enc, false
 }
 
-// responseWriterWrapper wraps http.ResponseWriter to capture the status and body
-type responseWriterWrapper struct {
-	http.ResponseWriter
-	statusCode int
-	body       *bytes.Buffer
+// bodyText returns a body as stored in the traffic log: binary bodies are
+// base64-encoded and flagged.
+func bodyText(body []byte, contentType string) (string, bool) {
+	if codec.IsBinary(contentType, body) {
+		return base64.StdEncoding.EncodeToString(body), true
+	}
+	return string(body), false
 }
 
-func (rw *responseWriterWrapper) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
+// TrafficPublisher captures proxied traffic and publishes it to the brain
+// through a bounded pool of workers. When the queue is full, entries are
+// dropped and counted rather than piling up goroutines.
+type TrafficPublisher struct {
+	capture  TrafficCapture
+	redactor *redact.Redactor
+	send     func(ctx context.Context, entry redis.TrafficLog) error
+	sinks    []TrafficSink
+	jobs     chan func()
+
+	published  atomic.Int64
+	dropped    atomic.Int64
+	sampledOut atomic.Int64
 }
 
-func (rw *responseWriterWrapper) Write(b []byte) (int, error) {
-	rw.body.Write(b)
-	return rw.ResponseWriter.Write(b)
+// TrafficSink receives every published entry, e.g. the local archive.
+type TrafficSink interface {
+	WriteTraffic(ctx context.Context, entry redis.TrafficLog) error
 }
 
-// sanitizeBody masks sensitive data in the body
-func sanitizeBody(body string) string {
-	for _, pattern := range sensitivePatterns {
-		body = pattern.ReplaceAllString(body, `"[REDACTED]"`)
-	}
-	return body
+// TrafficStats reports the state of the publishing pool.
+type TrafficStats struct {
+	Workers    int   `json:"workers"`
+	QueueSize  int   `json:"queue_size"`
+	Queued     int   `json:"queued"`
+	Published  int64 `json:"published"`
+	Dropped    int64 `json:"dropped"`     // queue full
+	SampledOut int64 `json:"sampled_out"` // not selected by sampling
 }
 
-// hasSensitiveHeader checks if request has sensitive headers
-func hasSensitiveHeader(r *http.Request) bool {
-	for header := range r.Header {
-		if sensitiveHeaders[strings.ToLower(header)] {
-			return true
+// NewTrafficPublisher creates a publisher. A nil redactor uses
+// redact.DefaultPolicy. Workers start with Run.
+func NewTrafficPublisher(redisClient *redis.Client, capture TrafficCapture, redactor *redact.Redactor) *TrafficPublisher {
+	if redactor == nil {
+		redactor, _ = redact.New(redact.Config{})
+	}
+	if capture.MaxBody <= 0 {
+		capture.MaxBody = MaxBodySize
+	}
+	if capture.Sampling.Mode == "" && capture.Sampling.Rate == 0 && len(capture.Sampling.Routes) == 0 {
+		capture.Sampling = DefaultSampling()
+	}
+	if capture.Workers <= 0 {
+		capture.Workers = 4
+	}
+	if capture.QueueSize <= 0 {
+		capture.QueueSize = 1000
+	}
+
+	p := &TrafficPublisher{
+		capture:  capture,
+		redactor: redactor,
+		jobs:     make(chan func(), capture.QueueSize),
+		// Without Redis, entries only go to the sinks.
+		send: func(ctx context.Context, entry redis.TrafficLog) error { return nil },
+	}
+	if redisClient != nil {
+		p.send = func(ctx context.Context, entry redis.TrafficLog) error {
+			return redisClient.PublishTraffic(ctx, entry, capture.Storage)
 		}
 	}
-	return false
+	return p
 }
 
-func TrafficLogger(redisClient *redis.Client) Middleware {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
+// AddSink writes published entries to sink as well. It must be called
+// before Run.
+func (p *TrafficPublisher) AddSink(sink TrafficSink) {
+	p.sinks = append(p.sinks, sink)
+}
 
-			// 1. Capture Request Body with Size Limit
-			var reqBody []byte
-			if r.Body != nil {
-				// Limit body size to prevent DoS
-				limitedReader := io.LimitReader(r.Body, MaxBodySize)
-				reqBody, _ = io.ReadAll(limitedReader)
-				r.Body = io.NopCloser(bytes.NewBuffer(reqBody)) // Restore body
+// Run processes queued entries with the configured number of workers until
+// ctx is done.
+func (p *TrafficPublisher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.capture.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					job()
+				}
 			}
+		}()
+	}
+	wg.Wait()
+}
 
-			// 2. Wrap Response Writer
-			wrapper := &responseWriterWrapper{
-				ResponseWriter: w,
-				statusCode:     http.StatusOK,
-				body:           &bytes.Buffer{},
-			}
+// Stats returns the publishing counters.
+func (p *TrafficPublisher) Stats() TrafficStats {
+	return TrafficStats{
+		Workers:    p.capture.Workers,
+		QueueSize:  p.capture.QueueSize,
+		Queued:     len(p.jobs),
+		Published:  p.published.Load(),
+		Dropped:    p.dropped.Load(),
+		SampledOut: p.sampledOut.Load(),
+	}
+}
 
-			// 3. Process Request
-			next.ServeHTTP(wrapper, r)
+// submit queues a job without blocking.
+func (p *TrafficPublisher) submit(job func()) {
+	select {
+	case p.jobs <- job:
+	default:
+		if n := p.dropped.Add(1); n == 1 || n%1000 == 0 {
+			log.Printf("⚠️ Traffic queue full, %d entries dropped so far", n)
+		}
+	}
+}
 
-			// 4. Async Log to Redis (with sanitization)
-			duration := time.Since(start)
+// TrafficLogger publishes the requests selected by sampling, masked by the
+// route's redaction policy. Other middlewares and the proxies add metadata
+// through TrafficMetaFrom(r.Context()).
+func (p *TrafficPublisher) TrafficLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		meta := &TrafficMeta{}
+		r = r.WithContext(WithTrafficMeta(r.Context(), meta))
 
-			go func() {
-				// Skip logging if request has sensitive headers
-				if hasSensitiveHeader(r) {
-					log.Printf("[Traffic] Skipped logging for %s %s (sensitive headers)", r.Method, r.URL.Path)
-					return
-				}
+		reqID, _ := r.Context().Value(RequestIDKey).(string)
+		rule := p.capture.Sampling.rule(r.URL.Path)
+		isSampled := sampled(reqID, rule.Rate)
+		// Head sampling skips body capture for unsampled requests.
+		bodies := isSampled || rule.Mode != SampleHead
 
-				// Sanitize bodies
-				sanitizedReqBody := sanitizeBody(string(reqBody))
-				sanitizedRespBody := sanitizeBody(wrapper.body.String())
-
-				// Create log entry
-				entry := redis.TrafficLog{
-					Timestamp:    start,
-					Method:       r.Method,
-					Path:         r.URL.Path,
-					RequestBody:  sanitizedReqBody,
-					Status:       wrapper.statusCode,
-					ResponseBody: sanitizedRespBody,
-					Duration:     duration.String(),
-				}
+		// 1. Capture Request Body with Size Limit
+		var reqBody []byte
+		var reqTruncated bool
+		if bodies {
+			reqBody, reqTruncated = captureRequestBody(r, p.capture.MaxBody)
+		}
 
-				// Try to extract GraphQL Operation
-				if r.Method == http.MethodPost && strings.Contains(r.Header.Get("Content-Type"), "application/json") {
-					if op, err := graphql.ParseRequest(reqBody); err == nil && op != nil {
-						opName := op.Name
-						if op.Type == "mutation" {
-							opName = "Mutation: " + opName
-						}
-						entry.GraphQLOperation = opName
-					}
-				}
+		// 2. Wrap Response Writer
+		limit := p.capture.MaxBody
+		if !bodies {
+			limit = 0
+		}
+		wrapper := newCaptureWriter(w, limit)
 
-				// Encode to JSON
-				data, err := json.Marshal(entry)
-				if err != nil {
-					log.Printf("Failed to marshal log entry: %v", err)
-					return
-				}
+		// 3. Process Request
+		next.ServeHTTP(wrapper, r)
+
+		// 4. Sample, then Log to Redis asynchronously (with sanitization)
+		duration := time.Since(start)
+		keep, reason := p.capture.Sampling.keep(isSampled, wrapper.statusCode, duration)
+		if !keep {
+			p.sampledOut.Add(1)
+			return
+		}
+		respHeaders := w.Header().Clone()
+
+		p.submit(func() {
+			policy := p.redactor.For(r.URL.Path)
+			respBody, respEncoding, respTruncated := wrapper.body.Bytes(), "", wrapper.truncated
+			// A truncated body cannot be decompressed; it is stored as received.
+			// A body that decompresses past the limit is cut and flagged too.
+			if !reqTruncated {
+				reqBody, _, reqTruncated = decodeBody(reqBody, r.Header, p.capture.MaxBody)
+			}
+			if !respTruncated {
+				respBody, respEncoding, respTruncated = decodeBody(respBody, respHeaders, p.capture.MaxBody)
+			}
+			reqText, reqBase64 := bodyText(reqBody, r.Header.Get("Content-Type"))
+			respText, respBase64 := bodyText(respBody, respHeaders.Get("Content-Type"))
+			if !reqBase64 {
+				reqText = policy.Body(reqText, r.Header.Get("Content-Type"))
+			}
+			if !respBase64 {
+				respText = policy.Body(respText, respHeaders.Get("Content-Type"))
+			}
 
-				if err := redisClient.GetRawClient().Publish(context.Background(), "chaos:traffic", data).Err(); err != nil {
-					log.Printf("Failed to publish traffic log: %v", err)
+			// Create log entry
+			entry := redis.TrafficLog{
+				Version:           redis.TrafficLogVersion,
+				Timestamp:         start,
+				RequestID:         reqID,
+				ClientIP:          getRealIP(r),
+				Method:            r.Method,
+				Path:              r.URL.Path,
+				Query:             policy.Query(r.URL.RawQuery),
+				RequestHeaders:    policy.Headers(p.capture.headers(r.Header)),
+				RequestBody:       reqText,
+				RequestBase64:     reqBase64,
+				RequestTruncated:  reqTruncated,
+				Status:            wrapper.statusCode,
+				ResponseHeaders:   policy.Headers(p.capture.headers(respHeaders)),
+				ResponseBody:      respText,
+				ResponseBase64:    respBase64,
+				ResponseTruncated: respTruncated,
+				Streamed:          wrapper.streamed,
+				ContentEncoding:   respEncoding,
+				BodiesOmitted:     !bodies,
+				DurationMs:        float64(duration.Microseconds()) / 1000,
+				Duration:          duration.String(),
+			}
+			if rule.Rate < 1 {
+				entry.SampleRate = rule.Rate
+				entry.SampleReason = reason
+			}
+			meta.fill(&entry)
+			policy.Record(diff.RoutePath(r.URL.Path))
+
+			// Try to extract GraphQL Operation
+			if r.Method == http.MethodPost && strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+				if op, err := graphql.ParseRequest(reqBody); err == nil && op != nil {
+					opName := op.Name
+					if op.Type == "mutation" {
+						opName = "Mutation: " + opName
+					}
+					entry.GraphQLOperation = opName
 				}
-			}()
+			}
+
+			if err := p.publish(context.Background(), entry); err != nil {
+				log.Printf("Failed to publish traffic log: %v", err)
+			}
 		})
+	})
+}
+
+// publish sends an entry to Redis and every sink. Sink failures are logged.
+func (p *TrafficPublisher) publish(ctx context.Context, entry redis.TrafficLog) error {
+	for _, sink := range p.sinks {
+		if err := sink.WriteTraffic(ctx, entry); err != nil {
+			log.Printf("Failed to write traffic log: %v", err)
+		}
+	}
+	if err := p.send(ctx, entry); err != nil {
+		return err
+	}
+	p.published.Add(1)
+	return nil
+}
+
+// Import publishes entries recorded elsewhere, such as a HAR file, masked
+// by the redaction policy like captured traffic. Entries are redacted in
+// place.
+func (p *TrafficPublisher) Import(ctx context.Context, entries []redis.TrafficLog) error {
+	for i := range entries {
+		p.redact(&entries[i])
+		if err := p.publish(ctx, entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Log publishes an entry built outside the traffic logger, such as a
+// shadow exchange, masked by the redaction policy.
+func (p *TrafficPublisher) Log(ctx context.Context, entry redis.TrafficLog) error {
+	p.redact(&entry)
+	return p.publish(ctx, entry)
+}
+
+// redact masks an entry in place.
+func (p *TrafficPublisher) redact(e *redis.TrafficLog) {
+	policy := p.redactor.For(e.Path)
+	e.Query = policy.Query(e.Query)
+	e.RequestHeaders = policy.Headers(e.RequestHeaders)
+	e.ResponseHeaders = policy.Headers(e.ResponseHeaders)
+	if !e.RequestBase64 {
+		e.RequestBody = policy.Body(e.RequestBody, http.Header(e.RequestHeaders).Get("Content-Type"))
+	}
+	if !e.ResponseBase64 {
+		e.ResponseBody = policy.Body(e.ResponseBody, http.Header(e.ResponseHeaders).Get("Content-Type"))
+	}
+	policy.Record(diff.RoutePath(e.Path))
+}
+
+// redactChanges returns a copy of changes with the old and new values
+// masked as they would be in the bodies they were taken from. Values whose
+// path cannot be read are masked whole.
+func redactChanges(policy *redact.Rules, changes []diff.Change) []diff.Change {
+	if len(changes) == 0 {
+		return changes
+	}
+	masked := make([]diff.Change, len(changes))
+	for i, c := range changes {
+		path, err := diff.SplitPath(c.Path)
+		if err != nil {
+			if c.Old != nil {
+				c.Old = redact.Mask
+			}
+			if c.New != nil {
+				c.New = redact.Mask
+			}
+		} else {
+			c.Old, c.New = policy.Value(path, c.Old), policy.Value(path, c.New)
+		}
+		masked[i] = c
 	}
+	return masked
 }
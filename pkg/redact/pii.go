@@ -0,0 +1,192 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// PII kinds.
+const (
+	PIIEmail  = "email"
+	PIIPhone  = "phone"
+	PIICard   = "card"    // Luhn-valid payment card numbers
+	PIIIBAN   = "iban"    // mod-97 valid IBANs
+	PIIJWT    = "jwt"     // JSON Web Tokens
+	PIIAWSKey = "aws_key" // AWS access key IDs and secret keys
+	PIISSN    = "ssn"     // US social security numbers
+	PIITCKN   = "tckn"    // Turkish national ID numbers
+)
+
+// PIIKinds lists every detectable kind, in detection order.
+var PIIKinds = []string{PIIJWT, PIIAWSKey, PIIEmail, PIIIBAN, PIICard, PIISSN, PIITCKN, PIIPhone}
+
+// detector finds one kind of PII by value. valid, if set, rejects matches
+// whose checksum or structure is wrong.
+type detector struct {
+	kind  string
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+var detectors = map[string][]detector{
+	PIIJWT: {{re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{4,}\.eyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]*`)}},
+	PIIAWSKey: {
+		{re: regexp.MustCompile(`\b(?:AKIA|ASIA|AIDA|AROA|AGPA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)},
+		{re: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`)},
+	},
+	PIIEmail: {{re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)}},
+	PIIIBAN:  {{re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), valid: validIBAN}},
+	PIICard:  {{re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: validCard}},
+	PIISSN:   {{re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), valid: validSSN}},
+	PIITCKN:  {{re: regexp.MustCompile(`\b[1-9]\d{10}\b`), valid: validTCKN}},
+	PIIPhone: {
+		{re: regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?){2,5}\b`), valid: validPhone}, // international
+		{re: regexp.MustCompile(`(?:\(\d{3}\) ?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b`)},              // North American
+	},
+}
+
+func init() {
+	for kind, list := range detectors {
+		for i := range list {
+			list[i].kind = kind
+		}
+	}
+}
+
+// piiDetectors returns the detectors for kinds, in PIIKinds order.
+func piiDetectors(kinds map[string]bool) []detector {
+	var list []detector
+	for _, kind := range PIIKinds {
+		if kinds[kind] {
+			list = append(list, detectors[kind]...)
+		}
+	}
+	return list
+}
+
+func validPIIKind(kind string) bool {
+	_, ok := detectors[kind]
+	return ok
+}
+
+// token replaces a PII value. Without a key it is Mask; with a key it is a
+// keyed hash, so the same value always gets the same token.
+func token(key []byte, kind, value string) string {
+	if len(key) == 0 {
+		return Mask
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s:%s", kind, normalizePII(kind, value))
+	return "[" + strings.ToUpper(kind) + ":" + hex.EncodeToString(mac.Sum(nil)[:6]) + "]"
+}
+
+// normalizePII makes formatting variants of a value tokenize alike.
+func normalizePII(kind, value string) string {
+	switch kind {
+	case PIIEmail:
+		return strings.ToLower(value)
+	case PIICard, PIIIBAN, PIIPhone, PIISSN:
+		return strings.Map(func(r rune) rune {
+			if r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' {
+				return -1
+			}
+			return r
+		}, value)
+	}
+	return value
+}
+
+func digits(s string) []int {
+	var d []int
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			d = append(d, int(r-'0'))
+		}
+	}
+	return d
+}
+
+// validCard checks the issuer prefix and the Luhn checksum.
+func validCard(s string) bool {
+	d := digits(s)
+	if len(d) < 13 || len(d) > 19 {
+		return false
+	}
+	prefix := d[0]*10 + d[1]
+	switch {
+	case d[0] == 4: // Visa
+	case prefix >= 51 && prefix <= 55, prefix >= 22 && prefix <= 27: // Mastercard
+	case prefix == 34 || prefix == 37: // Amex
+	case prefix == 60 || prefix == 65: // Discover
+	case prefix == 35: // JCB
+	default:
+		return false
+	}
+
+	sum := 0
+	for i := range d {
+		n := d[len(d)-1-i]
+		if i%2 == 1 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks the length and the mod-97 checksum.
+func validIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+
+	var numeric strings.Builder
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			numeric.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			fmt.Fprint(&numeric, int(r-'A')+10)
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validPhone checks the length of an international number.
+func validPhone(s string) bool {
+	n := len(digits(s))
+	return n >= 8 && n <= 15
+}
+
+// validSSN rejects area, group and serial numbers that are never issued.
+func validSSN(s string) bool {
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validTCKN checks both check digits of a Turkish national ID number.
+func validTCKN(s string) bool {
+	d := digits(s)
+	odd := d[0] + d[2] + d[4] + d[6] + d[8]
+	even := d[1] + d[3] + d[5] + d[7]
+	if ((odd*7-even)%10+10)%10 != d[9] {
+		return false
+	}
+	sum := 0
+	for _, n := range d[:10] {
+		sum += n
+	}
+	return sum%10 == d[10]
+}
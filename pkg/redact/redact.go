@@ -0,0 +1,416 @@
+// Package redact masks credentials and personal data in traffic log entries.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mask replaces every redacted value.
+const Mask = "[REDACTED]"
+
+// Policy describes what to mask. Names are case-insensitive.
+type Policy struct {
+	Headers     []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	QueryParams []string `json:"query_params,omitempty" yaml:"query_params,omitempty"`
+	Fields      []string `json:"fields,omitempty" yaml:"fields,omitempty"`         // JSON keys masked at any depth
+	JSONPaths   []string `json:"json_paths,omitempty" yaml:"json_paths,omitempty"` // e.g. "user.ssn", "items.*.card"
+	Patterns    []string `json:"patterns,omitempty" yaml:"patterns,omitempty"`     // regexes masked in bodies and query values
+	PII         []string `json:"pii,omitempty" yaml:"pii,omitempty"`               // PII kinds detected by value
+}
+
+// Route applies an additional policy to paths starting with PathPrefix.
+type Route struct {
+	PathPrefix string `json:"path_prefix" yaml:"path_prefix"`
+	Policy     `yaml:",inline"`
+}
+
+// Config is a redaction policy file. Its default policy and every route
+// policy extend DefaultPolicy; nothing can unmask the built-in credentials.
+type Config struct {
+	Default Policy  `json:"default" yaml:"default"`
+	Routes  []Route `json:"routes,omitempty" yaml:"routes,omitempty"`
+
+	// TokenKey, if set, replaces detected PII with a keyed hash instead of
+	// Mask, so equal values get equal tokens across entries.
+	TokenKey []byte `json:"-" yaml:"-"`
+}
+
+// DefaultPolicy masks common credentials.
+func DefaultPolicy() Policy {
+	return Policy{
+		Headers:     []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token", "X-Access-Token", "X-Admin-Token", "X-Chaos-Secret"},
+		QueryParams: []string{"token", "access_token", "api_key", "apikey", "password", "secret", "signature"},
+		Fields:      []string{"password", "token", "secret", "api_key", "credit_card", "access_token", "refresh_token"},
+		Patterns:    []string{`(?i)bearer\s+[a-z0-9._~+/=-]+`},
+	}
+}
+
+// Load reads a YAML policy file. An empty path yields an empty Config.
+func Load(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Redactor picks and applies the policy for a request path, and keeps
+// per-route PII detection stats.
+type Redactor struct {
+	def      *compiled
+	routes   []routePolicy // longest prefix first
+	tokenKey []byte
+	stats    *stats
+}
+
+type routePolicy struct {
+	prefix   string
+	compiled *compiled
+}
+
+// New compiles cfg on top of DefaultPolicy.
+func New(cfg Config) (*Redactor, error) {
+	def, err := compile(DefaultPolicy(), cfg.Default)
+	if err != nil {
+		return nil, fmt.Errorf("default policy: %w", err)
+	}
+
+	r := &Redactor{def: def, tokenKey: cfg.TokenKey, stats: newStats()}
+	for _, route := range cfg.Routes {
+		if route.PathPrefix == "" {
+			return nil, fmt.Errorf("route policy without path_prefix")
+		}
+		c, err := compile(DefaultPolicy(), cfg.Default, route.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.PathPrefix, err)
+		}
+		r.routes = append(r.routes, routePolicy{prefix: route.PathPrefix, compiled: c})
+	}
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return len(r.routes[i].prefix) > len(r.routes[j].prefix)
+	})
+	return r, nil
+}
+
+// For returns the rules for one traffic entry on path.
+func (r *Redactor) For(path string) *Rules {
+	c := r.def
+	for _, route := range r.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			c = route.compiled
+			break
+		}
+	}
+	return &Rules{compiled: c, redactor: r}
+}
+
+// compiled is a merged policy, shared by all requests it applies to.
+type compiled struct {
+	headers  map[string]bool
+	query    map[string]bool
+	fields   map[string]bool
+	paths    [][]string
+	patterns []*regexp.Regexp
+	pii      []detector
+}
+
+// Rules applies a policy to one traffic entry and counts the PII it finds.
+// It is not safe for concurrent use.
+type Rules struct {
+	*compiled
+	redactor *Redactor
+	found    map[string]int
+}
+
+func compile(policies ...Policy) (*compiled, error) {
+	rules := &compiled{
+		headers: make(map[string]bool),
+		query:   make(map[string]bool),
+		fields:  make(map[string]bool),
+	}
+	kinds := make(map[string]bool)
+	for _, p := range policies {
+		for _, h := range p.Headers {
+			rules.headers[strings.ToLower(h)] = true
+		}
+		for _, q := range p.QueryParams {
+			rules.query[strings.ToLower(q)] = true
+		}
+		for _, f := range p.Fields {
+			rules.fields[strings.ToLower(f)] = true
+		}
+		for _, path := range p.JSONPaths {
+			rules.paths = append(rules.paths, strings.Split(strings.Trim(path, "."), "."))
+		}
+		for _, pattern := range p.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+			}
+			rules.patterns = append(rules.patterns, re)
+		}
+		for _, kind := range p.PII {
+			if !validPIIKind(kind) {
+				return nil, fmt.Errorf("unknown PII kind %q", kind)
+			}
+			kinds[kind] = true
+		}
+	}
+	rules.pii = piiDetectors(kinds)
+	return rules, nil
+}
+
+// Headers returns a copy of h with masked values.
+func (r *Rules) Headers(h map[string][]string) map[string][]string {
+	if h == nil {
+		return nil
+	}
+	out := make(map[string][]string, len(h))
+	for name, values := range h {
+		masked := make([]string, len(values))
+		for i, v := range values {
+			if r.headers[strings.ToLower(name)] {
+				masked[i] = Mask
+			} else {
+				masked[i] = r.text(v)
+			}
+		}
+		out[name] = masked
+	}
+	return out
+}
+
+// StripHeaders deletes the headers the policy masks from h, for copies that
+// must not carry even masked credentials, such as cassettes.
+func (r *Rules) StripHeaders(h map[string][]string) {
+	for name := range h {
+		if r.headers[strings.ToLower(name)] {
+			delete(h, name)
+		}
+	}
+}
+
+// Query masks the listed parameters and patterns in a raw query string.
+// Parameter order is kept.
+func (r *Rules) Query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key, value, _ := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if r.query[strings.ToLower(name)] {
+			parts[i] = key + "=" + url.QueryEscape(Mask)
+			continue
+		}
+		if decoded, err := url.QueryUnescape(value); err == nil {
+			if masked := r.text(decoded); masked != decoded {
+				parts[i] = key + "=" + url.QueryEscape(masked)
+			}
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Body masks a request or response body. JSON bodies have fields, paths
+// and patterns masked structurally; form bodies are treated like a query
+// string; anything else only has patterns masked.
+func (r *Rules) Body(body, contentType string) string {
+	if body == "" {
+		return body
+	}
+
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if masked, ok := r.json(body); ok {
+			return masked
+		}
+	}
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		return r.Query(body)
+	}
+	return r.text(body)
+}
+
+// Value masks a decoded JSON value found at path in a body, such as a value
+// reported by a diff, as Body would have masked it in place. Array indexes
+// in path are decimal strings. It returns Mask if v cannot be re-encoded.
+func (r *Rules) Value(path []string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	// Nest v under its path so fields and JSON paths apply; indexes become
+	// object keys, which "*" and numeric path segments still match.
+	doc := v
+	for i := len(path) - 1; i >= 0; i-- {
+		doc = map[string]interface{}{path[i]: doc}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return Mask
+	}
+	masked, ok := r.json(string(data))
+	if !ok {
+		return Mask
+	}
+	dec := json.NewDecoder(strings.NewReader(masked))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return Mask
+	}
+	for _, key := range path {
+		m, _ := out.(map[string]interface{})
+		out = m[key]
+	}
+	return out
+}
+
+// JSON masks a JSON document. It returns false if body is not valid JSON.
+func (r *Rules) json(body string) (string, bool) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return "", false
+	}
+
+	changed := false
+	doc = r.walk(doc, &changed)
+	for _, path := range r.paths {
+		maskPath(doc, path, &changed)
+	}
+	if !changed {
+		return body, true
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// walk masks listed fields at any depth and patterns in string values.
+func (r *Rules) walk(node interface{}, changed *bool) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if r.fields[strings.ToLower(key)] {
+				if child != Mask {
+					v[key] = Mask
+					*changed = true
+				}
+				continue
+			}
+			v[key] = r.walk(child, changed)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.walk(child, changed)
+		}
+	case string:
+		if masked := r.text(v); masked != v {
+			*changed = true
+			return masked
+		}
+	case json.Number:
+		// Card and ID numbers are often sent as numbers.
+		if masked := r.text(v.String()); masked != v.String() {
+			*changed = true
+			return masked
+		}
+	}
+	return node
+}
+
+// maskPath masks the value at path; "*" matches any key or element.
+func maskPath(node interface{}, path []string, changed *bool) {
+	if len(path) == 0 {
+		return
+	}
+	segment, last := path[0], len(path) == 1
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if segment != "*" && key != segment {
+				continue
+			}
+			if last {
+				v[key] = Mask
+				*changed = true
+			} else {
+				maskPath(child, path[1:], changed)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if segment != "*" && fmt.Sprint(i) != segment {
+				continue
+			}
+			if last {
+				v[i] = Mask
+				*changed = true
+			} else {
+				maskPath(child, path[1:], changed)
+			}
+		}
+	}
+}
+
+// text masks pattern matches and detected PII in s.
+func (r *Rules) text(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Mask)
+	}
+	for _, d := range r.pii {
+		s = d.re.ReplaceAllStringFunc(s, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			if r.found == nil {
+				r.found = make(map[string]int)
+			}
+			r.found[d.kind]++
+			return token(r.redactor.tokenKey, d.kind, match)
+		})
+	}
+	return s
+}
+
+// Found returns the number of PII values detected so far, by kind.
+func (r *Rules) Found() map[string]int {
+	return r.found
+}
+
+// Record adds the PII found in this entry to the stats of route, the
+// pattern the path belongs to (e.g. /users/{id}), so that IDs in paths do
+// not use up the tracked routes.
+func (r *Rules) Record(route string) {
+	if len(r.found) > 0 {
+		r.redactor.stats.record(route, r.found)
+	}
+}
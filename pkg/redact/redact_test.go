@@ -0,0 +1,240 @@
+package redact
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func defaultRules(t *testing.T) *Rules {
+	t.Helper()
+	r, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.For("/")
+}
+
+func TestBody_DefaultFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Password field",
+			input:    `{"username": "john", "password": "secret123"}`,
+			expected: `{"password":"[REDACTED]","username":"john"}`,
+		},
+		{
+			name:     "Token field",
+			input:    `{"token": "abc123xyz"}`,
+			expected: `{"token":"[REDACTED]"}`,
+		},
+		{
+			name:     "No sensitive data",
+			input:    `{"name": "John", "age": 30}`,
+			expected: `{"name": "John", "age": 30}`,
+		},
+		{
+			name:     "API key field",
+			input:    `{"API_KEY": "sk-12345"}`,
+			expected: `{"API_KEY":"[REDACTED]"}`,
+		},
+		{
+			name:     "Non-string secret",
+			input:    `{"secret": {"pin": 1234}}`,
+			expected: `{"secret":"[REDACTED]"}`,
+		},
+	}
+
+	rules := defaultRules(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.Body(tt.input, "application/json"); got != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBody_NestedJSON(t *testing.T) {
+	r, err := New(Config{Default: Policy{
+		Fields:    []string{"ssn"},
+		JSONPaths: []string{"user.address.street", "items.*.card.number", "tags.1"},
+		Patterns:  []string{`\d{4}-\d{4}`},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := `{
+		"user": {"name": "Ann", "ssn": "123", "address": {"street": "Main St 1", "city": "Oslo"},
+			"profile": {"credentials": [{"password": "p1"}, {"password": "p2"}]}},
+		"items": [{"card": {"number": "4111", "brand": "visa"}}, {"card": {"number": "5500", "brand": "mc"}}],
+		"tags": ["a", "b", "c"],
+		"note": "call 5555-1234 today",
+		"amount": 12345678901234567890
+	}`
+	got := r.For("/").Body(input, "application/json")
+	want := `{"amount":12345678901234567890,` +
+		`"items":[{"card":{"brand":"visa","number":"[REDACTED]"}},{"card":{"brand":"mc","number":"[REDACTED]"}}],` +
+		`"note":"call [REDACTED] today",` +
+		`"tags":["a","[REDACTED]","c"],` +
+		`"user":{"address":{"city":"Oslo","street":"[REDACTED]"},"name":"Ann",` +
+		`"profile":{"credentials":[{"password":"[REDACTED]"},{"password":"[REDACTED]"}]},"ssn":"[REDACTED]"}}`
+	if got != want {
+		t.Errorf("Unexpected body:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestBody_NonJSON(t *testing.T) {
+	rules := defaultRules(t)
+
+	if got := rules.Body("user=ann&password=hunter2", "application/x-www-form-urlencoded"); got != "user=ann&password=%5BREDACTED%5D" {
+		t.Errorf("Unexpected form body: %s", got)
+	}
+	if got := rules.Body("auth: Bearer abc.def-ghi", "text/plain"); got != "auth: [REDACTED]" {
+		t.Errorf("Unexpected text body: %s", got)
+	}
+	if got := rules.Body(`{"password": broken`, "application/json"); got != `{"password": broken` {
+		t.Errorf("Expected invalid JSON to be left alone, got %s", got)
+	}
+}
+
+func TestValue(t *testing.T) {
+	r, err := New(Config{Default: Policy{Fields: []string{"password"}, JSONPaths: []string{"items.*.card"}, PII: []string{"email"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := r.For("/")
+	tests := []struct {
+		path     []string
+		value    interface{}
+		expected interface{}
+	}{
+		{[]string{"user", "password"}, "secret", Mask},
+		{[]string{"items", "0", "card"}, "4111", Mask},
+		{[]string{"user"}, map[string]interface{}{"name": "jo", "password": "secret"}, map[string]interface{}{"name": "jo", "password": Mask}},
+		{[]string{"total"}, 42, json.Number("42")},
+		{[]string{"user", "name"}, "jo", "jo"},
+		{nil, nil, nil},
+	}
+	for _, tt := range tests {
+		if got := rules.Value(tt.path, tt.value); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v: expected %#v, got %#v", tt.path, tt.expected, got)
+		}
+	}
+	if got := rules.Value([]string{"contact"}, "jo@example.com"); got == "jo@example.com" {
+		t.Errorf("Expected the email to be masked, got %v", got)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	r, err := New(Config{Default: Policy{Headers: []string{"x-tenant"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.For("/").Headers(map[string][]string{
+		"Authorization": {"Bearer token123"},
+		"Cookie":        {"session=abc"},
+		"X-Tenant":      {"acme"},
+		"Content-Type":  {"application/json"},
+		"X-Forwarded":   {"Bearer leaked"},
+		"X-Admin-Token": {"s3cret"},
+	})
+	want := map[string][]string{
+		"Authorization": {Mask},
+		"Cookie":        {Mask},
+		"X-Tenant":      {Mask},
+		"Content-Type":  {"application/json"},
+		"X-Forwarded":   {Mask},
+		"X-Admin-Token": {Mask},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected headers: %v", got)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	r, err := New(Config{Default: Policy{QueryParams: []string{"email"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.For("/").Query("page=2&Token=abc&email=a%40b.c&q=bearer+xyz")
+	if got != "page=2&Token=%5BREDACTED%5D&email=%5BREDACTED%5D&q=%5BREDACTED%5D" {
+		t.Errorf("Unexpected query: %s", got)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	r, err := New(Config{
+		Default: Policy{Fields: []string{"email"}},
+		Routes: []Route{
+			{PathPrefix: "/api", Policy: Policy{Fields: []string{"name"}}},
+			{PathPrefix: "/api/patients", Policy: Policy{JSONPaths: []string{"diagnosis"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"name":"Ann","email":"a@b.c","diagnosis":"flu","password":"x"}`
+	tests := map[string]string{
+		"/public":          `{"diagnosis":"flu","email":"[REDACTED]","name":"Ann","password":"[REDACTED]"}`,
+		"/api/orders":      `{"diagnosis":"flu","email":"[REDACTED]","name":"[REDACTED]","password":"[REDACTED]"}`,
+		"/api/patients/42": `{"diagnosis":"[REDACTED]","email":"[REDACTED]","name":"Ann","password":"[REDACTED]"}`,
+	}
+	for path, want := range tests {
+		if got := r.For(path).Body(body, "application/json"); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New(Config{Default: Policy{Patterns: []string{"("}}}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+	if _, err := New(Config{Routes: []Route{{Policy: Policy{Fields: []string{"x"}}}}}); err == nil {
+		t.Error("Expected a route without path_prefix to be rejected")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.yaml")
+	err := os.WriteFile(path, []byte(`
+default:
+  headers: [X-Tenant]
+routes:
+  - path_prefix: /api/patients
+    json_paths: [records.*.diagnosis]
+    patterns: ['\d{3}-\d{2}-\d{4}']
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		Default: Policy{Headers: []string{"X-Tenant"}},
+		Routes: []Route{{PathPrefix: "/api/patients", Policy: Policy{
+			JSONPaths: []string{"records.*.diagnosis"},
+			Patterns:  []string{`\d{3}-\d{2}-\d{4}`},
+		}}},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	if cfg, err := Load(""); err != nil || !reflect.DeepEqual(cfg, Config{}) {
+		t.Errorf("Expected an empty config without a file, got %+v, %v", cfg, err)
+	}
+}
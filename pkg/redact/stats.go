@@ -0,0 +1,75 @@
+package redact
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxStatsRoutes bounds the routes tracked; further routes count as OtherRoute.
+const maxStatsRoutes = 1000
+
+// OtherRoute collects the stats of routes beyond maxStatsRoutes.
+const OtherRoute = "(other)"
+
+// RouteStats counts the PII detected in the traffic of one route.
+type RouteStats struct {
+	Route    string           `json:"route"`
+	Entries  int64            `json:"entries"` // traffic entries with PII
+	Kinds    map[string]int64 `json:"kinds"`
+	LastSeen time.Time        `json:"last_seen"`
+}
+
+type stats struct {
+	mu     sync.Mutex
+	routes map[string]*RouteStats
+}
+
+func newStats() *stats {
+	return &stats{routes: make(map[string]*RouteStats)}
+}
+
+func (s *stats) record(route string, found map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs, ok := s.routes[route]
+	if !ok {
+		if len(s.routes) >= maxStatsRoutes {
+			route = OtherRoute
+			rs = s.routes[route]
+		}
+		if rs == nil {
+			rs = &RouteStats{Route: route, Kinds: make(map[string]int64)}
+			s.routes[route] = rs
+		}
+	}
+	rs.Entries++
+	for kind, n := range found {
+		rs.Kinds[kind] += int64(n)
+	}
+	rs.LastSeen = time.Now()
+}
+
+// Stats returns the PII detection stats of every route, leakiest first.
+func (r *Redactor) Stats() []RouteStats {
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+
+	list := make([]RouteStats, 0, len(r.stats.routes))
+	for _, rs := range r.stats.routes {
+		cp := *rs
+		cp.Kinds = make(map[string]int64, len(rs.Kinds))
+		for kind, n := range rs.Kinds {
+			cp.Kinds[kind] = n
+		}
+		list = append(list, cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Entries != list[j].Entries {
+			return list[i].Entries > list[j].Entries
+		}
+		return list[i].Route < list[j].Route
+	})
+	return list
+}
@@ -0,0 +1,206 @@
+package replay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/har"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// Run states.
+const (
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateCancelled = "cancelled"
+)
+
+// maxRuns is the number of finished runs a Manager remembers.
+const maxRuns = 20
+
+// ErrNotFound is returned for unknown run IDs.
+var ErrNotFound = errors.New("replay not found")
+
+// Run is a replay started through a Manager.
+type Run struct {
+	ID        string    `json:"id"`
+	State     string    `json:"state"`
+	Source    string    `json:"source"`
+	Options   Options   `json:"options"`
+	Entries   int       `json:"entries"`
+	Done      int64     `json:"done"`
+	StartedAt time.Time `json:"started_at"`
+	Summary   *Summary  `json:"summary,omitempty"` // set when the run ends
+}
+
+// job is a run and its live state.
+type job struct {
+	run    Run
+	done   atomic.Int64
+	cancel context.CancelFunc
+}
+
+// snapshot copies the run for callers.
+func (j *job) snapshot() Run {
+	run := j.run
+	run.Done = j.done.Load()
+	return run
+}
+
+// Spec is a replay requested through the admin API. The filters take the
+// values of archive.ParseQuery.
+type Spec struct {
+	Source    string   `json:"source"`        // redis, jsonl (the local archive) or har
+	HAR       *har.HAR `json:"har,omitempty"` // inline, for source har
+	Since     string   `json:"since,omitempty"`
+	Until     string   `json:"until,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Route     string   `json:"route,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	RequestID string   `json:"request_id,omitempty"`
+	Limit     int      `json:"limit,omitempty"`
+	Options
+}
+
+// Query returns the filters of the spec.
+func (s Spec) Query() (archive.Query, error) {
+	return archive.ParseQuery(url.Values{
+		"since":      {s.Since},
+		"until":      {s.Until},
+		"path":       {s.Path},
+		"route":      {s.Route},
+		"status":     {s.Status},
+		"request_id": {s.RequestID},
+	})
+}
+
+// Manager runs replays in the background and keeps their summaries in
+// memory, for the admin API.
+type Manager struct {
+	mu   sync.Mutex
+	jobs []*job // oldest first
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Start replays entries in the background and returns the new run.
+func (m *Manager) Start(source string, entries []redis.TrafficLog, opts Options) (Run, error) {
+	j := &job{run: Run{
+		ID:        newID(),
+		State:     StateRunning,
+		Source:    source,
+		Entries:   len(entries),
+		StartedAt: time.Now(),
+	}}
+	opts.OnResult = func(Result) { j.done.Add(1) }
+	replayer, err := New(opts)
+	if err != nil {
+		return Run{}, err
+	}
+	// Rewritten headers often carry credentials; runs only show their names.
+	j.run.Options = opts
+	j.run.Options.Headers = make(map[string]string, len(opts.Headers))
+	for name, v := range opts.Headers {
+		if v != "" {
+			v = redacted
+		}
+		j.run.Options.Headers[name] = v
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+
+	m.mu.Lock()
+	m.jobs = append(m.jobs, j)
+	m.prune()
+	snapshot := j.snapshot()
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		summary := replayer.Run(ctx, entries)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		j.run.Summary = summary
+		if j.run.State == StateRunning {
+			j.run.State = StateCompleted
+		}
+	}()
+	return snapshot, nil
+}
+
+// Get returns a run by ID.
+func (m *Manager) Get(id string) (Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j := m.find(id); j != nil {
+		return j.snapshot(), nil
+	}
+	return Run{}, ErrNotFound
+}
+
+// List returns every remembered run, newest first.
+func (m *Manager) List() []Run {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs := make([]Run, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		runs = append(runs, m.jobs[i].snapshot())
+	}
+	return runs
+}
+
+// Cancel stops sending the remaining requests of a run. Its summary covers
+// the requests already sent.
+func (m *Manager) Cancel(id string) (Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.find(id)
+	if j == nil {
+		return Run{}, ErrNotFound
+	}
+	if j.run.State == StateRunning {
+		j.run.State = StateCancelled
+		j.cancel()
+	}
+	return j.snapshot(), nil
+}
+
+func (m *Manager) find(id string) *job {
+	for _, j := range m.jobs {
+		if j.run.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// prune forgets the oldest finished runs beyond maxRuns.
+func (m *Manager) prune() {
+	for i := 0; len(m.jobs) > maxRuns && i < len(m.jobs); {
+		if m.jobs[i].run.State == StateRunning {
+			i++
+			continue
+		}
+		m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("replay-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,339 @@
+// Package replay sends recorded traffic to a target and compares the
+// responses with the recording.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/diff"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+const (
+	// HeaderReplay marks replayed requests with the recorded request ID, so
+	// a target behind Sentinel can tell them from live traffic.
+	HeaderReplay = "X-Chaos-Replay"
+
+	// maxBody bounds the response body kept for each result.
+	maxBody = 1024 * 1024
+
+	defaultConcurrency = 10
+	defaultTimeout     = 30 * time.Second
+)
+
+// Skip reasons.
+const (
+	SkipTruncated = "request_body_truncated"
+	SkipOmitted   = "bodies_omitted"
+	SkipBody      = "invalid_body"
+	SkipGhost     = "ghost_answer"   // Sentinel answered, not the upstream
+	SkipChaos     = "chaos_injected" // the recorded response was faulted
+)
+
+// redacted is the mask the redaction policy leaves in captured values.
+const redacted = "[REDACTED]"
+
+// skippedHeaders are recorded headers that are not sent again: hop-by-hop
+// headers, those the transport sets, and the request ID of the recording.
+var skippedHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Host":                true,
+	"Content-Length":      true,
+	"Accept-Encoding":     true, // the transport decodes what it asked for
+	"Content-Encoding":    true, // bodies are recorded decoded
+	"X-Request-Id":        true,
+}
+
+// Options controls how recorded traffic is sent to the target.
+type Options struct {
+	Target         string            `json:"target"`                    // base URL, e.g. http://staging:8000
+	OriginalTiming bool              `json:"original_timing,omitempty"` // keep the recorded gaps between requests
+	Speed          float64           `json:"speed,omitempty"`           // timing multiplier, 2 = twice as fast; 0 = 1
+	Concurrency    int               `json:"concurrency,omitempty"`     // requests in flight, 0 = 10
+	Headers        map[string]string `json:"headers,omitempty"`         // set on every request; "" removes the header
+	Timeout        time.Duration     `json:"-"`                         // per request, 0 = 30s
+
+	// Diff, if set, compares replayed response bodies with the recorded
+	// ones when the status matches, skipping the fields it ignores.
+	Diff *diff.Config `json:"diff,omitempty"`
+
+	// OnResult, if set, is called with every result, from several
+	// goroutines at once.
+	OnResult func(Result) `json:"-"`
+}
+
+// Result is the outcome of replaying one entry.
+type Result struct {
+	Entry   redis.TrafficLog
+	Skipped string // reason the entry was not sent
+	Status  int
+	Header  http.Header
+	Body    []byte // up to 1MB, decoded
+	Latency time.Duration
+	Err     error
+
+	Truncated bool          // Body was cut at 1MB
+	Compared  bool          // the bodies were diffed
+	Changes   []diff.Change // differences from the recorded body
+}
+
+// Replayer sends recorded entries to a target.
+type Replayer struct {
+	opts   Options
+	target *url.URL
+	client *http.Client
+	differ *diff.Differ // nil unless Options.Diff is set
+}
+
+// New validates opts and creates a Replayer.
+func New(opts Options) (*Replayer, error) {
+	target, err := url.Parse(opts.Target)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid target %q: use an absolute URL such as http://localhost:8000", opts.Target)
+	}
+	if opts.Speed < 0 {
+		return nil, errors.New("speed must be positive")
+	}
+	if opts.Speed == 0 {
+		opts.Speed = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	var differ *diff.Differ
+	if opts.Diff != nil {
+		if differ, err = diff.New(*opts.Diff); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Replayer{
+		opts:   opts,
+		target: target,
+		differ: differ,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			// Redirects are part of the response being compared.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}, nil
+}
+
+// Run replays entries in order and summarizes the differences from the
+// recording. With OriginalTiming, each request is sent at its recorded
+// offset from the first one divided by Speed, or as soon as a slot frees up
+// if Concurrency requests are already in flight. Run stops sending when ctx
+// is done and waits for the requests in flight.
+func (rp *Replayer) Run(ctx context.Context, entries []redis.TrafficLog) *Summary {
+	summary := newSummary(rp.opts.Target, rp.differ != nil)
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, rp.opts.Concurrency)
+		start = time.Now()
+	)
+	record := func(res Result) {
+		mu.Lock()
+		summary.add(res)
+		mu.Unlock()
+		if rp.opts.OnResult != nil {
+			rp.opts.OnResult(res)
+		}
+	}
+
+dispatch:
+	for _, entry := range entries {
+		if rp.opts.OriginalTiming {
+			offset := time.Duration(float64(entry.Timestamp.Sub(entries[0].Timestamp)) / rp.opts.Speed)
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					break dispatch
+				case <-timer.C:
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func(entry redis.TrafficLog) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			res := rp.send(ctx, entry)
+			rp.compare(&res)
+			record(res)
+		}(entry)
+	}
+	wg.Wait()
+
+	summary.finish(time.Now())
+	return summary
+}
+
+// send replays a single entry.
+func (rp *Replayer) send(ctx context.Context, entry redis.TrafficLog) Result {
+	res := Result{Entry: entry}
+	req, skip := rp.request(ctx, entry)
+	if skip != "" {
+		res.Skipped = skip
+		return res
+	}
+
+	start := time.Now()
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		res.Err = err
+		res.Latency = time.Since(start)
+		return res
+	}
+	defer resp.Body.Close()
+
+	res.Body, err = io.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+	io.Copy(io.Discard, resp.Body)
+	if len(res.Body) > maxBody {
+		res.Body, res.Truncated = res.Body[:maxBody], true
+	}
+	res.Latency = time.Since(start)
+	res.Status = resp.StatusCode
+	res.Header = resp.Header
+	if err != nil {
+		res.Err = err
+	}
+	return res
+}
+
+// compare diffs the replayed body with the recorded one when both are
+// complete and the status matches; a status change is reported on its own.
+func (rp *Replayer) compare(res *Result) {
+	e := res.Entry
+	if rp.differ == nil || res.Skipped != "" || res.Err != nil || res.Status != e.Status || res.Truncated ||
+		e.ResponseTruncated || e.Streamed || e.BodiesOmitted {
+		return
+	}
+	res.Compared = true
+	if e.ResponseBase64 {
+		recorded, err := base64.StdEncoding.DecodeString(e.ResponseBody)
+		if err != nil {
+			res.Compared = false
+			return
+		}
+		res.Changes = diff.CompareBinary(recorded, res.Body)
+		return
+	}
+	res.Changes = rp.differ.Compare(e.Path, []byte(e.ResponseBody), res.Body)
+}
+
+// request rebuilds the recorded request against the target, or returns why
+// it cannot be replayed faithfully.
+func (rp *Replayer) request(ctx context.Context, entry redis.TrafficLog) (*http.Request, string) {
+	// Their recorded status and timing are Sentinel's, so there is nothing
+	// to compare the target against.
+	if entry.Ghost {
+		return nil, SkipGhost
+	}
+	if len(entry.Chaos) > 0 {
+		return nil, SkipChaos
+	}
+	if entry.RequestTruncated {
+		return nil, SkipTruncated
+	}
+	if entry.BodiesOmitted && hasBody(entry.Method) {
+		return nil, SkipOmitted
+	}
+	body := []byte(entry.RequestBody)
+	if entry.RequestBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(entry.RequestBody)
+		if err != nil {
+			return nil, SkipBody
+		}
+		body = decoded
+	}
+
+	u := *rp.target
+	u.Path = strings.TrimRight(u.Path, "/") + entry.Path
+	u.RawPath = ""
+	u.RawQuery = entry.Query
+
+	req, err := http.NewRequestWithContext(ctx, entry.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, SkipBody
+	}
+	for name, values := range entry.RequestHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if skippedHeaders[name] {
+			continue
+		}
+		for _, v := range values {
+			// Masked credentials would only be rejected; set real ones
+			// through Options.Headers.
+			if v != redacted {
+				req.Header.Add(name, v)
+			}
+		}
+	}
+	for name, v := range rp.opts.Headers {
+		if v == "" {
+			req.Header.Del(name)
+		} else {
+			req.Header.Set(name, v)
+		}
+	}
+	replayID := entry.RequestID
+	if replayID == "" {
+		replayID = "true"
+	}
+	req.Header.Set(HeaderReplay, replayID)
+	return req, ""
+}
+
+func hasBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return false
+}
+
+// ParseHeaders parses header rewrites given as "Name: value" or
+// "Name=value". An empty value removes the header.
+func ParseHeaders(specs []string) (map[string]string, error) {
+	headers := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		i := strings.IndexAny(spec, ":=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q: use 'Name: value'", spec)
+		}
+		headers[strings.TrimSpace(spec[:i])] = strings.TrimSpace(spec[i+1:])
+	}
+	return headers, nil
+}
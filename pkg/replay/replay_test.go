@@ -0,0 +1,304 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/diff"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+func TestRun_Summary(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]*http.Request{}
+	bodies := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		seen[r.URL.Path] = r
+		bodies[r.URL.Path] = string(body)
+		mu.Unlock()
+		if r.URL.Path == "/api/pay" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	ts := time.Now()
+	entries := []redis.TrafficLog{
+		{Timestamp: ts, RequestID: "r1", Method: "GET", Path: "/api/orders", Query: "page=2", Status: 200, DurationMs: 10,
+			RequestHeaders: map[string][]string{"Authorization": {"[REDACTED]"}, "Accept": {"application/json"}, "X-Debug": {"1"}, "Accept-Encoding": {"br"}}},
+		{Timestamp: ts, RequestID: "r2", Method: "POST", Path: "/api/pay", RequestBody: "AAEC", RequestBase64: true, Status: 200, DurationMs: 20},
+		{Timestamp: ts, Method: "POST", Path: "/api/upload", RequestTruncated: true, Status: 201},
+		{Timestamp: ts, Method: "POST", Path: "/api/search", BodiesOmitted: true, Status: 500},
+		{Timestamp: ts, Method: "GET", Path: "/api/stock", Ghost: true, Status: 200},
+		{Timestamp: ts, Method: "GET", Path: "/api/cart", Chaos: []redis.AppliedChaos{{Kind: "failure"}}, Status: 503},
+	}
+
+	var results atomic.Int64
+	rp, err := New(Options{
+		Target:   srv.URL + "/",
+		Headers:  map[string]string{"Authorization": "Bearer test", "X-Debug": ""},
+		OnResult: func(Result) { results.Add(1) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := rp.Run(context.Background(), entries)
+
+	if s.Entries != 6 || s.Sent != 2 || s.Skipped[SkipTruncated] != 1 || s.Skipped[SkipOmitted] != 1 ||
+		s.Skipped[SkipGhost] != 1 || s.Skipped[SkipChaos] != 1 || results.Load() != 6 {
+		t.Errorf("Unexpected counts: %+v", s)
+	}
+	if s.StatusMatched != 1 || s.StatusChanges["200->503"] != 1 || s.Errors != 0 {
+		t.Errorf("Unexpected status comparison: matched %d, changes %v", s.StatusMatched, s.StatusChanges)
+	}
+	if s.Recorded.MeanMs != 15 || s.Replayed.MeanMs <= 0 || s.Delta.MeanMs != s.Replayed.MeanMs-15 {
+		t.Errorf("Unexpected latency: recorded %+v, replayed %+v, delta %+v", s.Recorded, s.Replayed, s.Delta)
+	}
+	if len(s.Routes) != 2 || s.Routes[0].Method+" "+s.Routes[0].Path != "GET /api/orders" {
+		t.Errorf("Unexpected routes: %+v", s.Routes)
+	}
+
+	orders := seen["/api/orders"]
+	if orders == nil {
+		t.Fatal("Expected /api/orders to be replayed")
+	}
+	if orders.URL.RawQuery != "page=2" || orders.Header.Get("Authorization") != "Bearer test" ||
+		orders.Header.Get("Accept") != "application/json" || orders.Header.Get("X-Debug") != "" ||
+		orders.Header.Get("Accept-Encoding") == "br" || orders.Header.Get(HeaderReplay) != "r1" {
+		t.Errorf("Unexpected replayed request: %s %v", orders.URL, orders.Header)
+	}
+	if bodies["/api/pay"] != "\x00\x01\x02" {
+		t.Errorf("Expected the base64 body to be decoded, got %q", bodies["/api/pay"])
+	}
+}
+
+func TestRun_Diff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/orders/1":
+			w.Write([]byte(`{"id": "b2", "total": 12, "updated_at": "11:00"}`))
+		case "/api/orders/2":
+			w.Write([]byte(`{"id": "c3", "total": 5, "updated_at": "11:01"}`))
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+		case "/logo.png":
+			w.Write([]byte{0, 1, 2})
+		}
+	}))
+	defer srv.Close()
+
+	entries := []redis.TrafficLog{
+		{Method: "GET", Path: "/api/orders/1", Status: 200, ResponseBody: `{"id": "a1", "total": 10, "updated_at": "10:00"}`},
+		{Method: "GET", Path: "/api/orders/2", Status: 200, ResponseBody: `{"id": "a2", "total": 5, "updated_at": "10:01"}`},
+		{Method: "GET", Path: "/gone", Status: 200, ResponseBody: `{}`},
+		{Method: "GET", Path: "/logo.png", Status: 200, ResponseBody: "AAEC", ResponseBase64: true},
+		{Method: "GET", Path: "/api/orders/3", Status: 200, ResponseTruncated: true},
+	}
+	rp, err := New(Options{Target: srv.URL, Diff: &diff.Config{Ignore: []string{"$.id", "$..updated_at"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := rp.Run(context.Background(), entries)
+
+	r := s.Diff
+	if r == nil || r.Compared != 3 || r.Identical != 2 || r.Different != 1 || r.Kinds[diff.ValueChanged] != 1 {
+		t.Fatalf("Expected the status change and truncated body to be left out, got %+v", r)
+	}
+	first := r.Routes[0]
+	if first.Path != "/api/orders/{id}" || first.Compared != 2 || len(first.Changes) != 1 || first.Changes[0].Path != "$.total" {
+		t.Errorf("Expected only the total to differ on the orders route, got %+v", first)
+	}
+
+	if _, err := New(Options{Target: srv.URL, Diff: &diff.Config{Ignore: []string{"updated_at"}}}); err == nil {
+		t.Error("Expected an invalid ignore rule to fail")
+	}
+}
+
+func TestRun_OriginalTiming(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ts := time.Now()
+	entries := []redis.TrafficLog{
+		{Timestamp: ts, Method: "GET", Path: "/", Status: 200},
+		{Timestamp: ts.Add(100 * time.Millisecond), Method: "GET", Path: "/", Status: 200},
+		{Timestamp: ts.Add(200 * time.Millisecond), Method: "GET", Path: "/", Status: 200},
+	}
+
+	rp, _ := New(Options{Target: srv.URL, OriginalTiming: true, Speed: 2})
+	start := time.Now()
+	s := rp.Run(context.Background(), entries)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected the 200ms recording to take about 100ms at speed 2, took %s", elapsed)
+	}
+	if s.StatusMatched != 3 {
+		t.Errorf("Expected 3 matching statuses, got %+v", s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if s := rp.Run(ctx, entries); s.Sent != 0 {
+		t.Errorf("Expected a cancelled run to send nothing, sent %d", s.Sent)
+	}
+}
+
+func TestRun_Concurrency(t *testing.T) {
+	var inFlight, peak atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	entries := make([]redis.TrafficLog, 10)
+	for i := range entries {
+		entries[i] = redis.TrafficLog{Method: "GET", Path: "/", Status: 200}
+	}
+	rp, _ := New(Options{Target: srv.URL, Concurrency: 3})
+	if s := rp.Run(context.Background(), entries); s.Sent != 10 {
+		t.Errorf("Expected 10 requests, got %d", s.Sent)
+	}
+	if p := peak.Load(); p > 3 || p < 2 {
+		t.Errorf("Expected at most 3 requests in flight, peak was %d", p)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close() // nothing listens any more
+
+	rp, _ := New(Options{Target: srv.URL})
+	s := rp.Run(context.Background(), []redis.TrafficLog{{Method: "GET", Path: "/", Status: 200, Duration: "5ms"}})
+	if s.Sent != 1 || s.Errors != 1 || s.StatusMatched != 0 || s.Recorded.P50Ms != 5 {
+		t.Errorf("Expected one error with the version 1 duration recorded, got %+v", s)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, opts := range []Options{{Target: ""}, {Target: "/relative"}, {Target: "http://x", Speed: -1}} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("Expected %+v to fail", opts)
+		}
+	}
+}
+
+func TestFromJSONL_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.jsonl")
+	f, _ := os.Create(path)
+	enc := json.NewEncoder(f)
+	for _, e := range []redis.TrafficLog{
+		{Method: "GET", Path: "/a", Status: 500},
+		{Method: "GET", Path: "/b", Status: 200},
+		{Method: "GET", Path: "/c", Status: 502, Route: redis.RouteShadow},
+		{Method: "GET", Path: "/c", Status: 502},
+		{Method: "GET", Path: "/d", Status: 503},
+	} {
+		enc.Encode(e)
+	}
+	f.Close()
+
+	entries, err := FromJSONL(path, archive.Query{StatusMin: 500, StatusMax: 599}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/a" || entries[1].Path != "/c" {
+		t.Errorf("Expected the first two errors without shadow copies, got %+v", entries)
+	}
+	entries, _ = FromJSONL(path, archive.Query{Route: redis.RouteShadow}, 0)
+	if len(entries) != 1 || entries[0].Route != redis.RouteShadow {
+		t.Errorf("Expected only the shadow copy, got %+v", entries)
+	}
+
+	if _, err := Load(context.Background(), "kafka", path, nil, archive.Query{}, 0); err == nil {
+		t.Error("Expected an unknown source to fail")
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders([]string{"Authorization: Bearer a:b", "X-Tenant=blue", "Cookie:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers["Authorization"] != "Bearer a:b" || headers["X-Tenant"] != "blue" || headers["Cookie"] != "" || len(headers) != 3 {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+	if _, err := ParseHeaders([]string{"novalue"}); err == nil {
+		t.Error("Expected a header without a separator to fail")
+	}
+}
+
+func TestManager(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	m := NewManager()
+	run, err := m.Start(SourceHAR, []redis.TrafficLog{{Method: "GET", Path: "/", Status: 200}},
+		Options{Target: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != StateRunning || run.Options.Headers["Authorization"] != redacted {
+		t.Errorf("Expected a running run with masked headers, got %+v", run)
+	}
+	done := waitFor(t, m, run.ID, StateCompleted)
+	if done.Done != 1 || done.Summary == nil || done.Summary.StatusMatched != 1 {
+		t.Errorf("Unexpected finished run: %+v", done)
+	}
+
+	slow, _ := m.Start(SourceRedis, []redis.TrafficLog{{Method: "GET", Path: "/slow"}, {Method: "GET", Path: "/slow"}},
+		Options{Target: srv.URL, Concurrency: 1})
+	if _, err := m.Cancel(slow.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, m, slow.ID, StateCancelled)
+	if runs := m.List(); len(runs) != 2 || runs[0].ID != slow.ID {
+		t.Errorf("Expected runs newest first, got %+v", runs)
+	}
+	if _, err := m.Get("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+// waitFor polls a run until it has a summary in the given state.
+func waitFor(t *testing.T, m *Manager, id, state string) Run {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		run, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.State == state && run.Summary != nil {
+			return run
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Run %s did not reach %s", id, state)
+	return Run{}
+}
@@ -0,0 +1,109 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/elliot/chaosProxy/pkg/archive"
+	"github.com/elliot/chaosProxy/pkg/har"
+	"github.com/elliot/chaosProxy/pkg/infrastructure/redis"
+)
+
+// Sources of recorded traffic.
+const (
+	SourceRedis = "redis" // the traffic stream
+	SourceJSONL = "jsonl" // an archive directory or a single JSONL file
+	SourceHAR   = "har"
+)
+
+// FromStream reads up to limit entries matching q from the Redis traffic
+// stream. A limit of 0 reads every match.
+func FromStream(ctx context.Context, client *redis.Client, q archive.Query, limit int) ([]redis.TrafficLog, error) {
+	var entries []redis.TrafficLog
+	err := archive.ScanStream(ctx, client, q, collect(&entries, q, limit))
+	return entries, err
+}
+
+// FromJSONL reads up to limit entries matching q from an archive directory
+// or a JSONL file such as the output of chaosctl archive query.
+func FromJSONL(path string, q archive.Query, limit int) ([]redis.TrafficLog, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []redis.TrafficLog
+	if info.IsDir() {
+		err = archive.Scan(path, q, collect(&entries, q, limit))
+	} else {
+		err = archive.ScanFile(path, q, collect(&entries, q, limit))
+	}
+	return entries, err
+}
+
+// FromHAR reads up to limit entries matching q from a HAR file.
+func FromHAR(r io.Reader, q archive.Query, limit int) ([]redis.TrafficLog, error) {
+	h, err := har.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return Filter(h.Traffic(""), q, limit), nil
+}
+
+// Filter returns up to limit entries matching q.
+func Filter(entries []redis.TrafficLog, q archive.Query, limit int) []redis.TrafficLog {
+	var selected []redis.TrafficLog
+	keep := collect(&selected, q, limit)
+	for _, e := range entries {
+		if q.Match(e) && !keep(e) {
+			break
+		}
+	}
+	return selected
+}
+
+// Load reads entries from source: the stream through client, or the file or
+// directory at path.
+func Load(ctx context.Context, source, path string, client *redis.Client, q archive.Query, limit int) ([]redis.TrafficLog, error) {
+	var (
+		entries []redis.TrafficLog
+		err     error
+	)
+	switch source {
+	case SourceRedis:
+		if client == nil {
+			return nil, fmt.Errorf("source %q needs a Redis connection", source)
+		}
+		entries, err = FromStream(ctx, client, q, limit)
+	case SourceJSONL:
+		entries, err = FromJSONL(path, q, limit)
+	case SourceHAR:
+		f, ferr := os.Open(path)
+		if ferr != nil {
+			return nil, ferr
+		}
+		defer f.Close()
+		entries, err = FromHAR(f, q, limit)
+	default:
+		return nil, fmt.Errorf("unknown source %q: use redis, jsonl or har", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
+	return entries, nil
+}
+
+// collect appends entries up to limit. Shadow copies are left out unless q
+// asks for the shadow route, so a replay sends each request once.
+func collect(entries *[]redis.TrafficLog, q archive.Query, limit int) func(redis.TrafficLog) bool {
+	return func(e redis.TrafficLog) bool {
+		if e.Route == redis.RouteShadow && q.Route != redis.RouteShadow {
+			return true
+		}
+		*entries = append(*entries, e)
+		return limit <= 0 || len(*entries) < limit
+	}
+}
@@ -0,0 +1,245 @@
+package replay
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/diff"
+)
+
+// Summary compares a replay with the recording.
+type Summary struct {
+	Target        string         `json:"target"`
+	StartedAt     time.Time      `json:"started_at"`
+	FinishedAt    time.Time      `json:"finished_at"`
+	Entries       int            `json:"entries"`
+	Sent          int            `json:"sent"`
+	Skipped       map[string]int `json:"skipped,omitempty"` // by reason
+	Errors        int            `json:"errors"`            // requests without a response
+	StatusMatched int            `json:"status_matched"`
+	StatusChanges map[string]int `json:"status_changes,omitempty"` // e.g. "200->503"
+	Recorded      Latency        `json:"recorded_latency"`
+	Replayed      Latency        `json:"replayed_latency"`
+	Delta         Latency        `json:"latency_delta"` // replayed minus recorded
+	Routes        []RouteSummary `json:"routes"`
+	Diff          *diff.Report   `json:"diff,omitempty"` // set when bodies are compared
+
+	routes map[string]*routeStats
+	all    routeStats
+}
+
+// Latency summarizes a set of request durations in milliseconds.
+type Latency struct {
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MeanMs float64 `json:"mean_ms"`
+}
+
+func (l Latency) sub(o Latency) Latency {
+	return Latency{P50Ms: l.P50Ms - o.P50Ms, P95Ms: l.P95Ms - o.P95Ms, P99Ms: l.P99Ms - o.P99Ms, MeanMs: l.MeanMs - o.MeanMs}
+}
+
+// RouteSummary compares one method and path, with IDs in the path shown
+// as {id}.
+type RouteSummary struct {
+	Method        string         `json:"method"`
+	Path          string         `json:"path"`
+	Sent          int            `json:"sent"`
+	Errors        int            `json:"errors"`
+	StatusMatched int            `json:"status_matched"`
+	StatusChanges map[string]int `json:"status_changes,omitempty"`
+	Recorded      Latency        `json:"recorded_latency"`
+	Replayed      Latency        `json:"replayed_latency"`
+	Delta         Latency        `json:"latency_delta"`
+}
+
+type routeStats struct {
+	sent, errors, matched int
+	changes               map[string]int
+	recorded, replayed    []time.Duration
+}
+
+func (s *routeStats) add(res Result) {
+	s.sent++
+	if d := recordedDuration(res); d > 0 {
+		s.recorded = append(s.recorded, d)
+	}
+	if res.Err != nil {
+		s.errors++
+		return
+	}
+	s.replayed = append(s.replayed, res.Latency)
+	if res.Status == res.Entry.Status {
+		s.matched++
+		return
+	}
+	if s.changes == nil {
+		s.changes = make(map[string]int)
+	}
+	s.changes[fmt.Sprintf("%d->%d", res.Entry.Status, res.Status)]++
+}
+
+// latencies summarizes the recorded and replayed durations. The delta is
+// only set when both are known.
+func (s *routeStats) latencies() (recorded, replayed, delta Latency) {
+	recorded, replayed = latency(s.recorded), latency(s.replayed)
+	if len(s.recorded) > 0 && len(s.replayed) > 0 {
+		delta = replayed.sub(recorded)
+	}
+	return recorded, replayed, delta
+}
+
+func newSummary(target string, diffs bool) *Summary {
+	s := &Summary{Target: target, StartedAt: time.Now(), routes: make(map[string]*routeStats)}
+	if diffs {
+		s.Diff = diff.NewReport()
+	}
+	return s
+}
+
+// add counts one result. Calls must not overlap.
+func (s *Summary) add(res Result) {
+	s.Entries++
+	if res.Skipped != "" {
+		if s.Skipped == nil {
+			s.Skipped = make(map[string]int)
+		}
+		s.Skipped[res.Skipped]++
+		return
+	}
+	s.all.add(res)
+	path := diff.RoutePath(res.Entry.Path)
+	if res.Compared {
+		s.Diff.Add(res.Entry.Method, path, res.Changes)
+	}
+
+	key := res.Entry.Method + " " + path
+	route, ok := s.routes[key]
+	if !ok {
+		route = &routeStats{}
+		s.routes[key] = route
+	}
+	route.add(res)
+}
+
+// finish computes the totals and per-route comparisons, busiest route first.
+func (s *Summary) finish(now time.Time) {
+	s.FinishedAt = now
+	s.Sent, s.Errors, s.StatusMatched, s.StatusChanges = s.all.sent, s.all.errors, s.all.matched, s.all.changes
+	s.Recorded, s.Replayed, s.Delta = s.all.latencies()
+	if s.Diff != nil {
+		s.Diff.Finish()
+	}
+
+	s.Routes = make([]RouteSummary, 0, len(s.routes))
+	for key, r := range s.routes {
+		method, path, _ := strings.Cut(key, " ")
+		route := RouteSummary{
+			Method:        method,
+			Path:          path,
+			Sent:          r.sent,
+			Errors:        r.errors,
+			StatusMatched: r.matched,
+			StatusChanges: r.changes,
+		}
+		route.Recorded, route.Replayed, route.Delta = r.latencies()
+		s.Routes = append(s.Routes, route)
+	}
+	sort.Slice(s.Routes, func(i, j int) bool {
+		if s.Routes[i].Sent != s.Routes[j].Sent {
+			return s.Routes[i].Sent > s.Routes[j].Sent
+		}
+		return s.Routes[i].Method+s.Routes[i].Path < s.Routes[j].Method+s.Routes[j].Path
+	})
+}
+
+// recordedDuration returns the recorded duration of the entry, reading the
+// human-readable duration of version 1 entries.
+func recordedDuration(res Result) time.Duration {
+	if res.Entry.DurationMs > 0 {
+		return time.Duration(res.Entry.DurationMs * float64(time.Millisecond))
+	}
+	d, _ := time.ParseDuration(res.Entry.Duration)
+	return d
+}
+
+func latency(durations []time.Duration) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return Latency{
+		P50Ms:  percentile(sorted, 0.50),
+		P95Ms:  percentile(sorted, 0.95),
+		P99Ms:  percentile(sorted, 0.99),
+		MeanMs: ms(total / time.Duration(len(sorted))),
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) float64 {
+	return ms(sorted[int(float64(len(sorted)-1)*p)])
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Text renders the summary for a terminal.
+func (s *Summary) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Replayed %d of %d entries against %s in %s\n",
+		s.Sent, s.Entries, s.Target, s.FinishedAt.Sub(s.StartedAt).Round(time.Millisecond))
+	for _, reason := range sortedKeys(s.Skipped) {
+		fmt.Fprintf(&b, "  skipped (%s): %d\n", reason, s.Skipped[reason])
+	}
+	fmt.Fprintf(&b, "Status: %d matched, %d changed, %d errors\n", s.StatusMatched, s.Sent-s.StatusMatched-s.Errors, s.Errors)
+	for _, change := range sortedKeys(s.StatusChanges) {
+		fmt.Fprintf(&b, "  %s: %d\n", change, s.StatusChanges[change])
+	}
+	fmt.Fprintf(&b, "%-12s %8s %8s %8s %8s\n", "Latency (ms)", "p50", "p95", "p99", "mean")
+	writeLatency(&b, "%-12s %8.1f %8.1f %8.1f %8.1f\n", "  recorded", s.Recorded)
+	writeLatency(&b, "%-12s %8.1f %8.1f %8.1f %8.1f\n", "  replayed", s.Replayed)
+	writeLatency(&b, "%-12s %+8.1f %+8.1f %+8.1f %+8.1f\n", "  delta", s.Delta)
+
+	if len(s.Routes) > 0 {
+		fmt.Fprintf(&b, "\n%-40s %5s  %7s  %8s  %8s\n", "Route", "sent", "matched", "p50 Δms", "p99 Δms")
+		for _, r := range s.Routes {
+			fmt.Fprintf(&b, "%-40s %5d  %7d  %+8.1f  %+8.1f\n",
+				truncate(r.Method+" "+r.Path, 40), r.Sent, r.StatusMatched, r.Delta.P50Ms, r.Delta.P99Ms)
+		}
+	}
+	if s.Diff != nil {
+		b.WriteString("\n" + s.Diff.Text())
+	}
+	return b.String()
+}
+
+func writeLatency(b *strings.Builder, format, label string, l Latency) {
+	fmt.Fprintf(b, format, label, l.P50Ms, l.P95Ms, l.P99Ms, l.MeanMs)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "…"
+}
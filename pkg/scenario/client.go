@@ -0,0 +1,16 @@
+package scenario
+
+import (
+	"context"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+// Client is the part of Sentinel's admin API a scenario needs; admin.Client
+// implements it.
+type Client interface {
+	StartExperiment(ctx context.Context, e *chaos.Experiment) (*chaos.Experiment, error)
+	AbortExperiment(ctx context.Context, id string) error
+	Metrics(ctx context.Context) (metrics.Snapshot, error)
+}
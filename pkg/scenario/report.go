@@ -0,0 +1,84 @@
+package scenario
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of a scenario run.
+type Report struct {
+	Scenario   string       `json:"scenario"`
+	Passed     bool         `json:"passed"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Steps      []StepResult `json:"steps"`
+}
+
+// StepResult is the outcome of a single step.
+type StepResult struct {
+	Name       string            `json:"name"`
+	Passed     bool              `json:"passed"`
+	Error      string            `json:"error,omitempty"`
+	Experiment string            `json:"experiment,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	Duration   string            `json:"duration"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+}
+
+// AssertionResult records the observed value of an asserted metric.
+type AssertionResult struct {
+	Metric string   `json:"metric"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Value  float64  `json:"value"`
+	Passed bool     `json:"passed"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Status returns "PASSED" or "FAILED".
+func (r *Report) Status() string {
+	if r.Passed {
+		return "PASSED"
+	}
+	return "FAILED"
+}
+
+// Markdown renders the report for humans, e.g. a game day write-up.
+func (r *Report) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Scenario: %s\n\n", r.Scenario)
+	fmt.Fprintf(&b, "**Result:** %s  \n", r.Status())
+	fmt.Fprintf(&b, "**Started:** %s  \n", r.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "**Duration:** %s\n\n", r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+
+	b.WriteString("| # | Step | Result | Duration | Details |\n")
+	b.WriteString("|---|------|--------|----------|---------|\n")
+	for i, step := range r.Steps {
+		result := "✅ pass"
+		if !step.Passed {
+			result = "❌ fail"
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n", i+1, step.Name, result, step.Duration, stepDetails(step))
+	}
+	return b.String()
+}
+
+func stepDetails(step StepResult) string {
+	var details []string
+	if step.Experiment != "" {
+		details = append(details, "experiment `"+step.Experiment+"`")
+	}
+	for _, a := range step.Assertions {
+		mark := "✓"
+		if !a.Passed {
+			mark = "✗"
+		}
+		details = append(details, fmt.Sprintf("%s %s = %.2f", mark, a.Metric, a.Value))
+	}
+	if step.Error != "" && len(step.Assertions) == 0 {
+		details = append(details, step.Error)
+	}
+	return strings.Join(details, "<br>")
+}
@@ -0,0 +1,144 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+)
+
+// Runner executes scenarios step by step against a Sentinel.
+type Runner struct {
+	Client   Client
+	Progress io.Writer // receives one line per event; may be nil
+
+	// sleep is replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewRunner(client Client, progress io.Writer) *Runner {
+	return &Runner{
+		Client:   client,
+		Progress: progress,
+		sleep:    sleepContext,
+	}
+}
+
+// Run executes every step in order and returns the report. Experiments
+// started by the scenario are aborted when it stops early.
+func (r *Runner) Run(ctx context.Context, s *Scenario) *Report {
+	report := &Report{
+		Scenario:  s.Name,
+		StartedAt: time.Now(),
+		Passed:    true,
+	}
+
+	var started []string
+	defer func() {
+		for _, id := range started {
+			// Completed experiments reject the abort, which is fine.
+			r.Client.AbortExperiment(context.Background(), id)
+		}
+	}()
+
+	for i, step := range s.Steps {
+		r.logf("▶ [%d/%d] %s", i+1, len(s.Steps), step.Name)
+
+		result := r.runStep(ctx, s, step, &started)
+		report.Steps = append(report.Steps, result)
+
+		if result.Passed {
+			r.logf("  ✅ %s passed (%s)", step.Name, result.Duration)
+			continue
+		}
+
+		r.logf("  ❌ %s failed: %s", step.Name, result.Error)
+		report.Passed = false
+		if !step.ContinueOnFailure || ctx.Err() != nil {
+			break
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	r.logf("%s Scenario %q %s", map[bool]string{true: "🏁", false: "💥"}[report.Passed], s.Name, report.Status())
+	return report
+}
+
+func (r *Runner) runStep(ctx context.Context, s *Scenario, step Step, started *[]string) (result StepResult) {
+	begin := time.Now()
+	result = StepResult{Name: step.Name, StartedAt: begin}
+	defer func() { result.Duration = time.Since(begin).Round(time.Millisecond).String() }()
+
+	wait := time.Duration(0)
+	if step.Inject != nil {
+		e, err := r.Client.StartExperiment(ctx, &chaos.Experiment{
+			Name:       fmt.Sprintf("%s: %s", s.Name, step.Name),
+			Hypothesis: s.Description,
+			Rules:      step.Inject.Rules,
+			Duration:   step.Inject.Duration,
+			Ramp:       step.Inject.Ramp,
+		})
+		if err != nil {
+			result.Error = "inject: " + err.Error()
+			return result
+		}
+		*started = append(*started, e.ID)
+		result.Experiment = e.ID
+		wait = time.Duration(step.Inject.Duration)
+		r.logf("  💉 injected %d rule(s) for %s (experiment %s)", len(step.Inject.Rules), step.Inject.Duration.String(), e.ID)
+	}
+	if step.Wait != nil {
+		wait = time.Duration(*step.Wait)
+	}
+
+	if wait > 0 {
+		r.logf("  ⏳ waiting %s", wait)
+		if err := r.sleep(ctx, wait); err != nil {
+			result.Error = "interrupted: " + err.Error()
+			return result
+		}
+	}
+
+	if len(step.Assert) > 0 {
+		snapshot, err := r.Client.Metrics(ctx)
+		if err != nil {
+			result.Error = "metrics: " + err.Error()
+			return result
+		}
+
+		result.Passed = true
+		for _, a := range step.Assert {
+			value, err := a.Check(snapshot)
+			ar := AssertionResult{Metric: a.Metric, Min: a.Min, Max: a.Max, Value: value, Passed: err == nil}
+			if err != nil {
+				ar.Error = err.Error()
+				result.Passed = false
+				result.Error = err.Error()
+			}
+			result.Assertions = append(result.Assertions, ar)
+		}
+		return result
+	}
+
+	result.Passed = true
+	return result
+}
+
+func (r *Runner) logf(format string, args ...interface{}) {
+	if r.Progress != nil {
+		fmt.Fprintf(r.Progress, format+"\n", args...)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,114 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+// Scenario is a game day playbook: an ordered list of steps.
+type Scenario struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Steps       []Step `yaml:"steps" json:"steps"`
+}
+
+// Step optionally injects chaos, waits, then checks assertions against
+// Sentinel's live steady-state metrics.
+type Step struct {
+	Name   string          `yaml:"name" json:"name"`
+	Inject *Injection      `yaml:"inject,omitempty" json:"inject,omitempty"`
+	Wait   *chaos.Duration `yaml:"wait,omitempty" json:"wait,omitempty"` // defaults to the injection duration
+	Assert []Assertion     `yaml:"assert,omitempty" json:"assert,omitempty"`
+
+	// ContinueOnFailure keeps the scenario going when this step fails.
+	ContinueOnFailure bool `yaml:"continue_on_failure,omitempty" json:"continue_on_failure,omitempty"`
+}
+
+// Injection is run as a Sentinel experiment for Duration.
+type Injection struct {
+	Rules    []chaos.Rule     `yaml:"rules" json:"rules"`
+	Duration chaos.Duration   `yaml:"duration" json:"duration"`
+	Ramp     []chaos.RampStep `yaml:"ramp,omitempty" json:"ramp,omitempty"`
+}
+
+// Assertion bounds a steady-state metric, e.g. "ghost_rate min 90".
+type Assertion struct {
+	Metric string   `yaml:"metric" json:"metric"`
+	Min    *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max    *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+}
+
+// Check evaluates the assertion against s.
+func (a Assertion) Check(s metrics.Snapshot) (float64, error) {
+	value, ok := s.Value(a.Metric)
+	if !ok {
+		return 0, fmt.Errorf("unknown metric %q", a.Metric)
+	}
+	if a.Min != nil && value < *a.Min {
+		return value, fmt.Errorf("%s = %.2f, expected >= %.2f", a.Metric, value, *a.Min)
+	}
+	if a.Max != nil && value > *a.Max {
+		return value, fmt.Errorf("%s = %.2f, expected <= %.2f", a.Metric, value, *a.Max)
+	}
+	return value, nil
+}
+
+// Load reads and validates a YAML scenario file.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a YAML scenario.
+func Parse(data []byte) (*Scenario, error) {
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate checks the scenario definition.
+func (s *Scenario) Validate() error {
+	if s.Name == "" {
+		return errors.New("scenario name is required")
+	}
+	if len(s.Steps) == 0 {
+		return errors.New("scenario has no steps")
+	}
+
+	for i, step := range s.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("step %d: name is required", i+1)
+		}
+		if step.Inject != nil {
+			if len(step.Inject.Rules) == 0 {
+				return fmt.Errorf("step %q: inject needs at least one rule", step.Name)
+			}
+			if step.Inject.Duration <= 0 {
+				return fmt.Errorf("step %q: inject duration must be positive", step.Name)
+			}
+		}
+		for _, a := range step.Assert {
+			if _, ok := (metrics.Snapshot{}).Value(a.Metric); !ok {
+				return fmt.Errorf("step %q: unknown metric %q", step.Name, a.Metric)
+			}
+			if a.Min == nil && a.Max == nil {
+				return fmt.Errorf("step %q: assertion on %s needs min or max", step.Name, a.Metric)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package scenario
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot/chaosProxy/pkg/chaos"
+	"github.com/elliot/chaosProxy/pkg/metrics"
+)
+
+type fakeClient struct {
+	snapshot metrics.Snapshot
+	started  []*chaos.Experiment
+	aborted  []string
+}
+
+func (f *fakeClient) StartExperiment(ctx context.Context, e *chaos.Experiment) (*chaos.Experiment, error) {
+	e.ID = e.Name
+	f.started = append(f.started, e)
+	return e, nil
+}
+
+func (f *fakeClient) AbortExperiment(ctx context.Context, id string) error {
+	f.aborted = append(f.aborted, id)
+	return nil
+}
+
+func (f *fakeClient) Metrics(ctx context.Context) (metrics.Snapshot, error) {
+	return f.snapshot, nil
+}
+
+func newTestRunner(client Client) (*Runner, *[]time.Duration) {
+	var waits []time.Duration
+	r := NewRunner(client, nil)
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return r, &waits
+}
+
+func TestLoad(t *testing.T) {
+	s, err := Load("testdata/game-day.yaml")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(s.Steps) != 4 {
+		t.Fatalf("Expected 4 steps, got %d", len(s.Steps))
+	}
+	rule := s.Steps[2].Inject.Rules[0]
+	if rule.Match.PathPrefix != "/payments" || rule.Fault.FailureRate != 30 || rule.Fault.Status != 503 {
+		t.Errorf("Unexpected payments rule: %+v", rule)
+	}
+	if time.Duration(s.Steps[0].Inject.Duration) != 5*time.Minute {
+		t.Errorf("Expected 5m duration, got %s", s.Steps[0].Inject.Duration)
+	}
+	if s.Steps[1].Inject.Rules[0].Match.Headers["X-Region"] != "eu-west-1" {
+		t.Errorf("Expected region header matcher, got %+v", s.Steps[1].Inject.Rules[0].Match)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	bad := []string{
+		"name: x\nsteps: []",
+		"name: x\nsteps:\n  - name: a\n    inject: {duration: 1m}",
+		"name: x\nsteps:\n  - name: a\n    assert: [{metric: cpu, max: 1}]",
+	}
+	for _, doc := range bad {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("Expected error for %q", doc)
+		}
+	}
+}
+
+func TestRunner_Pass(t *testing.T) {
+	s, _ := Load("testdata/game-day.yaml")
+	client := &fakeClient{snapshot: metrics.Snapshot{Requests: 100, ErrorRate: 20, GhostRate: 95, P99LatencyMs: 300}}
+	runner, waits := newTestRunner(client)
+
+	report := runner.Run(context.Background(), s)
+	if !report.Passed {
+		t.Fatalf("Expected scenario to pass: %+v", report)
+	}
+	if report.Steps[0].Duration == "" {
+		t.Error("Expected step duration to be recorded")
+	}
+	if len(client.started) != 3 {
+		t.Errorf("Expected 3 experiments, got %d", len(client.started))
+	}
+
+	expected := []time.Duration{5 * time.Minute, 5 * time.Minute, 2 * time.Minute}
+	if len(*waits) != len(expected) {
+		t.Fatalf("Expected waits %v, got %v", expected, *waits)
+	}
+	for i := range expected {
+		if (*waits)[i] != expected[i] {
+			t.Errorf("Wait %d: expected %s, got %s", i, expected[i], (*waits)[i])
+		}
+	}
+
+	md := report.Markdown()
+	if !strings.Contains(md, "PASSED") || !strings.Contains(md, "Verify ghost coverage") {
+		t.Errorf("Unexpected markdown report:\n%s", md)
+	}
+}
+
+func TestRunner_StopsOnFailure(t *testing.T) {
+	s, _ := Load("testdata/game-day.yaml")
+	client := &fakeClient{snapshot: metrics.Snapshot{Requests: 100, P99LatencyMs: 1200}}
+	runner, _ := newTestRunner(client)
+
+	report := runner.Run(context.Background(), s)
+	if report.Passed {
+		t.Fatal("Expected scenario to fail")
+	}
+	if len(report.Steps) != 1 {
+		t.Errorf("Expected the run to stop after the first step, got %d steps", len(report.Steps))
+	}
+	if len(client.aborted) != 1 {
+		t.Errorf("Expected started experiments to be aborted, got %v", client.aborted)
+	}
+}